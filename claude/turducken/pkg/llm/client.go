@@ -107,7 +107,7 @@ State/Actor Semantics:
   - Every state belongs to an actor. Use actor/1 or actor/2 plus actor_state/3 and actor_transition/4.
   - A state name is a guard label: after a transition edits actor variables, all matching states are considered.
   - Channel constraints apply: do not send on full channels or recv on empty channels.
-  - For simulation only, a dice roll is made BEFORE selecting among matching states.
+  - For simulation only, each actor rolls its own dice BEFORE selecting among matching states.
   - Use dice0(Low, High) inside guards to control probability of which next state is chosen.
   - If you emit any of these predicates in multiple blocks, add discontiguous directives at the top:
     :- discontiguous(doc/2).  :- discontiguous(actor/1).  :- discontiguous(actor/2).
@@ -133,10 +133,21 @@ Process Definitions (recursive equations):
   %   parallel(P1, P2)             - parallel composition
 
 CTL Properties:
-  % Use check_ctl(Formula) to verify
+  % Use check_ctl(Formula) to verify (some initial state satisfies it), or
+  % check_ctl_all(Formula) when every initial state must
   % Formulas: atom(p), not(F), and(F1,F2), or(F1,F2)
   %          ex(F), ax(F), ef(F), af(F), eg(F), ag(F)
-  %          eu(F1,F2), au(F1,F2)
+  %          eu(F1,F2), au(F1,F2), ew(F1,F2), aw(F1,F2) (weak until),
+  %          er(F1,F2), ar(F1,F2) (release), implies(F1,F2), iff(F1,F2)
+  % property/3 formulas may also use CTL notation, e.g. 'AG !(a & b)' or
+  %          'A[p U q]'; every atom must be a local state or appear in prop/2
+  % Bounded: ef_le(N,F), af_le(N,F), eg_le(N,F), ag_le(N,F), eu_le(N,F1,F2),
+  %          au_le(N,F1,F2) within N steps; ef_within(T,F), af_within(T,F),
+  %          ag_within(T,F), eu_within(T,F1,F2), au_within(T,F1,F2) within
+  %          time T, adding up transition_duration/4 times
+  % Use check_mu(Formula) for modal mu-calculus over transition labels:
+  %          diamond(Label,F), box(Label,F), mu(X,F), nu(X,F) with Prolog
+  %          variables X; Label may be a list, not(Label) or any
 
 Sequence Diagrams:
   Derived from channels (send/recv) and state machine annotations.
@@ -152,6 +163,39 @@ Guards and Chance:
   Example:
     low_roll :- dice0(0.0, 0.3).
     high_roll :- dice0(0.3, 1.0).
+  For other quantities, declare a named random variable and read it with roll/2.
+  Each actor draws its own values; when not simulating, roll/2 gives the mean.
+    random_var(demand, normal(100, 15)).   % const, uniform, exp or normal
+    busy_day :- roll(demand, D), D > 120.
+
+Timing:
+  transition_duration(from, label, to, Dist).  % simulated time a transition takes
+  % Dist is const(T), uniform(Low, High), exp(Rate) or normal(Mean, StdDev).
+  % Undeclared transitions are instantaneous.
+  transition_priority(from, label, to, P).     % used by the priority scheduler
+
+Accumulators (profit, inventory, costs):
+  accumulator(name, initial).                  % simulation variable
+  reward(name, label, amount).                 % add amount each time label fires
+  % Read the current value in guards with acc(name, Value), e.g.
+  %   over_target :- acc(profit, P), P > 200.
+
+Parameters (tunable numbers that sweeps and requests can override):
+  param(arrival, 0.3).                         % name and default value
+  transition_prob(idle, arrive, queued, param(arrival)).
+  transition_prob(idle, wait, idle, 1 - param(arrival)).
+  % param(Name) works in transition_prob/4, dice0/2 and distribution
+  % arguments; in other rules read it with param_value(Name, Value).
+
+Progress (deadlock and livelock analysis):
+  accepting(state).                            % a fine place for an actor to stop
+  progress(name).                              % a state or label that counts as progress
+
+Faults (checked on the composed model of actors and channels):
+  channel_fault(chan, lose).                   % or duplicate, reorder
+  actor_may_crash(actor, recovery_state).      % crash and restart
+  partition([actor_a], [actor_b, actor_c]).    % messages between groups dropped
+  % Optional third argument: per-step probability used by the simulator.
 
 Sequence Derivation:
   Do NOT emit message/4 facts unless explicitly requested.
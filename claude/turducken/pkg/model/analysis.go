@@ -0,0 +1,207 @@
+package model
+
+import "sort"
+
+// TraceStep is one global transition of a trace, with the global states
+// rendered by State.String
+type TraceStep struct {
+	From  string `json:"from"`
+	Label string `json:"label"`
+	Actor string `json:"actor,omitempty"`
+	To    string `json:"to"`
+	Fault string `json:"fault,omitempty"`
+}
+
+// Deadlock is a reachable global state where no actor can move and the
+// system has not finished
+type Deadlock struct {
+	State int
+	Trace []TraceStep
+}
+
+// Livelock is a set of global states the system can cycle through forever
+// without progress. Entry is the member closest to the initial state; Trace
+// leads there and Cycle returns to it.
+type Livelock struct {
+	States []int
+	Entry  int
+	Trace  []TraceStep
+	Cycle  []TraceStep
+}
+
+// Environment reports whether an edge is a crash, partition or heal rather
+// than a step of an actor. Such edges are always possible, so they do not
+// keep a state from being deadlocked nor form cycles of their own.
+func (e Edge) Environment() bool {
+	return e.Fault != "" && e.Fault == e.Label
+}
+
+// Accepting reports whether a local state is declared by accepting/1
+func (sys *System) Accepting(state string) bool {
+	return sys.accepting[state]
+}
+
+// Progress reports whether a state or label is declared by progress/1
+func (sys *System) Progress(name string) bool {
+	return sys.progress[name]
+}
+
+// Finished reports whether a global state is an acceptable place to stop:
+// every actor with accepting/1 states is in one, and at least one actor
+// declares them.
+func (sys *System) Finished(s State) bool {
+	declared := make([]bool, len(sys.Actors))
+	for state := range sys.accepting {
+		if i, ok := sys.actorIndex[sys.ownerOf(state)]; ok {
+			declared[i] = true
+		}
+	}
+	finished := false
+	for i, local := range s.Locals {
+		if !declared[i] {
+			continue
+		}
+		if !sys.accepting[local] {
+			return false
+		}
+		finished = true
+	}
+	return finished
+}
+
+// progressed reports whether some actor of a global state is in an
+// accepting or progress state
+func (sys *System) progressed(s State) bool {
+	for _, local := range s.Locals {
+		if sys.accepting[local] || sys.progress[local] {
+			return true
+		}
+	}
+	return false
+}
+
+// Trace returns the shortest trace from the initial state to state i
+func (lts *LTS) Trace(i int) []TraceStep {
+	var rev []TraceStep
+	for i > 0 {
+		l := lts.parent[i]
+		rev = append(rev, lts.traceStep(l.from, lts.Succ[l.from][l.edge]))
+		i = l.from
+	}
+	trace := make([]TraceStep, len(rev))
+	for j, st := range rev {
+		trace[len(rev)-1-j] = st
+	}
+	return trace
+}
+
+func (lts *LTS) traceStep(from int, e Edge) TraceStep {
+	return TraceStep{
+		From:  lts.States[from].String(),
+		Label: e.Label,
+		Actor: e.Actor,
+		To:    lts.States[e.To].String(),
+		Fault: e.Fault,
+	}
+}
+
+// Deadlocks returns the reachable states where only environment edges are
+// possible and the system is not Finished, nearest first
+func (lts *LTS) Deadlocks() []Deadlock {
+	var found []Deadlock
+	for i, edges := range lts.Succ {
+		stuck := true
+		for _, e := range edges {
+			if !e.Environment() {
+				stuck = false
+				break
+			}
+		}
+		if stuck && !lts.System.Finished(lts.States[i]) {
+			found = append(found, Deadlock{State: i, Trace: lts.Trace(i)})
+		}
+	}
+	return found
+}
+
+// Livelocks returns the non-progress cycles, nearest first: strongly
+// connected sets of states, none accepting or marked progress, joined by
+// actor steps whose labels are not marked progress. Without any accepting/1
+// or progress/1 declarations every cycle is reported.
+func (lts *LTS) Livelocks() []Livelock {
+	sys := lts.System
+	inside := make([]bool, len(lts.States))
+	for i, s := range lts.States {
+		inside[i] = !sys.progressed(s)
+	}
+	follow := func(e Edge) bool {
+		return !e.Environment() && !sys.progress[e.Label]
+	}
+
+	var found []Livelock
+	for _, scc := range lts.components(inside, follow) {
+		entry := scc[0]
+		for _, i := range scc {
+			if i < entry {
+				entry = i
+			}
+		}
+		cycle := lts.cycle(entry, scc, follow)
+		if cycle == nil {
+			continue
+		}
+		sort.Ints(scc)
+		found = append(found, Livelock{States: scc, Entry: entry, Trace: lts.Trace(entry), Cycle: cycle})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Entry < found[j].Entry })
+	return found
+}
+
+// cycle returns the shortest cycle from entry back to itself within a set
+// of states, or nil when there is none
+func (lts *LTS) cycle(entry int, states []int, follow func(Edge) bool) []TraceStep {
+	member := make(map[int]bool, len(states))
+	for _, i := range states {
+		member[i] = true
+	}
+	parent := map[int]link{}
+	queue := []int{entry}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for j, e := range lts.Succ[i] {
+			if !follow(e) || !member[e.To] {
+				continue
+			}
+			if e.To == entry {
+				steps := []TraceStep{lts.traceStep(i, e)}
+				for i != entry {
+					l := parent[i]
+					steps = append(steps, lts.traceStep(l.from, lts.Succ[l.from][l.edge]))
+					i = l.from
+				}
+				for a, b := 0, len(steps)-1; a < b; a, b = a+1, b-1 {
+					steps[a], steps[b] = steps[b], steps[a]
+				}
+				return steps
+			}
+			if _, seen := parent[e.To]; !seen {
+				parent[e.To] = link{from: i, edge: j}
+				queue = append(queue, e.To)
+			}
+		}
+	}
+	return nil
+}
+
+// components returns the cyclic strongly connected components of the
+// subgraph of states marked inside and edges accepted by follow
+func (lts *LTS) components(inside []bool, follow func(Edge) bool) [][]int {
+	var out [][]int
+	for _, scc := range Components(lts.Succ, inside, follow) {
+		if Cyclic(lts.Succ, scc, follow) {
+			out = append(out, scc)
+		}
+	}
+	return out
+}
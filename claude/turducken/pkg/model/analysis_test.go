@@ -0,0 +1,84 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// stuckSpec can commit, which finishes, or abort into a state where the
+// client waits for a reply the server never sends
+const stuckSpec = `
+        actor_initial(client, client_ready).
+        actor_initial(server, server_idle).
+        actor_transition(client, client_ready, commit, client_done).
+        actor_transition(client, client_ready, abort, client_waiting).
+        actor_transition(client, client_waiting, ack, client_done).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        accepting(client_done).
+        recv(reply, ok, client_waiting, client_done).
+    `
+
+// retrySpec retries forever without ever reaching done, unless it takes the
+// progress-labelled give_up step
+const retrySpec = `
+        initial(try).
+        accepting(done).
+        progress(give_up).
+        transition(try, fail, wait).
+        transition(wait, retry, try).
+        transition(wait, give_up, done).
+    `
+
+func explore(t *testing.T, spec string) *LTS {
+	t.Helper()
+	lts, err := loadSystem(t, spec).Explore(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Explore error: %v", err)
+	}
+	return lts
+}
+
+func TestDeadlocksWithShortestTrace(t *testing.T) {
+	lts := explore(t, stuckSpec)
+
+	deadlocks := lts.Deadlocks()
+	if len(deadlocks) != 1 {
+		t.Fatalf("expected one deadlock, got %+v", deadlocks)
+	}
+	d := deadlocks[0]
+	if lts.States[d.State].Locals[0] != "client_waiting" {
+		t.Errorf("expected the client to be stuck waiting, got %v", lts.States[d.State])
+	}
+	if len(d.Trace) != 1 || d.Trace[0].Label != "abort" || d.Trace[0].Actor != "client" {
+		t.Errorf("expected the one-step trace through abort, got %+v", d.Trace)
+	}
+	if len(lts.Livelocks()) != 0 {
+		t.Errorf("expected no livelocks in an acyclic model")
+	}
+}
+
+func TestLivelocksSkipProgressCycles(t *testing.T) {
+	lts := explore(t, retrySpec)
+
+	if len(lts.Deadlocks()) != 0 {
+		t.Errorf("expected done to be accepted, got %+v", lts.Deadlocks())
+	}
+	livelocks := lts.Livelocks()
+	if len(livelocks) != 1 {
+		t.Fatalf("expected the retry loop as a livelock, got %+v", livelocks)
+	}
+	l := livelocks[0]
+	if len(l.States) != 2 || l.Entry != 0 || len(l.Trace) != 0 {
+		t.Errorf("expected the loop to start at the initial state, got %+v", l)
+	}
+	if len(l.Cycle) != 2 || l.Cycle[0].Label != "fail" || l.Cycle[1].Label != "retry" {
+		t.Errorf("expected the cycle fail, retry, got %+v", l.Cycle)
+	}
+
+	withProgress := explore(t, strings.Replace(retrySpec, "progress(give_up).", "progress(give_up).\nprogress(retry).", 1))
+	if got := withProgress.Livelocks(); len(got) != 0 {
+		t.Errorf("expected a progress-labelled retry to break the livelock, got %+v", got)
+	}
+}
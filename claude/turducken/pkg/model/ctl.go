@@ -0,0 +1,407 @@
+package model
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+// Satisfies reports whether the initial state satisfies a formula
+func (lts *LTS) Satisfies(f *Formula) (bool, error) {
+	sat, err := lts.Check(f)
+	if err != nil {
+		return false, err
+	}
+	return sat[0], nil
+}
+
+// Check returns the set of states satisfying a formula. Deadlocked states
+// have no successors, so ex, ax, af, eg and au never hold through them,
+// matching the check_ctl/1 semantics.
+func (lts *LTS) Check(f *Formula) ([]bool, error) {
+	c := &checker{lts: lts, pred: make([][]int, len(lts.States))}
+	for s, edges := range lts.Succ {
+		for _, e := range edges {
+			c.pred[e.To] = append(c.pred[e.To], s)
+		}
+	}
+	return c.eval(f)
+}
+
+type checker struct {
+	lts  *LTS
+	pred [][]int
+}
+
+func (c *checker) eval(f *Formula) ([]bool, error) {
+	n := len(c.lts.States)
+	args := make([][]bool, len(f.Args))
+	for i, a := range f.Args {
+		sat, err := c.eval(a)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = sat
+	}
+
+	sat := make([]bool, n)
+	switch f.Op {
+	case "true":
+		for s := range sat {
+			sat[s] = true
+		}
+	case "false":
+	case "atom":
+		for s, state := range c.lts.States {
+			sat[s] = c.lts.System.Holds(state, f.Atom)
+		}
+	case "not":
+		for s := range sat {
+			sat[s] = !args[0][s]
+		}
+	case "and":
+		for s := range sat {
+			sat[s] = args[0][s] && args[1][s]
+		}
+	case "or":
+		for s := range sat {
+			sat[s] = args[0][s] || args[1][s]
+		}
+	case "implies":
+		for s := range sat {
+			sat[s] = !args[0][s] || args[1][s]
+		}
+	case "iff":
+		for s := range sat {
+			sat[s] = args[0][s] == args[1][s]
+		}
+	case "ex":
+		sat = c.ex(args[0])
+	case "ax":
+		sat = c.ax(args[0])
+	case "ef":
+		sat = c.eu(all(n), args[0])
+	case "af":
+		sat = c.au(all(n), args[0])
+	case "eg":
+		sat = c.eg(args[0])
+	case "ag":
+		// AG phi = not EF not phi
+		notPhi := make([]bool, n)
+		for s := range notPhi {
+			notPhi[s] = !args[0][s]
+		}
+		reach := c.eu(all(n), notPhi)
+		for s := range sat {
+			sat[s] = !reach[s]
+		}
+	case "eu":
+		sat = c.eu(args[0], args[1])
+	case "au":
+		sat = c.au(args[0], args[1])
+	case "ew":
+		// E[phi W psi] = E[phi U psi] or EG phi
+		until, always := c.eu(args[0], args[1]), c.eg(args[0])
+		for s := range sat {
+			sat[s] = until[s] || always[s]
+		}
+	case "aw":
+		// A[phi W psi] = not E[not psi U (not phi and not psi)]
+		notPsi, neither := make([]bool, n), make([]bool, n)
+		for s := range sat {
+			notPsi[s] = !args[1][s]
+			neither[s] = !args[0][s] && !args[1][s]
+		}
+		escape := c.eu(notPsi, neither)
+		for s := range sat {
+			sat[s] = !escape[s]
+		}
+	case "er", "ar":
+		// E[phi R psi] = not A[not phi U not psi], and dually for A
+		notPhi, notPsi := make([]bool, n), make([]bool, n)
+		for s := range sat {
+			notPhi[s] = !args[0][s]
+			notPsi[s] = !args[1][s]
+		}
+		escape := c.au(notPhi, notPsi)
+		if f.Op == "ar" {
+			escape = c.eu(notPhi, notPsi)
+		}
+		for s := range sat {
+			sat[s] = !escape[s]
+		}
+	case "ef_le", "ef_within":
+		sat = within(c.earliest(all(n), args[0], c.cost(f.Op, false)), f.Bound)
+	case "eu_le", "eu_within":
+		sat = within(c.earliest(args[0], args[1], c.cost(f.Op, false)), f.Bound)
+	case "af_le", "af_within":
+		sat = within(c.latest(all(n), args[0], c.cost(f.Op, true)), f.Bound)
+	case "au_le", "au_within":
+		sat = within(c.latest(args[0], args[1], c.cost(f.Op, true)), f.Bound)
+	case "eg_le":
+		sat = c.egLe(args[0], int(f.Bound))
+	case "ag_le", "ag_within":
+		// AG<=k phi = not EF<=k not phi
+		notPhi := make([]bool, n)
+		for s := range notPhi {
+			notPhi[s] = !args[0][s]
+		}
+		reach := within(c.earliest(all(n), notPhi, c.cost(f.Op, false)), f.Bound)
+		for s := range sat {
+			sat[s] = !reach[s]
+		}
+	default:
+		if modal(f.Op) {
+			return nil, fmt.Errorf("mu-calculus operator %s is checked by check_mu/1 over transition/3", f.Op)
+		}
+		return nil, fmt.Errorf("unknown CTL operator %s", f.Op)
+	}
+	return sat, nil
+}
+
+func all(n int) []bool {
+	sat := make([]bool, n)
+	for s := range sat {
+		sat[s] = true
+	}
+	return sat
+}
+
+func (c *checker) ex(phi []bool) []bool {
+	sat := make([]bool, len(phi))
+	for s, edges := range c.lts.Succ {
+		for _, e := range edges {
+			if phi[e.To] {
+				sat[s] = true
+				break
+			}
+		}
+	}
+	return sat
+}
+
+func (c *checker) ax(phi []bool) []bool {
+	sat := make([]bool, len(phi))
+	for s, edges := range c.lts.Succ {
+		sat[s] = len(edges) > 0
+		for _, e := range edges {
+			if !phi[e.To] {
+				sat[s] = false
+				break
+			}
+		}
+	}
+	return sat
+}
+
+// eu computes E[phi U psi] as a backward search from psi through phi states
+func (c *checker) eu(phi, psi []bool) []bool {
+	sat := append([]bool(nil), psi...)
+	var work []int
+	for s, ok := range sat {
+		if ok {
+			work = append(work, s)
+		}
+	}
+	for len(work) > 0 {
+		s := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, p := range c.pred[s] {
+			if !sat[p] && phi[p] {
+				sat[p] = true
+				work = append(work, p)
+			}
+		}
+	}
+	return sat
+}
+
+// au computes A[phi U psi]: a phi state joins once all its successors have
+func (c *checker) au(phi, psi []bool) []bool {
+	sat := append([]bool(nil), psi...)
+	remaining := make([]int, len(sat))
+	var work []int
+	for s, edges := range c.lts.Succ {
+		remaining[s] = len(edges)
+		if sat[s] {
+			work = append(work, s)
+		}
+	}
+	for len(work) > 0 {
+		s := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, p := range c.pred[s] {
+			remaining[p]--
+			if !sat[p] && phi[p] && remaining[p] == 0 {
+				sat[p] = true
+				work = append(work, p)
+			}
+		}
+	}
+	return sat
+}
+
+// eg computes EG phi: a path through phi states leads to a cycle of phi
+// states, found as a cyclic strongly connected component of the phi states
+func (c *checker) eg(phi []bool) []bool {
+	cyclic := make([]bool, len(phi))
+	for _, scc := range Components(c.lts.Succ, phi, nil) {
+		if Cyclic(c.lts.Succ, scc, nil) {
+			for _, s := range scc {
+				cyclic[s] = true
+			}
+		}
+	}
+	return c.eu(phi, cyclic)
+}
+
+// EdgeTime returns the least and greatest time an edge takes, from the
+// transition_duration/4 of the actor step it fires. Environment edges and
+// steps without a declared duration take no time.
+func (lts *LTS) EdgeTime(s int, e Edge) (float64, float64) {
+	if e.Environment() {
+		return 0, 0
+	}
+	a, ok := lts.System.ActorIndex(e.Actor)
+	if !ok {
+		return 0, 0
+	}
+	t := lts.System.times[prolog.Transition{From: lts.States[s].Locals[a], Label: e.Label, To: lts.States[e.To].Locals[a]}]
+	return t[0], t[1]
+}
+
+// cost returns the cost of an edge under a bounded operator: one per step
+// for the _le operators, and the fastest or slowest time for _within ones
+func (c *checker) cost(op string, slowest bool) func(s int, e Edge) float64 {
+	if stepBounded(op) {
+		return func(int, Edge) float64 { return 1 }
+	}
+	return func(s int, e Edge) float64 {
+		min, max := c.lts.EdgeTime(s, e)
+		if slowest {
+			return max
+		}
+		return min
+	}
+}
+
+// within marks the costs that do not exceed a bound
+func within(costs []float64, bound float64) []bool {
+	sat := make([]bool, len(costs))
+	for s, d := range costs {
+		sat[s] = d <= bound+1e-9
+	}
+	return sat
+}
+
+// earliest returns the least cost of a path through phi states to a psi
+// state, or +Inf when there is none, by Dijkstra's algorithm backwards
+// from psi
+func (c *checker) earliest(phi, psi []bool, cost func(int, Edge) float64) []float64 {
+	dist := make([]float64, len(psi))
+	q := &costQueue{}
+	for s := range dist {
+		dist[s] = math.Inf(1)
+		if psi[s] {
+			dist[s] = 0
+			heap.Push(q, costItem{state: s})
+		}
+	}
+	for q.Len() > 0 {
+		it := heap.Pop(q).(costItem)
+		if it.cost > dist[it.state] {
+			continue
+		}
+		for _, p := range c.pred[it.state] {
+			if psi[p] || !phi[p] {
+				continue
+			}
+			for _, e := range c.lts.Succ[p] {
+				if e.To != it.state {
+					continue
+				}
+				if d := it.cost + cost(p, e); d < dist[p] {
+					dist[p] = d
+					heap.Push(q, costItem{state: p, cost: d})
+				}
+			}
+		}
+	}
+	return dist
+}
+
+// latest returns the greatest cost of reaching a psi state through phi
+// states along any path, or +Inf when some path may never get there. As in
+// au, a phi state is settled once all its successors are.
+func (c *checker) latest(phi, psi []bool, cost func(int, Edge) float64) []float64 {
+	worst := make([]float64, len(psi))
+	remaining := make([]int, len(psi))
+	var work []int
+	for s, edges := range c.lts.Succ {
+		worst[s] = math.Inf(1)
+		remaining[s] = len(edges)
+		if psi[s] {
+			worst[s] = 0
+			work = append(work, s)
+		}
+	}
+	for len(work) > 0 {
+		s := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, p := range c.pred[s] {
+			remaining[p]--
+			if psi[p] || !phi[p] || remaining[p] > 0 {
+				continue
+			}
+			w := 0.0
+			for _, e := range c.lts.Succ[p] {
+				if d := cost(p, e) + worst[e.To]; d > w {
+					w = d
+				}
+			}
+			worst[p] = w
+			work = append(work, p)
+		}
+	}
+	return worst
+}
+
+// egLe computes EG<=k phi: some path keeps phi for its first k steps
+func (c *checker) egLe(phi []bool, k int) []bool {
+	sat := append([]bool(nil), phi...)
+	for i := 0; i < k; i++ {
+		next := c.ex(sat)
+		changed := false
+		for s := range sat {
+			if sat[s] && !next[s] {
+				sat[s] = false
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return sat
+}
+
+type costItem struct {
+	state int
+	cost  float64
+}
+
+// costQueue is a min-heap of states by cost
+type costQueue []costItem
+
+func (q costQueue) Len() int            { return len(q) }
+func (q costQueue) Less(i, j int) bool  { return q[i].cost < q[j].cost }
+func (q costQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *costQueue) Push(x interface{}) { *q = append(*q, x.(costItem)) }
+func (q *costQueue) Pop() interface{} {
+	old := *q
+	it := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return it
+}
@@ -0,0 +1,167 @@
+package model
+
+import (
+	"math"
+	"testing"
+
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+func TestParseFormula(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    string
+		wantErr bool
+	}{
+		{"ag(not(and(atom(committed), atom(aborted))))", "ag(not(and(atom(committed), atom(aborted))))", false},
+		{"eu(atom(a),atom(b)).", "eu(atom(a), atom(b))", false},
+		{"af(atom('Done'))", "af(atom('Done'))", false},
+		{"true", "true", false},
+		{"ag(atom(a)", "", true},
+		{"eventually(atom(a))", "", true},
+		{"and(atom(a))", "", true},
+		{"ef_le(6, atom(committed))", "ef_le(6, atom(committed))", false},
+		{"au_within(2.5, atom(a), atom(b))", "au_within(2.5, atom(a), atom(b))", false},
+		{"ef_le(1.5, atom(a))", "", true},
+		{"af_within(-1, atom(a))", "", true},
+		{"ag_le(atom(a))", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			f, err := ParseFormula(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFormula(%q) error = %v, wantErr %v", tt.src, err, tt.wantErr)
+			}
+			if err == nil && f.String() != tt.want {
+				t.Errorf("ParseFormula(%q) = %s, want %s", tt.src, f, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckMatchesDeadlockSemantics(t *testing.T) {
+	// s0 -> s1 -> s1 (loop), s0 -> s2 (deadlock)
+	lts := &LTS{
+		System: &System{props: map[string][]string{"s1": {"p"}, "s2": {"q"}}},
+		States: []State{{Locals: []string{"s0"}}, {Locals: []string{"s1"}}, {Locals: []string{"s2"}}},
+		Succ: [][]Edge{
+			{{Label: "a", To: 1}, {Label: "b", To: 2}},
+			{{Label: "loop", To: 1}},
+			nil,
+		},
+	}
+
+	tests := []struct {
+		formula string
+		want    []bool
+	}{
+		{"ex(atom(p))", []bool{true, true, false}},
+		{"ax(atom(p))", []bool{false, true, false}},
+		{"ef(atom(q))", []bool{true, false, true}},
+		{"af(or(atom(p), atom(q)))", []bool{true, true, true}},
+		{"eg(not(atom(q)))", []bool{true, true, false}},
+		{"ag(atom(q))", []bool{false, false, true}},
+		{"au(atom(s0), atom(p))", []bool{false, true, false}},
+		{"implies(atom(q), ag(atom(q)))", []bool{true, true, true}},
+		{"iff(atom(p), ex(atom(p)))", []bool{false, true, true}},
+		{"E[s0 W q]", []bool{true, false, true}},
+		{"A[!q W p]", []bool{false, true, false}},
+		{"E[q R !p]", []bool{true, false, true}},
+		{"A[q R !p]", []bool{false, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.formula, func(t *testing.T) {
+			f, err := ParseFormula(tt.formula)
+			if err != nil {
+				t.Fatalf("ParseFormula error: %v", err)
+			}
+			sat, err := lts.Check(f)
+			if err != nil {
+				t.Fatalf("Check error: %v", err)
+			}
+			for s := range tt.want {
+				if sat[s] != tt.want[s] {
+					t.Errorf("state %d: got %v, want %v", s, sat[s], tt.want[s])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckBoundedOperators(t *testing.T) {
+	// A vote commits after 2 steps, or times out and aborts after 3
+	tr := func(from, label, to string) prolog.Transition {
+		return prolog.Transition{From: from, Label: label, To: to}
+	}
+	lts := &LTS{
+		System: &System{
+			actorIndex: map[string]int{"coord": 0},
+			props: map[string][]string{
+				"committed": {"decided"},
+				"aborted":   {"decided"},
+			},
+			times: map[prolog.Transition][2]float64{
+				tr("idle", "request", "voting"):     {1, 1},
+				tr("voting", "yes", "committed"):    {1, 2},
+				tr("voting", "wait", "waiting"):     {3, 3},
+				tr("waiting", "timeout", "aborted"): {0, math.Inf(1)},
+			},
+		},
+		States: []State{
+			{Locals: []string{"idle"}},
+			{Locals: []string{"voting"}},
+			{Locals: []string{"committed"}},
+			{Locals: []string{"waiting"}},
+			{Locals: []string{"aborted"}},
+		},
+		Succ: [][]Edge{
+			{{Label: "request", Actor: "coord", To: 1}},
+			{{Label: "yes", Actor: "coord", To: 2}, {Label: "wait", Actor: "coord", To: 3}},
+			nil,
+			{{Label: "timeout", Actor: "coord", To: 4}},
+			nil,
+		},
+	}
+
+	tests := []struct {
+		formula string
+		want    bool
+	}{
+		{"ef_le(2, atom(decided))", true},
+		{"ef_le(1, atom(decided))", false},
+		{"af_le(3, atom(decided))", true},
+		{"af_le(2, atom(decided))", false},
+		{"eg_le(2, not(atom(decided)))", true},
+		{"eg_le(3, not(atom(decided)))", false},
+		{"ag_le(1, not(atom(decided)))", true},
+		{"ag_le(2, not(atom(decided)))", false},
+		{"eu_le(2, not(atom(waiting)), atom(committed))", true},
+		{"au_le(3, true, atom(decided))", true},
+		{"ef_within(2, atom(committed))", true},
+		{"ef_within(1.5, atom(committed))", false},
+		{"af_within(4, or(atom(committed), atom(waiting)))", true},
+		{"af_within(3.5, or(atom(committed), atom(waiting)))", false},
+		{"af_within(100, atom(decided))", false},
+		{"ag_within(1.5, not(atom(decided)))", true},
+		{"ag_within(2, not(atom(decided)))", false},
+		{"au_within(4, not(atom(decided)), or(atom(committed), atom(waiting)))", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.formula, func(t *testing.T) {
+			f, err := ParseFormula(tt.formula)
+			if err != nil {
+				t.Fatalf("ParseFormula error: %v", err)
+			}
+			got, err := lts.Satisfies(f)
+			if err != nil {
+				t.Fatalf("Check error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
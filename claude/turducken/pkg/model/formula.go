@@ -0,0 +1,786 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+// Formula is a CTL formula, possibly with modal mu-calculus operators.
+// String renders it in the term syntax used by check_ctl/1 and check_mu/1,
+// e.g. ag(not(and(atom(committed), atom(aborted)))), and Notation in CTL
+// notation, e.g. AG !(committed & aborted).
+type Formula struct {
+	Op string
+	// Atom is the proposition of atom, or the fixpoint variable of var, mu
+	// and nu
+	Atom string
+	Args []*Formula
+	// Bound is the step or time bound of a bounded operator
+	Bound float64
+	// Action is the label set of box and diamond, in term syntax
+	Action string
+}
+
+// formulaArity lists the operators and how many subformulas they take.
+// atom, the bounded operators, mu, nu, box and diamond also take a first
+// argument that is not a formula.
+var formulaArity = map[string]int{
+	"true":    0,
+	"false":   0,
+	"atom":    0,
+	"not":     1,
+	"and":     2,
+	"or":      2,
+	"implies": 2,
+	"iff":     2,
+	"ex":      1,
+	"ax":      1,
+	"ef":      1,
+	"af":      1,
+	"eg":      1,
+	"ag":      1,
+	"eu":      2,
+	"au":      2,
+	// Weak until and release
+	"ew": 2,
+	"aw": 2,
+	"er": 2,
+	"ar": 2,
+
+	// Bounded operators take the bound first: a step count for the _le
+	// operators, and a time for the _within ones
+	"ef_le":     1,
+	"af_le":     1,
+	"eg_le":     1,
+	"ag_le":     1,
+	"eu_le":     2,
+	"au_le":     2,
+	"ef_within": 1,
+	"af_within": 1,
+	"ag_within": 1,
+	"eu_within": 2,
+	"au_within": 2,
+
+	// Mu-calculus operators, checked by check_mu/1
+	"mu":      1,
+	"nu":      1,
+	"box":     1,
+	"diamond": 1,
+}
+
+// stepBounded and timeBounded report whether an operator takes a bound
+func stepBounded(op string) bool { return strings.HasSuffix(op, "_le") }
+func timeBounded(op string) bool { return strings.HasSuffix(op, "_within") }
+
+// modal reports whether an operator belongs to the mu-calculus
+func modal(op string) bool {
+	return op == "mu" || op == "nu" || op == "box" || op == "diamond" || op == "var"
+}
+
+// ParseFormula parses a formula in term syntax, in CTL notation, or a mix
+// of both. CTL notation has atoms as bare names, ! or not, & or and, | or
+// or, -> or implies, <-> or iff, the prefix operators EX, AX, EF, AF, EG
+// and AG, and E[p U q] and A[p U q] with W for weak until and R for
+// release. Bounds follow the operator, as in EF<=6 p, E[p U<=6 q] and
+// AF within 2.5 p.
+func ParseFormula(src string) (*Formula, error) {
+	toks, err := lexFormula(strings.TrimSuffix(strings.TrimSpace(src), "."))
+	if err != nil {
+		return nil, err
+	}
+	p := &formulaParser{toks: toks}
+	f, err := p.iff()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+	}
+	if err := checkFixpoints(f, nil, false); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Modal reports whether a formula uses mu-calculus operators
+func (f *Formula) Modal() bool {
+	if modal(f.Op) {
+		return true
+	}
+	for _, a := range f.Args {
+		if a.Modal() {
+			return true
+		}
+	}
+	return false
+}
+
+// Atoms returns the propositions a formula refers to, sorted
+func (f *Formula) Atoms() []string {
+	seen := make(map[string]bool)
+	var walk func(*Formula)
+	walk = func(f *Formula) {
+		if f.Op == "atom" {
+			seen[f.Atom] = true
+		}
+		for _, a := range f.Args {
+			walk(a)
+		}
+	}
+	walk(f)
+	atoms := make([]string, 0, len(seen))
+	for a := range seen {
+		atoms = append(atoms, a)
+	}
+	sort.Strings(atoms)
+	return atoms
+}
+
+// String renders the formula in term syntax, quoting atoms as needed, so
+// the result is safe to pass to the Prolog checker
+func (f *Formula) String() string {
+	switch f.Op {
+	case "atom":
+		return "atom(" + prolog.QuoteAtom(f.Atom) + ")"
+	case "true", "false", "var":
+		if f.Op == "var" {
+			return f.Atom
+		}
+		return f.Op
+	}
+	args := make([]string, 0, len(f.Args)+1)
+	switch {
+	case stepBounded(f.Op) || timeBounded(f.Op):
+		args = append(args, formatBound(f.Bound))
+	case f.Op == "mu" || f.Op == "nu":
+		args = append(args, f.Atom)
+	case f.Op == "box" || f.Op == "diamond":
+		args = append(args, f.Action)
+	}
+	for _, a := range f.Args {
+		args = append(args, a.String())
+	}
+	return f.Op + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Binding strength of operators in CTL notation
+const (
+	precIff = iota + 1
+	precImplies
+	precOr
+	precAnd
+	precUnary
+	precPrimary
+)
+
+func (f *Formula) prec() int {
+	switch f.Op {
+	case "iff":
+		return precIff
+	case "implies":
+		return precImplies
+	case "or":
+		return precOr
+	case "and":
+		return precAnd
+	case "not", "ex", "ax", "ef", "af", "eg", "ag",
+		"ef_le", "af_le", "eg_le", "ag_le", "ef_within", "af_within", "ag_within":
+		return precUnary
+	}
+	return precPrimary
+}
+
+// Notation renders the formula in CTL notation, which ParseFormula reads
+// back. Mu-calculus operators keep their term syntax.
+func (f *Formula) Notation() string {
+	return f.notation(0)
+}
+
+func (f *Formula) notation(min int) string {
+	if f.prec() < min {
+		return "(" + f.render() + ")"
+	}
+	return f.render()
+}
+
+func (f *Formula) render() string {
+	switch f.Op {
+	case "atom":
+		return prolog.QuoteAtom(f.Atom)
+	case "true", "false":
+		return f.Op
+	case "var":
+		return f.Atom
+	case "not":
+		return "!" + f.Args[0].notation(precUnary)
+	case "and":
+		return f.Args[0].notation(precAnd) + " & " + f.Args[1].notation(precAnd)
+	case "or":
+		return f.Args[0].notation(precOr) + " | " + f.Args[1].notation(precOr)
+	case "implies":
+		return f.Args[0].notation(precImplies+1) + " -> " + f.Args[1].notation(precImplies)
+	case "iff":
+		return f.Args[0].notation(precIff) + " <-> " + f.Args[1].notation(precIff+1)
+	case "mu", "nu":
+		return f.Op + "(" + f.Atom + ", " + f.Args[0].notation(0) + ")"
+	case "box", "diamond":
+		return f.Op + "(" + f.Action + ", " + f.Args[0].notation(0) + ")"
+	}
+
+	op, bound := f.Op, ""
+	if i := strings.IndexByte(op, '_'); i >= 0 {
+		op = f.Op[:i]
+		if stepBounded(f.Op) {
+			bound = "<=" + formatBound(f.Bound)
+		} else {
+			bound = " within " + formatBound(f.Bound)
+		}
+	}
+	if len(f.Args) == 1 {
+		return strings.ToUpper(op) + bound + " " + f.Args[0].notation(precUnary)
+	}
+	quantifier, connective := strings.ToUpper(op[:1]), map[byte]string{'u': "U", 'w': "W", 'r': "R"}[op[1]]
+	return quantifier + "[" + f.Args[0].notation(0) + " " + connective + bound + " " + f.Args[1].notation(0) + "]"
+}
+
+func formatBound(b float64) string {
+	return strconv.FormatFloat(b, 'g', -1, 64)
+}
+
+// checkFixpoints checks that every fixpoint variable is bound by an
+// enclosing mu or nu, and occurs under an even number of negations counted
+// from its binder, so that the fixpoints exist
+func checkFixpoints(f *Formula, env map[string]bool, negated bool) error {
+	switch f.Op {
+	case "var":
+		bound, ok := env[f.Atom]
+		if !ok {
+			return fmt.Errorf("fixpoint variable %s is not bound by mu or nu", f.Atom)
+		}
+		if bound != negated {
+			return fmt.Errorf("fixpoint variable %s occurs under an odd number of negations", f.Atom)
+		}
+		return nil
+	case "mu", "nu":
+		inner := make(map[string]bool, len(env)+1)
+		for k, v := range env {
+			inner[k] = v
+		}
+		inner[f.Atom] = negated
+		return checkFixpoints(f.Args[0], inner, negated)
+	case "not":
+		return checkFixpoints(f.Args[0], env, !negated)
+	case "implies":
+		if err := checkFixpoints(f.Args[0], env, !negated); err != nil {
+			return err
+		}
+		return checkFixpoints(f.Args[1], env, negated)
+	case "iff":
+		// Both sides occur both negated and not
+		for _, a := range f.Args {
+			for _, n := range []bool{negated, !negated} {
+				if err := checkFixpoints(a, env, n); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, a := range f.Args {
+		if err := checkFixpoints(a, env, negated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks that every atom of a formula names a local state or a
+// prop of one, suggesting the closest name for a likely typo
+func (sys *System) Validate(f *Formula) error {
+	known := make(map[string]bool)
+	for _, s := range append(append([]string(nil), sys.localStates...), sys.propNames...) {
+		known[s] = true
+	}
+	for _, props := range sys.props {
+		for _, p := range props {
+			known[p] = true
+		}
+	}
+	for _, atom := range f.Atoms() {
+		if known[atom] {
+			continue
+		}
+		if guess := closestName(atom, known); guess != "" {
+			return fmt.Errorf("unknown proposition %q (did you mean %q?)", atom, guess)
+		}
+		return fmt.Errorf("unknown proposition %q: it is neither a state nor a prop/2 of the spec", atom)
+	}
+	return nil
+}
+
+// closestName returns the known name within a small edit distance of name
+func closestName(name string, known map[string]bool) string {
+	names := make([]string, 0, len(known))
+	for k := range known {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	best, bestDist := "", len(name)/3+2
+	for _, k := range names {
+		if d := editDistance(name, k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	// tokName is a lowercase name or a quoted atom
+	tokName
+	// tokUpper is a name starting with a capital or _: an operator such as
+	// AG or U, or a fixpoint variable
+	tokUpper
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	quoted bool
+	pos    int
+}
+
+// is reports whether a token is the given punctuation or unquoted keyword
+func (t token) is(text string) bool {
+	return (t.kind == tokPunct || (t.kind == tokName && !t.quoted)) && t.text == text
+}
+
+// formulaPunct lists punctuation, longest first
+var formulaPunct = []string{"<->", "<=>", "->", "=>", "<=", "&&", "||", "(", ")", "[", "]", ",", "!", "~", "&", "|"}
+
+func lexFormula(src string) ([]token, error) {
+	var toks []token
+	pos := 0
+	for {
+		for pos < len(src) && unicode.IsSpace(rune(src[pos])) {
+			pos++
+		}
+		if pos == len(src) {
+			return append(toks, token{kind: tokEOF, pos: pos}), nil
+		}
+		start := pos
+		c := src[pos]
+		switch {
+		case c == '\'':
+			var b strings.Builder
+			pos++
+			for {
+				if pos >= len(src) {
+					return nil, fmt.Errorf("unterminated quoted atom at offset %d", start)
+				}
+				if src[pos] == '\\' && pos+1 < len(src) {
+					b.WriteByte(src[pos+1])
+					pos += 2
+					continue
+				}
+				if src[pos] == '\'' {
+					if pos+1 < len(src) && src[pos+1] == '\'' {
+						b.WriteByte('\'')
+						pos += 2
+						continue
+					}
+					pos++
+					break
+				}
+				b.WriteByte(src[pos])
+				pos++
+			}
+			toks = append(toks, token{kind: tokName, text: b.String(), quoted: true, pos: start})
+		case c >= '0' && c <= '9':
+			for pos < len(src) && (src[pos] >= '0' && src[pos] <= '9' || src[pos] == '.') {
+				pos++
+			}
+			toks = append(toks, token{kind: tokNumber, text: src[start:pos], pos: start})
+		case c == '_' || unicode.IsLetter(rune(c)):
+			for pos < len(src) && (src[pos] == '_' || unicode.IsLetter(rune(src[pos])) || unicode.IsDigit(rune(src[pos]))) {
+				pos++
+			}
+			kind := tokName
+			if c == '_' || unicode.IsUpper(rune(c)) {
+				kind = tokUpper
+			}
+			toks = append(toks, token{kind: kind, text: src[start:pos], pos: start})
+		default:
+			matched := false
+			for _, p := range formulaPunct {
+				if strings.HasPrefix(src[pos:], p) {
+					toks = append(toks, token{kind: tokPunct, text: p, pos: start})
+					pos += len(p)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q at offset %d", c, pos)
+			}
+		}
+	}
+}
+
+// formulaParser is a recursive descent parser over formula tokens. From
+// loosest to tightest: <->, -> (right associative), |, &, then the prefix
+// operators.
+type formulaParser struct {
+	toks []token
+	pos  int
+}
+
+func (p *formulaParser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *formulaParser) peekAt(n int) token {
+	if p.pos+n >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.pos+n]
+}
+
+func (p *formulaParser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of texts
+func (p *formulaParser) accept(texts ...string) bool {
+	for _, text := range texts {
+		if p.peek().is(text) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *formulaParser) expect(text string) error {
+	if !p.accept(text) {
+		return p.unexpected("expected " + text)
+	}
+	return nil
+}
+
+func (p *formulaParser) unexpected(context string) error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf("%s, got end of formula", context)
+	}
+	return fmt.Errorf("%s, got %q at offset %d", context, t.text, t.pos)
+}
+
+func binary(op string, a, b *Formula) *Formula {
+	return &Formula{Op: op, Args: []*Formula{a, b}}
+}
+
+func (p *formulaParser) iff() (*Formula, error) {
+	f, err := p.implies()
+	for err == nil && p.accept("<->", "<=>", "iff") {
+		var g *Formula
+		if g, err = p.implies(); err == nil {
+			f = binary("iff", f, g)
+		}
+	}
+	return f, err
+}
+
+func (p *formulaParser) implies() (*Formula, error) {
+	f, err := p.or()
+	if err != nil || !p.accept("->", "=>", "implies") {
+		return f, err
+	}
+	g, err := p.implies()
+	if err != nil {
+		return nil, err
+	}
+	return binary("implies", f, g), nil
+}
+
+func (p *formulaParser) or() (*Formula, error) {
+	f, err := p.and()
+	for err == nil && p.accept("|", "||", "or") {
+		var g *Formula
+		if g, err = p.and(); err == nil {
+			f = binary("or", f, g)
+		}
+	}
+	return f, err
+}
+
+func (p *formulaParser) and() (*Formula, error) {
+	f, err := p.unary()
+	for err == nil && p.accept("&", "&&", "and") {
+		var g *Formula
+		if g, err = p.unary(); err == nil {
+			f = binary("and", f, g)
+		}
+	}
+	return f, err
+}
+
+func (p *formulaParser) unary() (*Formula, error) {
+	t := p.peek()
+	switch {
+	case t.is("!") || t.is("~") || (t.is("not") && !p.peekAt(1).is("(")):
+		p.next()
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Formula{Op: "not", Args: []*Formula{f}}, nil
+	case t.kind == tokUpper && len(t.text) == 2 && strings.Contains("EA", t.text[:1]) && strings.Contains("XFG", t.text[1:]):
+		p.next()
+		op := strings.ToLower(t.text)
+		suffix, bound, err := p.bound()
+		if err != nil {
+			return nil, err
+		}
+		if suffix != "" {
+			if _, ok := formulaArity[op+suffix]; !ok {
+				return nil, fmt.Errorf("%s takes no bound at offset %d", t.text, t.pos)
+			}
+		}
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Formula{Op: op + suffix, Args: []*Formula{f}, Bound: bound}, nil
+	case (t.text == "E" || t.text == "A") && t.kind == tokUpper && p.peekAt(1).is("["):
+		return p.until()
+	}
+	return p.primary()
+}
+
+// bound parses an optional <=N step bound or within T time bound, and
+// returns the operator suffix it selects
+func (p *formulaParser) bound() (string, float64, error) {
+	switch {
+	case p.accept("<="):
+		t := p.next()
+		v, err := strconv.ParseFloat(t.text, 64)
+		if t.kind != tokNumber || err != nil || v != float64(int(v)) {
+			return "", 0, fmt.Errorf("expected a step count after <= at offset %d", t.pos)
+		}
+		return "_le", v, nil
+	case p.peek().is("within") && p.peekAt(1).kind == tokNumber:
+		p.next()
+		t := p.next()
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid time %q at offset %d", t.text, t.pos)
+		}
+		return "_within", v, nil
+	}
+	return "", 0, nil
+}
+
+// until parses E[p U q] and A[p U q], with W for weak until and R for
+// release
+func (p *formulaParser) until() (*Formula, error) {
+	quantifier := strings.ToLower(p.next().text)
+	p.next()
+	a, err := p.iff()
+	if err != nil {
+		return nil, err
+	}
+	t := p.next()
+	connective := map[string]string{"U": "u", "W": "w", "R": "r"}[t.text]
+	if t.kind != tokUpper || connective == "" {
+		p.pos--
+		return nil, p.unexpected("expected U, W or R")
+	}
+	op := quantifier + connective
+	suffix, bound, err := p.bound()
+	if err != nil {
+		return nil, err
+	}
+	if suffix != "" && connective != "u" {
+		return nil, fmt.Errorf("%s takes no bound at offset %d", t.text, t.pos)
+	}
+	b, err := p.iff()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	f := binary(op+suffix, a, b)
+	f.Bound = bound
+	return f, nil
+}
+
+func (p *formulaParser) primary() (*Formula, error) {
+	t := p.next()
+	switch {
+	case t.is("("):
+		f, err := p.iff()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	case t.kind == tokName && !t.quoted && p.peek().is("("):
+		return p.call(t)
+	case t.kind == tokName && !t.quoted && (t.text == "true" || t.text == "false"):
+		return &Formula{Op: t.text}, nil
+	case t.kind == tokName:
+		return &Formula{Op: "atom", Atom: t.text}, nil
+	case t.kind == tokUpper:
+		return &Formula{Op: "var", Atom: t.text}, nil
+	}
+	p.pos--
+	return nil, p.unexpected("expected a formula")
+}
+
+// call parses an operator in term syntax, whose formula arguments may
+// themselves use CTL notation
+func (p *formulaParser) call(name token) (*Formula, error) {
+	arity, ok := formulaArity[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown operator %s at offset %d", name.text, name.pos)
+	}
+	p.next()
+	f := &Formula{Op: name.text}
+	if name.text == "atom" {
+		t := p.next()
+		if t.kind != tokName && t.kind != tokNumber {
+			p.pos--
+			return nil, p.unexpected("atom expects a proposition name")
+		}
+		f.Atom = t.text
+		return f, p.expect(")")
+	}
+
+	first := ""
+	switch {
+	case stepBounded(f.Op) || timeBounded(f.Op):
+		t := p.next()
+		v, err := strconv.ParseFloat(t.text, 64)
+		if t.kind != tokNumber || err != nil || (stepBounded(f.Op) && v != float64(int(v))) {
+			if stepBounded(f.Op) {
+				return nil, fmt.Errorf("%s expects a non-negative step count, got %q", f.Op, t.text)
+			}
+			return nil, fmt.Errorf("%s expects a non-negative time, got %q", f.Op, t.text)
+		}
+		f.Bound = v
+		first = "bound"
+	case f.Op == "mu" || f.Op == "nu":
+		t := p.next()
+		if t.kind != tokUpper {
+			p.pos--
+			return nil, p.unexpected(f.Op + " expects a variable")
+		}
+		f.Atom = t.text
+		first = "variable"
+	case f.Op == "box" || f.Op == "diamond":
+		action, err := p.action()
+		if err != nil {
+			return nil, err
+		}
+		f.Action = action
+		first = "action"
+	}
+	if first != "" && !p.peek().is(",") {
+		return nil, fmt.Errorf("operator %s expects a %s and %d formula arguments", f.Op, first, arity)
+	}
+	if first == "" && p.accept(")") {
+		return nil, fmt.Errorf("operator %s expects %d arguments, got 0", f.Op, arity)
+	}
+	if first != "" {
+		p.next()
+	}
+
+	for {
+		arg, err := p.iff()
+		if err != nil {
+			return nil, err
+		}
+		f.Args = append(f.Args, arg)
+		if p.accept(")") {
+			break
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+	if len(f.Args) != arity {
+		return nil, fmt.Errorf("operator %s expects %d formula arguments, got %d", f.Op, arity, len(f.Args))
+	}
+	return f, nil
+}
+
+// action parses the label set of box or diamond: a label, a list of
+// labels, not(A), or any label as any or a variable
+func (p *formulaParser) action() (string, error) {
+	t := p.next()
+	switch {
+	case t.is("not") && p.peek().is("("):
+		p.next()
+		inner, err := p.action()
+		if err != nil {
+			return "", err
+		}
+		return "not(" + inner + ")", p.expect(")")
+	case t.is("["):
+		var labels []string
+		for {
+			l := p.next()
+			if l.kind != tokName {
+				p.pos--
+				return "", p.unexpected("expected a label")
+			}
+			labels = append(labels, prolog.QuoteAtom(l.text))
+			if p.accept("]") {
+				return "[" + strings.Join(labels, ", ") + "]", nil
+			}
+			if err := p.expect(","); err != nil {
+				return "", err
+			}
+		}
+	case t.kind == tokUpper:
+		return "any", nil
+	case t.kind == tokName:
+		return prolog.QuoteAtom(t.text), nil
+	}
+	p.pos--
+	return "", p.unexpected("expected an action")
+}
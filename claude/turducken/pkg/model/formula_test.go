@@ -0,0 +1,104 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFormulaNotation(t *testing.T) {
+	tests := []struct {
+		src      string
+		term     string
+		notation string
+	}{
+		{"AG(p -> EF q)", "ag(implies(atom(p), ef(atom(q))))", "AG (p -> EF q)"},
+		{"ag(implies(atom(p), ef(atom(q))))", "ag(implies(atom(p), ef(atom(q))))", "AG (p -> EF q)"},
+		{"!a & b | c", "or(and(not(atom(a)), atom(b)), atom(c))", "!a & b | c"},
+		{"a -> b -> c", "implies(atom(a), implies(atom(b), atom(c)))", "a -> b -> c"},
+		{"(a -> b) -> c", "implies(implies(atom(a), atom(b)), atom(c))", "(a -> b) -> c"},
+		{"a iff not b", "iff(atom(a), not(atom(b)))", "a <-> !b"},
+		{"a implies b and c", "implies(atom(a), and(atom(b), atom(c)))", "a -> b & c"},
+		{"E[a U b]", "eu(atom(a), atom(b))", "E[a U b]"},
+		{"A[a W b & c]", "aw(atom(a), and(atom(b), atom(c)))", "A[a W b & c]"},
+		{"E[a R b]", "er(atom(a), atom(b))", "E[a R b]"},
+		{"AF<=6 committed", "af_le(6, atom(committed))", "AF<=6 committed"},
+		{"E[!aborted U<=4 committed]", "eu_le(4, not(atom(aborted)), atom(committed))", "E[!aborted U<=4 committed]"},
+		{"AF within 2.5 done", "af_within(2.5, atom(done))", "AF within 2.5 done"},
+		{"ag(p & q)", "ag(and(atom(p), atom(q)))", "AG (p & q)"},
+		{"EF 'Done'", "ef(atom('Done'))", "EF 'Done'"},
+		{"nu(X, diamond(send, X) & ready)", "nu(X, and(diamond(send, X), atom(ready)))", "nu(X, diamond(send, X) & ready)"},
+		{"box([a, b], true)", "box([a, b], true)", "box([a, b], true)"},
+		{"diamond(not(tick), false)", "diamond(not(tick), false)", "diamond(not(tick), false)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			f, err := ParseFormula(tt.src)
+			if err != nil {
+				t.Fatalf("ParseFormula error: %v", err)
+			}
+			if got := f.String(); got != tt.term {
+				t.Errorf("String() = %s, want %s", got, tt.term)
+			}
+			if got := f.Notation(); got != tt.notation {
+				t.Errorf("Notation() = %s, want %s", got, tt.notation)
+			}
+			again, err := ParseFormula(f.Notation())
+			if err != nil || again.String() != f.String() {
+				t.Errorf("notation %q does not parse back: %v %v", f.Notation(), again, err)
+			}
+		})
+	}
+}
+
+func TestParseFormulaErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"ag(atom(x)), halt", "unexpected"},
+		{"AG (p", "expected )"},
+		{"p & ", "expected a formula"},
+		{"EX<=2 p", "takes no bound"},
+		{"E[p W<=2 q]", "takes no bound"},
+		{"E[p V q]", "expected U, W or R"},
+		{"ef_le(2.5, p)", "step count"},
+		{"atom(Done)", "proposition name"},
+		{"mu(X, not(diamond(any, X)))", "odd number of negations"},
+		{"ef(Y)", "not bound"},
+		{"'unterminated", "unterminated"},
+		{"p ; q", "unexpected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := ParseFormula(tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseFormula(%q) error = %v, want %q", tt.src, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAtoms(t *testing.T) {
+	sys := &System{
+		localStates: []string{"committed", "voting"},
+		props:       map[string][]string{"committed": {"decided"}},
+	}
+
+	for _, src := range []string{"AG (voting -> AF decided)", "EF committed"} {
+		f, _ := ParseFormula(src)
+		if err := sys.Validate(f); err != nil {
+			t.Errorf("Validate(%s) error: %v", src, err)
+		}
+	}
+
+	f, _ := ParseFormula("EF comitted")
+	if err := sys.Validate(f); err == nil || !strings.Contains(err.Error(), `did you mean "committed"`) {
+		t.Errorf("expected a suggestion for a typo, got %v", err)
+	}
+	f, _ = ParseFormula("EF shipped")
+	if err := sys.Validate(f); err == nil || strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("expected an unknown proposition without a suggestion, got %v", err)
+	}
+}
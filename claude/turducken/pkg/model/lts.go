@@ -0,0 +1,187 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultMaxStates bounds exploration of the global state space
+const DefaultMaxStates = 100000
+
+// ErrStateLimit is returned when the reachable state space exceeds the limit
+var ErrStateLimit = errors.New("state space limit exceeded")
+
+// Edge is a global transition. Fault describes any fault that occurred on
+// it, such as "lose(ch,msg)" or "crash(actor)", and is empty otherwise.
+type Edge struct {
+	Label string `json:"label"`
+	Actor string `json:"actor"`
+	To    int    `json:"to"`
+	Fault string `json:"fault,omitempty"`
+}
+
+// LTS is the reachable global state space of a system. State 0 is initial.
+type LTS struct {
+	System *System
+	States []State
+	Succ   [][]Edge
+
+	// parent links each state to the edge that first reached it, which
+	// breadth-first exploration makes a shortest path
+	parent []link
+}
+
+// link is an edge identified by its source state and index in Succ
+type link struct {
+	from int
+	edge int
+}
+
+// successor is a global state reached by a step, with the faults it suffered
+type successor struct {
+	label  string
+	actor  string
+	state  State
+	faults []string
+}
+
+// Explore builds the reachable state space breadth first, failing with
+// ErrStateLimit once more than maxStates states are found.
+func (sys *System) Explore(ctx context.Context, maxStates int) (*LTS, error) {
+	if maxStates <= 0 {
+		maxStates = DefaultMaxStates
+	}
+	initial := sys.Initial.Clone()
+	initial.Cut = make([]bool, len(sys.partitions))
+
+	lts := &LTS{System: sys, parent: []link{{from: -1}}}
+	index := map[string]int{initial.Key(): 0}
+	lts.States = append(lts.States, initial)
+	for i := 0; i < len(lts.States); i++ {
+		if i%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		var edges []Edge
+		for _, next := range sys.successors(lts.States[i]) {
+			key := next.state.Key()
+			to, ok := index[key]
+			if !ok {
+				if len(lts.States) >= maxStates {
+					return nil, fmt.Errorf("%w: more than %d states", ErrStateLimit, maxStates)
+				}
+				to = len(lts.States)
+				index[key] = to
+				lts.States = append(lts.States, next.state)
+				lts.parent = append(lts.parent, link{from: i, edge: len(edges)})
+			}
+			edges = append(edges, Edge{
+				Label: next.label,
+				Actor: next.actor,
+				To:    to,
+				Fault: strings.Join(next.faults, ","),
+			})
+		}
+		lts.Succ = append(lts.Succ, edges)
+	}
+	return lts, nil
+}
+
+// successors enumerates every global transition out of a state, including
+// the nondeterministic outcomes of channel faults, crashes and partitions.
+func (sys *System) successors(s State) []successor {
+	var out []successor
+	for actor, local := range s.Locals {
+		for _, st := range sys.steps[local] {
+			if !sys.Enabled(s, st, nil) {
+				continue
+			}
+			next := s.Clone()
+			sys.Receive(&next, st)
+			outcomes := []successor{{label: st.Label, actor: sys.Actors[actor], state: next}}
+			for _, op := range st.Sends {
+				var expanded []successor
+				for _, o := range outcomes {
+					expanded = append(expanded, sys.deliver(o, actor, op)...)
+				}
+				outcomes = expanded
+			}
+			out = append(out, outcomes...)
+		}
+	}
+
+	for _, c := range sys.crashes {
+		if s.Locals[c.Actor] == c.Recovery {
+			continue
+		}
+		next := s.Clone()
+		next.Locals[c.Actor] = c.Recovery
+		name := sys.Actors[c.Actor]
+		out = append(out, successor{
+			label:  "crash(" + name + ")",
+			actor:  name,
+			state:  next,
+			faults: []string{"crash(" + name + ")"},
+		})
+	}
+
+	for i, p := range sys.partitions {
+		next := s.Clone()
+		next.Cut[i] = !s.Cut[i]
+		label := "partition(" + p.name + ")"
+		if s.Cut[i] {
+			label = "heal(" + p.name + ")"
+		}
+		out = append(out, successor{label: label, state: next, faults: []string{label}})
+	}
+	return out
+}
+
+// deliver enqueues a sent message, branching on every fault the channel allows
+func (sys *System) deliver(o successor, sender int, op Op) []successor {
+	desc := fmt.Sprintf("(%s,%s)", sys.Channels[op.Channel], op.Msg)
+	with := func(state State, fault string) successor {
+		next := successor{label: o.label, actor: o.actor, state: state, faults: o.faults}
+		if fault != "" {
+			next.faults = append(append([]string(nil), o.faults...), fault+desc)
+		}
+		return next
+	}
+
+	if sys.Partitioned(o.state.Cut, sender, op.Channel) {
+		return []successor{with(o.state, "partitioned")}
+	}
+
+	var out []successor
+	queue := o.state.Chans[op.Channel]
+	if len(queue) < sys.Capacity[op.Channel] {
+		next := o.state.Clone()
+		next.Chans[op.Channel] = append(next.Chans[op.Channel], op.Msg)
+		out = append(out, with(next, ""))
+	}
+	f := sys.faults[op.Channel]
+	if _, lose := f[FaultLose]; lose {
+		out = append(out, with(o.state.Clone(), FaultLose))
+	}
+	if _, duplicate := f[FaultDuplicate]; duplicate && len(queue)+2 <= sys.Capacity[op.Channel] {
+		next := o.state.Clone()
+		next.Chans[op.Channel] = append(next.Chans[op.Channel], op.Msg, op.Msg)
+		out = append(out, with(next, FaultDuplicate))
+	}
+	if _, reorder := f[FaultReorder]; reorder && len(queue) < sys.Capacity[op.Channel] {
+		for pos := 0; pos < len(queue); pos++ {
+			if queue[pos] == op.Msg {
+				continue
+			}
+			next := o.state.Clone()
+			reordered := append([]string(nil), queue[:pos]...)
+			reordered = append(reordered, op.Msg)
+			next.Chans[op.Channel] = append(reordered, queue[pos:]...)
+			out = append(out, with(next, FaultReorder))
+		}
+	}
+	return out
+}
@@ -0,0 +1,279 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+// MaxVia bounds the labels a path query may require, since the search
+// tracks which of them a path has fired
+const MaxVia = 12
+
+// Graph is a labelled graph that paths are searched over: either the
+// transition/3 state machine or the composed global state space
+type Graph struct {
+	Nodes   []string
+	Succ    [][]Edge
+	Initial []int
+
+	holds func(i int, atom string) bool
+}
+
+// Holds reports whether a node is named atom or satisfies it as a prop. In
+// the composed model it holds when it holds for any actor.
+func (g *Graph) Holds(i int, atom string) bool {
+	return g.holds(i, atom)
+}
+
+// Graph returns the global state space as a path graph
+func (lts *LTS) Graph() *Graph {
+	g := &Graph{Succ: lts.Succ, Initial: []int{0}}
+	for _, s := range lts.States {
+		g.Nodes = append(g.Nodes, s.String())
+	}
+	g.holds = func(i int, atom string) bool {
+		return lts.System.Holds(lts.States[i], atom)
+	}
+	return g
+}
+
+// TransitionGraph returns the transition/3 state machine as a path graph,
+// with props from prop/2
+func TransitionGraph(sm *prolog.StateMachine, props map[string][]string) *Graph {
+	g := &Graph{}
+	index := make(map[string]int)
+	node := func(name string) int {
+		if i, ok := index[name]; ok {
+			return i
+		}
+		index[name] = len(g.Nodes)
+		g.Nodes = append(g.Nodes, name)
+		g.Succ = append(g.Succ, nil)
+		return index[name]
+	}
+	for _, s := range sm.States {
+		node(s)
+	}
+	for _, s := range sm.Initial {
+		g.Initial = append(g.Initial, node(s))
+	}
+	for _, t := range sm.Transitions {
+		from, to := node(t.From), node(t.To)
+		g.Succ[from] = append(g.Succ[from], Edge{Label: t.Label, To: to})
+	}
+	g.holds = func(i int, atom string) bool {
+		if g.Nodes[i] == atom {
+			return true
+		}
+		for _, p := range props[g.Nodes[i]] {
+			if p == atom {
+				return true
+			}
+		}
+		return false
+	}
+	return g
+}
+
+// PathQuery selects paths from any of Sources to a node marked in Target.
+// Paths never enter a node marked in Avoid, which may be nil, and fire
+// every label in Via. K asks for the K shortest loopless paths.
+type PathQuery struct {
+	Sources []int
+	Target  []bool
+	Avoid   []bool
+	Via     []string
+	K       int
+}
+
+// Paths returns up to K shortest paths, shortest first, using Yen's
+// algorithm over nodes paired with the Via labels fired so far
+func (g *Graph) Paths(q PathQuery) ([][]TraceStep, error) {
+	if len(q.Via) > MaxVia {
+		return nil, fmt.Errorf("at most %d via labels are supported", MaxVia)
+	}
+	if q.K <= 0 {
+		q.K = 1
+	}
+	s := &pathSearch{g: g, q: q, full: 1<<len(q.Via) - 1}
+
+	var found []pathWalk
+	for _, src := range q.Sources {
+		if q.Avoid != nil && q.Avoid[src] {
+			continue
+		}
+		found = append(found, s.yen(src)...)
+	}
+	sort.SliceStable(found, func(i, j int) bool { return len(found[i].edges) < len(found[j].edges) })
+	if len(found) > q.K {
+		found = found[:q.K]
+	}
+
+	paths := make([][]TraceStep, 0, len(found))
+	for _, w := range found {
+		steps := make([]TraceStep, 0, len(w.edges))
+		for i, j := range w.edges {
+			from := w.nodes[i] >> len(q.Via)
+			e := g.Succ[from][j]
+			steps = append(steps, TraceStep{
+				From:  g.Nodes[from],
+				Label: e.Label,
+				Actor: e.Actor,
+				To:    g.Nodes[e.To],
+				Fault: e.Fault,
+			})
+		}
+		paths = append(paths, steps)
+	}
+	return paths, nil
+}
+
+// pathWalk is a path through product nodes, which pack a graph node with
+// the set of Via labels fired so far as node<<len(Via) | mask. edges[i] is
+// the index in Succ of the edge leaving nodes[i].
+type pathWalk struct {
+	nodes []int
+	edges []int
+}
+
+func (w pathWalk) key() string {
+	var b strings.Builder
+	for i, n := range w.nodes {
+		fmt.Fprintf(&b, "%d", n)
+		if i < len(w.edges) {
+			fmt.Fprintf(&b, ":%d,", w.edges[i])
+		}
+	}
+	return b.String()
+}
+
+type pathSearch struct {
+	g    *Graph
+	q    PathQuery
+	full int
+}
+
+// next returns the product node reached by an edge
+func (s *pathSearch) next(p, j int) int {
+	bits := len(s.q.Via)
+	e := s.g.Succ[p>>bits][j]
+	mask := p & s.full
+	for i, label := range s.q.Via {
+		if e.Label == label {
+			mask |= 1 << i
+		}
+	}
+	return e.To<<bits | mask
+}
+
+func (s *pathSearch) target(p int) bool {
+	return p&s.full == s.full && s.q.Target[p>>len(s.q.Via)]
+}
+
+// shortest runs a breadth-first search from a product node, skipping
+// removed nodes and edges
+func (s *pathSearch) shortest(start int, removedNodes map[int]bool, removedEdges map[[2]int]bool) (pathWalk, bool) {
+	type link struct{ from, edge int }
+	parent := map[int]link{start: {from: -1}}
+	queue := []int{start}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if s.target(p) {
+			var w pathWalk
+			for n := p; n != start; n = parent[n].from {
+				w.nodes = append(w.nodes, n)
+				w.edges = append(w.edges, parent[n].edge)
+			}
+			w.nodes = append(w.nodes, start)
+			reverseInts(w.nodes)
+			reverseInts(w.edges)
+			return w, true
+		}
+		for j, e := range s.g.Succ[p>>len(s.q.Via)] {
+			if removedEdges[[2]int{p, j}] || (s.q.Avoid != nil && s.q.Avoid[e.To]) {
+				continue
+			}
+			n := s.next(p, j)
+			if _, seen := parent[n]; seen || removedNodes[n] {
+				continue
+			}
+			parent[n] = link{from: p, edge: j}
+			queue = append(queue, n)
+		}
+	}
+	return pathWalk{}, false
+}
+
+// yen returns the K shortest loopless paths from one source
+func (s *pathSearch) yen(src int) []pathWalk {
+	first, ok := s.shortest(src<<len(s.q.Via), nil, nil)
+	if !ok {
+		return nil
+	}
+	accepted := []pathWalk{first}
+	seen := map[string]bool{first.key(): true}
+	var candidates []pathWalk
+
+	for len(accepted) < s.q.K {
+		prev := accepted[len(accepted)-1]
+		for i := 0; i < len(prev.edges); i++ {
+			spur := prev.nodes[i]
+			removedEdges := make(map[[2]int]bool)
+			for _, w := range accepted {
+				if len(w.edges) > i && equalInts(w.nodes[:i+1], prev.nodes[:i+1]) && equalInts(w.edges[:i], prev.edges[:i]) {
+					removedEdges[[2]int{spur, w.edges[i]}] = true
+				}
+			}
+			removedNodes := make(map[int]bool, i)
+			for _, n := range prev.nodes[:i] {
+				removedNodes[n] = true
+			}
+			tail, ok := s.shortest(spur, removedNodes, removedEdges)
+			if !ok {
+				continue
+			}
+			w := pathWalk{
+				nodes: append(append([]int(nil), prev.nodes[:i]...), tail.nodes...),
+				edges: append(append([]int(nil), prev.edges[:i]...), tail.edges...),
+			}
+			if k := w.key(); !seen[k] {
+				seen[k] = true
+				candidates = append(candidates, w)
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
+		best := 0
+		for i, w := range candidates {
+			if len(w.edges) < len(candidates[best].edges) {
+				best = i
+			}
+		}
+		accepted = append(accepted, candidates[best])
+		candidates = append(candidates[:best], candidates[best+1:]...)
+	}
+	return accepted
+}
+
+func reverseInts(v []int) {
+	for a, b := 0, len(v)-1; a < b; a, b = a+1, b-1 {
+		v[a], v[b] = v[b], v[a]
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
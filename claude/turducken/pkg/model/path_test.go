@@ -0,0 +1,94 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+// commitMachine can abort directly, or after a vote, or after a timeout
+var commitMachine = &prolog.StateMachine{
+	States:  []string{"init", "voting", "waiting", "aborted", "committed"},
+	Initial: []string{"init"},
+	Transitions: []prolog.Transition{
+		{From: "init", Label: "abort", To: "aborted"},
+		{From: "init", Label: "prepare", To: "voting"},
+		{From: "voting", Label: "no", To: "aborted"},
+		{From: "voting", Label: "yes", To: "committed"},
+		{From: "voting", Label: "wait", To: "waiting"},
+		{From: "waiting", Label: "timeout", To: "aborted"},
+	},
+}
+
+func labels(path []TraceStep) string {
+	s := ""
+	for i, st := range path {
+		if i > 0 {
+			s += ","
+		}
+		s += st.Label
+	}
+	return s
+}
+
+func query(g *Graph, to string) PathQuery {
+	q := PathQuery{Sources: g.Initial, Target: make([]bool, len(g.Nodes))}
+	for i := range g.Nodes {
+		q.Target[i] = g.Holds(i, to)
+	}
+	return q
+}
+
+func TestShortestAndKShortestPaths(t *testing.T) {
+	g := TransitionGraph(commitMachine, map[string][]string{"aborted": {"done"}})
+
+	q := query(g, "done")
+	paths, err := g.Paths(q)
+	if err != nil || len(paths) != 1 || labels(paths[0]) != "abort" {
+		t.Fatalf("expected the direct abort, got %v (%v)", paths, err)
+	}
+
+	q.K = 5
+	paths, _ = g.Paths(q)
+	var got []string
+	for _, p := range paths {
+		got = append(got, labels(p))
+	}
+	want := []string{"abort", "prepare,no", "prepare,wait,timeout"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("path %d: expected %s, got %s", i, want[i], got[i])
+		}
+	}
+}
+
+func TestPathConstraints(t *testing.T) {
+	g := TransitionGraph(commitMachine, nil)
+
+	q := query(g, "aborted")
+	q.Via = []string{"wait"}
+	paths, _ := g.Paths(q)
+	if len(paths) != 1 || labels(paths[0]) != "prepare,wait,timeout" {
+		t.Errorf("expected the path through wait, got %v", paths)
+	}
+
+	q = query(g, "aborted")
+	q.Avoid = make([]bool, len(g.Nodes))
+	for i := range g.Nodes {
+		q.Avoid[i] = g.Holds(i, "voting")
+	}
+	q.K = 3
+	paths, _ = g.Paths(q)
+	if len(paths) != 1 || labels(paths[0]) != "abort" {
+		t.Errorf("expected only the path avoiding voting, got %v", paths)
+	}
+
+	q = query(g, "committed")
+	q.Via = []string{"timeout"}
+	if paths, _ := g.Paths(q); len(paths) != 0 {
+		t.Errorf("expected no path that times out and then commits, got %v", paths)
+	}
+}
@@ -0,0 +1,106 @@
+package model
+
+// Components returns the strongly connected components of a graph given by
+// its successor lists, restricted to the states marked inside and the edges
+// accepted by follow; nil for either means all of them. It uses an
+// iterative Tarjan's algorithm, so components come out in reverse
+// topological order: every edge between components leads to an earlier one.
+func Components(succ [][]Edge, inside []bool, follow func(Edge) bool) [][]int {
+	n := len(succ)
+	in := func(v int) bool { return inside == nil || inside[v] }
+	ok := func(e Edge) bool { return follow == nil || follow(e) }
+
+	index := make([]int, n)
+	low := make([]int, n)
+	onStack := make([]bool, n)
+	for i := range index {
+		index[i] = -1
+	}
+	var stack []int
+	var out [][]int
+	next := 0
+
+	type frame struct{ v, edge int }
+	for root := 0; root < n; root++ {
+		if !in(root) || index[root] >= 0 {
+			continue
+		}
+		calls := []frame{{v: root}}
+		index[root], low[root] = next, next
+		next++
+		stack = append(stack, root)
+		onStack[root] = true
+		for len(calls) > 0 {
+			f := &calls[len(calls)-1]
+			if f.edge < len(succ[f.v]) {
+				e := succ[f.v][f.edge]
+				f.edge++
+				w := e.To
+				if !in(w) || !ok(e) {
+					continue
+				}
+				if index[w] < 0 {
+					index[w], low[w] = next, next
+					next++
+					stack = append(stack, w)
+					onStack[w] = true
+					calls = append(calls, frame{v: w})
+				} else if onStack[w] && index[w] < low[f.v] {
+					low[f.v] = index[w]
+				}
+				continue
+			}
+			v := f.v
+			calls = calls[:len(calls)-1]
+			if len(calls) > 0 {
+				if u := calls[len(calls)-1].v; low[v] < low[u] {
+					low[u] = low[v]
+				}
+			}
+			if low[v] != index[v] {
+				continue
+			}
+			var scc []int
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				scc = append(scc, w)
+				if w == v {
+					break
+				}
+			}
+			out = append(out, scc)
+		}
+	}
+	return out
+}
+
+// Cyclic reports whether a component contains a cycle: it has more than
+// one state, or its state has a followed self loop
+func Cyclic(succ [][]Edge, scc []int, follow func(Edge) bool) bool {
+	if len(scc) > 1 {
+		return true
+	}
+	v := scc[0]
+	for _, e := range succ[v] {
+		if e.To == v && (follow == nil || follow(e)) {
+			return true
+		}
+	}
+	return false
+}
+
+// componentIndex maps each state to the index of its component, or -1
+func componentIndex(n int, sccs [][]int) []int {
+	comp := make([]int, n)
+	for i := range comp {
+		comp[i] = -1
+	}
+	for c, scc := range sccs {
+		for _, v := range scc {
+			comp[v] = c
+		}
+	}
+	return comp
+}
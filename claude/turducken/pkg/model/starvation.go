@@ -0,0 +1,326 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Fairness is the scheduling assumption under which starvation is checked
+type Fairness string
+
+// Fairness assumptions accepted by LTS.Starvation
+const (
+	// FairnessNone lets the scheduler ignore any actor forever
+	FairnessNone Fairness = "none"
+	// FairnessWeak requires a transition that stays enabled to fire eventually
+	FairnessWeak Fairness = "weak"
+	// FairnessStrong requires a transition enabled infinitely often to fire
+	// eventually
+	FairnessStrong Fairness = "strong"
+)
+
+// ParseFairness reads a fairness name, defaulting to weak
+func ParseFairness(name string) (Fairness, error) {
+	switch f := Fairness(name); f {
+	case "":
+		return FairnessWeak, nil
+	case FairnessNone, FairnessWeak, FairnessStrong:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown fairness %q (expected %s, %s or %s)", name, FairnessNone, FairnessWeak, FairnessStrong)
+}
+
+// Starvation is a lasso in which an actor never makes progress again:
+// Trace reaches Entry, and Cycle returns to it forever. States are the
+// strongly connected states the cycle may wander through.
+type Starvation struct {
+	Actor  string
+	States []int
+	Entry  int
+	Trace  []TraceStep
+	Cycle  []TraceStep
+}
+
+// ProgressOf returns the labels and states that count as progress for an
+// actor: its step labels and target states marked by progress/1. When it
+// has none, every step of the actor counts.
+func (sys *System) ProgressOf(actor int) []string {
+	seen := make(map[string]bool)
+	for _, steps := range sys.steps {
+		for _, st := range steps {
+			if st.Actor != actor {
+				continue
+			}
+			for _, name := range []string{st.Label, st.To} {
+				if sys.progress[name] {
+					seen[name] = true
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Starvation looks for a lasso, fair under the given assumption, along
+// which an actor never again fires a progress step nor rests in an
+// accepting or progress state. It returns nil when the actor can always
+// make progress. Deadlocks are left to Deadlocks.
+func (lts *LTS) Starvation(actor int, fairness Fairness) *Starvation {
+	sys := lts.System
+	name := sys.Actors[actor]
+	anyStep := len(sys.ProgressOf(actor)) == 0
+
+	inside := make([]bool, len(lts.States))
+	for i, s := range lts.States {
+		local := s.Locals[actor]
+		inside[i] = !sys.accepting[local] && !sys.progress[local]
+	}
+	follow := func(e Edge) bool {
+		if e.Environment() {
+			return false
+		}
+		if e.Actor != name {
+			return true
+		}
+		return !anyStep && !sys.progress[e.Label]
+	}
+
+	f := fairnessCheck{lts: lts, follow: follow, enabled: make(map[int][]string)}
+	candidates := lts.components(inside, follow)
+	var best *Starvation
+	for len(candidates) > 0 {
+		scc := candidates[0]
+		candidates = candidates[1:]
+		sort.Ints(scc)
+
+		required, visit, drop := f.check(scc, fairness)
+		if drop != nil {
+			// Strong fairness: states where an untaken transition is
+			// enabled cannot be visited infinitely often
+			mask := make([]bool, len(lts.States))
+			for _, i := range scc {
+				mask[i] = !drop[i]
+			}
+			candidates = append(candidates, lts.components(mask, follow)...)
+			continue
+		}
+		if required == nil {
+			continue
+		}
+
+		entry := scc[0]
+		if best != nil && best.Entry <= entry {
+			continue
+		}
+		best = &Starvation{
+			Actor:  name,
+			States: scc,
+			Entry:  entry,
+			Trace:  lts.Trace(entry),
+			Cycle:  lts.tour(entry, scc, follow, required, visit),
+		}
+	}
+	return best
+}
+
+// fairnessCheck decides whether a strongly connected set of states admits
+// a fair cycle, caching the transitions enabled in each state
+type fairnessCheck struct {
+	lts     *LTS
+	follow  func(Edge) bool
+	enabled map[int][]string
+}
+
+// stepKey identifies a local transition of an actor
+func stepKey(actor int, from, label, to string) string {
+	return fmt.Sprintf("%d|%s|%s|%s", actor, from, label, to)
+}
+
+// enabledIn returns the local transitions enabled in a global state
+func (f *fairnessCheck) enabledIn(i int) []string {
+	if keys, ok := f.enabled[i]; ok {
+		return keys
+	}
+	sys := f.lts.System
+	s := f.lts.States[i]
+	keys := []string{}
+	for a, local := range s.Locals {
+		for _, st := range sys.steps[local] {
+			if st.Actor == a && sys.Enabled(s, st, nil) {
+				keys = append(keys, stepKey(a, st.From, st.Label, st.To))
+			}
+		}
+	}
+	f.enabled[i] = keys
+	return keys
+}
+
+// check returns, for a fair set of states, an edge taking each transition
+// the fairness assumption requires, which is non-nil even when empty, and
+// under weak fairness a state disabling each transition enabled in only
+// some of the states. For an unfair set it returns nil, plus under strong
+// fairness the states to drop before looking again.
+func (f *fairnessCheck) check(scc []int, fairness Fairness) ([]link, []int, map[int]bool) {
+	member := make(map[int]bool, len(scc))
+	for _, i := range scc {
+		member[i] = true
+	}
+	taken := make(map[string]link)
+	for _, i := range scc {
+		for j, e := range f.lts.Succ[i] {
+			if !member[e.To] || !f.follow(e) {
+				continue
+			}
+			a, _ := f.lts.System.ActorIndex(e.Actor)
+			key := stepKey(a, f.lts.States[i].Locals[a], e.Label, f.lts.States[e.To].Locals[a])
+			if _, ok := taken[key]; !ok {
+				taken[key] = link{from: i, edge: j}
+			}
+		}
+	}
+	if fairness == FairnessNone {
+		return []link{}, nil, nil
+	}
+
+	count := make(map[string]int)
+	for _, i := range scc {
+		for _, key := range f.enabledIn(i) {
+			count[key]++
+		}
+	}
+	keys := make([]string, 0, len(count))
+	for key := range count {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	required := []link{}
+	var visit []int
+	visiting := make(map[int]bool)
+	var untaken map[string]bool
+	for _, key := range keys {
+		if fairness == FairnessWeak && count[key] < len(scc) {
+			// Passing through a state where it is disabled is enough
+			if i := f.disabledIn(scc, key); !visiting[i] {
+				visiting[i] = true
+				visit = append(visit, i)
+			}
+			continue
+		}
+		l, ok := taken[key]
+		if ok {
+			required = append(required, l)
+			continue
+		}
+		if fairness == FairnessWeak {
+			return nil, nil, nil
+		}
+		if untaken == nil {
+			untaken = make(map[string]bool)
+		}
+		untaken[key] = true
+	}
+	if untaken == nil {
+		return required, visit, nil
+	}
+	drop := make(map[int]bool)
+	for _, i := range scc {
+		for _, key := range f.enabledIn(i) {
+			if untaken[key] {
+				drop[i] = true
+			}
+		}
+	}
+	return nil, nil, drop
+}
+
+// disabledIn returns the first of a set of states in which a local
+// transition is not enabled, or -1 when it is enabled in all of them
+func (f *fairnessCheck) disabledIn(states []int, key string) int {
+	for _, i := range states {
+		enabled := false
+		for _, k := range f.enabledIn(i) {
+			if k == key {
+				enabled = true
+				break
+			}
+		}
+		if !enabled {
+			return i
+		}
+	}
+	return -1
+}
+
+// tour returns a cycle from entry through a set of states that takes every
+// required edge and passes through every state in visit, or the shortest
+// cycle when nothing is required
+func (lts *LTS) tour(entry int, states []int, follow func(Edge) bool, required []link, visit []int) []TraceStep {
+	if len(required) == 0 && len(visit) == 0 {
+		return lts.cycle(entry, states, follow)
+	}
+	member := make(map[int]bool, len(states))
+	for _, i := range states {
+		member[i] = true
+	}
+	var steps []TraceStep
+	at := entry
+	for _, l := range required {
+		steps = append(steps, lts.pathWithin(at, l.from, member, follow)...)
+		e := lts.Succ[l.from][l.edge]
+		steps = append(steps, lts.traceStep(l.from, e))
+		at = e.To
+	}
+	for _, i := range visit {
+		steps = append(steps, lts.pathWithin(at, i, member, follow)...)
+		at = i
+	}
+	steps = append(steps, lts.pathWithin(at, entry, member, follow)...)
+	if len(steps) == 0 {
+		// Only entry itself had to be visited
+		return lts.cycle(entry, states, follow)
+	}
+	return steps
+}
+
+// pathWithin returns the shortest path between two states of a set
+func (lts *LTS) pathWithin(from, to int, member map[int]bool, follow func(Edge) bool) []TraceStep {
+	if from == to {
+		return nil
+	}
+	parent := map[int]link{from: {from: -1}}
+	queue := []int{from}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for j, e := range lts.Succ[i] {
+			if !follow(e) || !member[e.To] {
+				continue
+			}
+			if _, seen := parent[e.To]; seen {
+				continue
+			}
+			parent[e.To] = link{from: i, edge: j}
+			if e.To != to {
+				queue = append(queue, e.To)
+				continue
+			}
+			var rev []TraceStep
+			for k := to; k != from; {
+				l := parent[k]
+				rev = append(rev, lts.traceStep(l.from, lts.Succ[l.from][l.edge]))
+				k = l.from
+			}
+			for a, b := 0, len(rev)-1; a < b; a, b = a+1, b-1 {
+				rev[a], rev[b] = rev[b], rev[a]
+			}
+			return rev
+		}
+	}
+	return nil
+}
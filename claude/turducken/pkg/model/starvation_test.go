@@ -0,0 +1,99 @@
+package model
+
+import "testing"
+
+// storeSpec only serves a waiting customer from store_open, and may keep
+// rotating stock instead, so serving is enabled infinitely often but not
+// continuously
+const storeSpec = `
+        actor_initial(customer, cust_waiting).
+        actor_initial(store, store_open).
+        actor_transition(customer, cust_waiting, get_served, cust_waiting).
+        actor_transition(store, store_open, serve, store_open).
+        actor_transition(store, store_open, rotate, store_rotating).
+        actor_transition(store, store_rotating, finish, store_open).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        progress(get_served).
+        channel(counter, 1).
+        send(counter, ticket, store_open, store_open).
+        recv(counter, ticket, cust_waiting, cust_waiting).
+    `
+
+func TestStarvationDependsOnFairness(t *testing.T) {
+	lts := explore(t, storeSpec)
+	customer, _ := lts.System.ActorIndex("customer")
+	store, _ := lts.System.ActorIndex("store")
+
+	if got := lts.System.ProgressOf(customer); len(got) != 1 || got[0] != "get_served" {
+		t.Errorf("expected get_served as the customer's progress, got %v", got)
+	}
+
+	for _, fairness := range []Fairness{FairnessNone, FairnessWeak} {
+		s := lts.Starvation(customer, fairness)
+		if s == nil {
+			t.Fatalf("expected the customer to starve under %s fairness", fairness)
+		}
+		if s.Entry != 0 || len(s.Trace) != 0 || len(s.Cycle) == 0 {
+			t.Errorf("expected a lasso from the initial state under %s fairness, got %+v", fairness, s)
+		}
+		for _, st := range s.Cycle {
+			if st.Label == "get_served" || st.Label == "serve" {
+				t.Errorf("expected the %s cycle to only rotate stock, got %+v", fairness, s.Cycle)
+			}
+		}
+	}
+	if s := lts.Starvation(customer, FairnessStrong); s != nil {
+		t.Errorf("expected strong fairness to force serving, got %+v", s)
+	}
+	if s := lts.Starvation(store, FairnessNone); s != nil {
+		t.Errorf("expected the store to always make progress, got %+v", s)
+	}
+}
+
+// racerSpec lets p loop on a and b without ever winning while q loops on
+// x and y, so x and y are each enabled in only some of the loop's states
+const racerSpec = `
+        actor_initial(p, p0).
+        actor_initial(q, q0).
+        actor_transition(p, p0, a, p1).
+        actor_transition(p, p1, b, p0).
+        actor_transition(p, p1, win, pdone).
+        actor_transition(q, q0, x, q1).
+        actor_transition(q, q1, y, q0).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        progress(win).
+        accepting(pdone).
+    `
+
+func TestWeakFairStarvationCycleLeavesNoTransitionEnabled(t *testing.T) {
+	lts := explore(t, racerSpec)
+	p, _ := lts.System.ActorIndex("p")
+
+	s := lts.Starvation(p, FairnessWeak)
+	if s == nil {
+		t.Fatalf("expected p to starve under weak fairness")
+	}
+	// A weakly fair cycle passes through a state where x is disabled, so q
+	// must move along with p rather than wait in q0 with x enabled
+	labels := make(map[string]bool)
+	for _, st := range s.Cycle {
+		labels[st.Label] = true
+	}
+	if !labels["x"] || !labels["y"] || labels["win"] {
+		t.Errorf("expected the cycle to take x and y but not win, got %+v", s.Cycle)
+	}
+	if s := lts.Starvation(p, FairnessStrong); s != nil {
+		t.Errorf("expected strong fairness to force win, got %+v", s)
+	}
+}
+
+func TestParseFairness(t *testing.T) {
+	if f, err := ParseFairness(""); err != nil || f != FairnessWeak {
+		t.Errorf("expected weak by default, got %q (%v)", f, err)
+	}
+	if _, err := ParseFairness("eventual"); err == nil {
+		t.Errorf("expected an error for an unknown fairness")
+	}
+}
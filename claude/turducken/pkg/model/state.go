@@ -0,0 +1,138 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+)
+
+// State is a global state: the local state of every actor, the messages
+// buffered on every channel, and which partitions are active.
+type State struct {
+	Locals []string
+	Chans  [][]string
+	Cut    []bool
+}
+
+// Key returns a string that identifies the state
+func (s State) Key() string {
+	var b strings.Builder
+	for _, l := range s.Locals {
+		b.WriteString(l)
+		b.WriteByte(',')
+	}
+	for _, ch := range s.Chans {
+		b.WriteByte('|')
+		b.WriteString(strconv.Itoa(len(ch)))
+		for _, m := range ch {
+			b.WriteByte(':')
+			b.WriteString(m)
+		}
+	}
+	for _, c := range s.Cut {
+		if c {
+			b.WriteString("|x")
+		} else {
+			b.WriteString("|-")
+		}
+	}
+	return b.String()
+}
+
+// Clone returns a deep copy of the state
+func (s State) Clone() State {
+	c := State{
+		Locals: append([]string(nil), s.Locals...),
+		Chans:  make([][]string, len(s.Chans)),
+		Cut:    append([]bool(nil), s.Cut...),
+	}
+	for i, ch := range s.Chans {
+		c.Chans[i] = append([]string(nil), ch...)
+	}
+	return c
+}
+
+// String renders the state for traces and reports
+func (s State) String() string {
+	parts := append([]string(nil), s.Locals...)
+	for i, ch := range s.Chans {
+		if len(ch) > 0 {
+			parts = append(parts, strconv.Itoa(i)+":["+strings.Join(ch, ",")+"]")
+		}
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// Enabled reports whether a step can fire: the actor is in the step's
+// source state, every message it receives is at the head of its channel,
+// and every channel it sends on has room. pending counts buffer slots
+// already reserved by sends in flight and may be nil.
+func (sys *System) Enabled(s State, st *Step, pending []int) bool {
+	if s.Locals[st.Actor] != st.From {
+		return false
+	}
+	recvs, sends := sys.Blocking(s, st, pending)
+	return len(recvs) == 0 && len(sends) == 0
+}
+
+// Blocking returns the channels holding up a step whose actor is in its
+// source state: those where a message it receives is not at the head, and
+// those where a message it sends has no room. Both are empty when the step
+// is enabled.
+func (sys *System) Blocking(s State, st *Step, pending []int) (recvs, sends []int) {
+	consumed := make(map[int]int)
+	for _, op := range st.Recvs {
+		ch := s.Chans[op.Channel]
+		pos := consumed[op.Channel]
+		if pos >= len(ch) || ch[pos] != op.Msg {
+			recvs = append(recvs, op.Channel)
+			continue
+		}
+		consumed[op.Channel]++
+	}
+	room := make(map[int]int)
+	for _, op := range st.Sends {
+		if sys.Partitioned(s.Cut, st.Actor, op.Channel) {
+			continue
+		}
+		used := len(s.Chans[op.Channel]) - consumed[op.Channel] + room[op.Channel]
+		if pending != nil {
+			used += pending[op.Channel]
+		}
+		if used >= sys.Capacity[op.Channel] {
+			sends = append(sends, op.Channel)
+			continue
+		}
+		room[op.Channel]++
+	}
+	return recvs, sends
+}
+
+// Receive consumes the step's messages and moves the actor to its target
+// state. The step must be enabled.
+func (sys *System) Receive(s *State, st *Step) {
+	for _, op := range st.Recvs {
+		s.Chans[op.Channel] = s.Chans[op.Channel][1:]
+	}
+	s.Locals[st.Actor] = st.To
+}
+
+// HasRoom reports whether a channel can buffer another message
+func (sys *System) HasRoom(s State, ch int) bool {
+	return len(s.Chans[ch]) < sys.Capacity[ch]
+}
+
+// Holds reports whether an atomic proposition holds in a global state:
+// some actor is in a state with that prop/2, or in a state of that name.
+func (sys *System) Holds(s State, atom string) bool {
+	for _, local := range s.Locals {
+		if local == atom {
+			return true
+		}
+		for _, p := range sys.props[local] {
+			if p == atom {
+				return true
+			}
+		}
+	}
+	return false
+}
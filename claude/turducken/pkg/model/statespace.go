@@ -0,0 +1,197 @@
+package model
+
+import "sort"
+
+// MaxDiameterStates bounds the state spaces whose diameter is computed,
+// since that takes a breadth-first search from every state
+const MaxDiameterStates = 5000
+
+// StateSpace summarizes the reachable part of a graph
+type StateSpace struct {
+	States      int `json:"states"`
+	Transitions int `json:"transitions"`
+	// Terminal counts states with no outgoing transition
+	Terminal int `json:"terminal"`
+	// Depth is the longest shortest path from an initial state
+	Depth int `json:"depth"`
+	// Diameter is the longest shortest path between any two states, left
+	// out above MaxDiameterStates
+	Diameter      *int    `json:"diameter,omitempty"`
+	MeanBranching float64 `json:"meanBranching"`
+	MaxBranching  int     `json:"maxBranching"`
+
+	// Components are the strongly connected components in topological
+	// order: edges only lead to components with a higher ID
+	Components []Component `json:"components"`
+	Cyclic     int         `json:"cyclic"`
+	Bottom     int         `json:"bottom"`
+	Largest    int         `json:"largest"`
+}
+
+// Component is a strongly connected component. A bottom component has no
+// transition leaving it, so a run that enters it stays forever.
+type Component struct {
+	ID     int             `json:"id"`
+	States []int           `json:"-"`
+	Cyclic bool            `json:"cyclic"`
+	Bottom bool            `json:"bottom"`
+	Out    []ComponentEdge `json:"out"`
+}
+
+// ComponentEdge joins two components, with the labels of the transitions
+// between them
+type ComponentEdge struct {
+	To     int      `json:"to"`
+	Labels []string `json:"labels"`
+}
+
+// Reachable marks the nodes reachable from the initial nodes
+func (g *Graph) Reachable() []bool {
+	seen := make([]bool, len(g.Nodes))
+	var work []int
+	for _, i := range g.Initial {
+		if !seen[i] {
+			seen[i] = true
+			work = append(work, i)
+		}
+	}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, e := range g.Succ[i] {
+			if !seen[e.To] {
+				seen[e.To] = true
+				work = append(work, e.To)
+			}
+		}
+	}
+	return seen
+}
+
+// Analyze computes statistics and the component structure of the states
+// reachable from the initial nodes
+func (g *Graph) Analyze() *StateSpace {
+	reach := g.Reachable()
+	ss := &StateSpace{Components: []Component{}}
+	for i, ok := range reach {
+		if !ok {
+			continue
+		}
+		ss.States++
+		out := len(g.Succ[i])
+		ss.Transitions += out
+		if out == 0 {
+			ss.Terminal++
+		}
+		if out > ss.MaxBranching {
+			ss.MaxBranching = out
+		}
+	}
+	if ss.States > 0 {
+		ss.MeanBranching = float64(ss.Transitions) / float64(ss.States)
+	}
+	ss.Depth = g.eccentricity(g.Initial)
+	if ss.States <= MaxDiameterStates {
+		d := 0
+		for i, ok := range reach {
+			if ok {
+				if e := g.eccentricity([]int{i}); e > d {
+					d = e
+				}
+			}
+		}
+		ss.Diameter = &d
+	}
+
+	sccs := Components(g.Succ, reach, nil)
+	// Tarjan's algorithm finds sinks first
+	for a, b := 0, len(sccs)-1; a < b; a, b = a+1, b-1 {
+		sccs[a], sccs[b] = sccs[b], sccs[a]
+	}
+	comp := componentIndex(len(g.Nodes), sccs)
+	for id, scc := range sccs {
+		sort.Ints(scc)
+		c := Component{ID: id, States: scc, Cyclic: Cyclic(g.Succ, scc, nil), Out: []ComponentEdge{}}
+		labels := make(map[int]map[string]bool)
+		for _, v := range scc {
+			for _, e := range g.Succ[v] {
+				to := comp[e.To]
+				if to == id {
+					continue
+				}
+				if labels[to] == nil {
+					labels[to] = make(map[string]bool)
+				}
+				labels[to][e.Label] = true
+			}
+		}
+		for to, set := range labels {
+			edge := ComponentEdge{To: to}
+			for label := range set {
+				edge.Labels = append(edge.Labels, label)
+			}
+			sort.Strings(edge.Labels)
+			c.Out = append(c.Out, edge)
+		}
+		sort.Slice(c.Out, func(i, j int) bool { return c.Out[i].To < c.Out[j].To })
+		c.Bottom = len(c.Out) == 0
+
+		if c.Cyclic {
+			ss.Cyclic++
+		}
+		if c.Bottom {
+			ss.Bottom++
+		}
+		if len(scc) > ss.Largest {
+			ss.Largest = len(scc)
+		}
+		ss.Components = append(ss.Components, c)
+	}
+	return ss
+}
+
+// eccentricity returns the longest shortest path from the given nodes
+func (g *Graph) eccentricity(from []int) int {
+	dist := make(map[int]int, len(from))
+	queue := make([]int, 0, len(from))
+	for _, i := range from {
+		if _, ok := dist[i]; !ok {
+			dist[i] = 0
+			queue = append(queue, i)
+		}
+	}
+	longest := 0
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, e := range g.Succ[i] {
+			if _, ok := dist[e.To]; ok {
+				continue
+			}
+			dist[e.To] = dist[i] + 1
+			if dist[e.To] > longest {
+				longest = dist[e.To]
+			}
+			queue = append(queue, e.To)
+		}
+	}
+	return longest
+}
+
+// UnreachableLocals returns the declared local states no actor is in at
+// any reachable global state
+func (lts *LTS) UnreachableLocals() []string {
+	seen := make(map[string]bool)
+	for _, s := range lts.States {
+		for _, local := range s.Locals {
+			seen[local] = true
+		}
+	}
+	var out []string
+	for _, s := range lts.System.LocalStates() {
+		if !seen[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+// retryMachine loops between trying and backoff until it succeeds, and
+// declares a state nothing leads to
+var retryMachine = &prolog.StateMachine{
+	States:  []string{"idle", "trying", "backoff", "done", "orphan"},
+	Initial: []string{"idle"},
+	Transitions: []prolog.Transition{
+		{From: "idle", Label: "start", To: "trying"},
+		{From: "trying", Label: "fail", To: "backoff"},
+		{From: "backoff", Label: "retry", To: "trying"},
+		{From: "trying", Label: "ok", To: "done"},
+		{From: "done", Label: "tick", To: "done"},
+	},
+}
+
+func TestAnalyzeStateSpace(t *testing.T) {
+	g := TransitionGraph(retryMachine, nil)
+	ss := g.Analyze()
+
+	if ss.States != 4 || ss.Transitions != 5 {
+		t.Errorf("expected 4 states and 5 transitions, got %d and %d", ss.States, ss.Transitions)
+	}
+	if ss.Terminal != 0 {
+		t.Errorf("expected no terminal states, got %d", ss.Terminal)
+	}
+	if ss.Depth != 2 {
+		t.Errorf("expected depth 2, got %d", ss.Depth)
+	}
+	if ss.Diameter == nil || *ss.Diameter != 2 {
+		t.Errorf("expected diameter 2, got %+v", ss.Diameter)
+	}
+	if ss.MaxBranching != 2 {
+		t.Errorf("expected max branching 2, got %d", ss.MaxBranching)
+	}
+	if len(ss.Components) != 3 || ss.Cyclic != 2 || ss.Bottom != 1 || ss.Largest != 2 {
+		t.Fatalf("expected idle, {trying,backoff} and done, got %+v", ss)
+	}
+
+	// Components come out in topological order
+	for _, c := range ss.Components {
+		for _, e := range c.Out {
+			if e.To <= c.ID {
+				t.Errorf("component %d has an edge back to %d", c.ID, e.To)
+			}
+		}
+	}
+	first, last := ss.Components[0], ss.Components[2]
+	if g.Nodes[first.States[0]] != "idle" || first.Cyclic {
+		t.Errorf("expected acyclic idle first, got %+v", first)
+	}
+	if g.Nodes[last.States[0]] != "done" || !last.Cyclic || !last.Bottom {
+		t.Errorf("expected done as a cyclic bottom component, got %+v", last)
+	}
+	loop := ss.Components[1]
+	if len(loop.Out) != 1 || len(loop.Out[0].Labels) != 1 || loop.Out[0].Labels[0] != "ok" {
+		t.Errorf("expected the retry loop to leave on ok, got %+v", loop.Out)
+	}
+
+	reach := g.Reachable()
+	for i, name := range g.Nodes {
+		if reach[i] == (name == "orphan") {
+			t.Errorf("wrong reachability for %s", name)
+		}
+	}
+}
+
+func TestUnreachableLocals(t *testing.T) {
+	// The client can only leave recovering, never enter it
+	lts := explore(t, `
+        actor_initial(client, client_ready).
+        actor_transition(client, client_ready, commit, client_done).
+        actor_transition(client, client_recovering, resume, client_ready).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        accepting(client_done).
+    `)
+	got := lts.UnreachableLocals()
+	if len(got) != 1 || got[0] != "client_recovering" {
+		t.Errorf("expected only client_recovering unreachable, got %v", got)
+	}
+}
@@ -0,0 +1,479 @@
+// Package model composes a spec's actors and channels into a single global
+// transition system, applies its fault model, and checks CTL properties
+// over the reachable global states.
+package model
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+// DefaultCapacity is the buffer size of channels used by send/recv facts
+// without a channel/2 declaration
+const DefaultCapacity = 1
+
+// Channel fault kinds accepted by channel_fault/2
+const (
+	FaultLose      = "lose"
+	FaultDuplicate = "duplicate"
+	FaultReorder   = "reorder"
+)
+
+// Op is one message sent or received on a channel
+type Op struct {
+	Channel int
+	Msg     string
+}
+
+// Step is a local transition of one actor together with the messages it
+// receives and sends. Steps with no matching transition/3 fact come from
+// send/recv facts alone and are labelled with the message.
+type Step struct {
+	Actor int
+	From  string
+	Label string
+	To    string
+	Recvs []Op
+	Sends []Op
+}
+
+// Transition returns the step as a plain transition
+func (st *Step) Transition() prolog.Transition {
+	return prolog.Transition{From: st.From, Label: st.Label, To: st.To}
+}
+
+// Crash lets an actor crash and restart in a recovery state. Probability
+// is the chance per simulation step; the model checker treats it as possible.
+type Crash struct {
+	Actor       int
+	Recovery    string
+	Probability float64
+}
+
+// partition separates two groups of actors; side maps actor index to 1 or 2
+type partition struct {
+	name        string
+	side        map[int]int
+	probability float64
+}
+
+// System is the composition of a spec's actors and channels
+type System struct {
+	Actors   []string
+	Channels []string
+	Capacity []int
+	Initial  State
+
+	actorIndex   map[string]int
+	channelIndex map[string]int
+	stateActors  map[string]string
+	owners       map[string]string
+	steps        map[string][]*Step
+	receivers    [][]int
+	props        map[string][]string
+	accepting    map[string]bool
+	progress     map[string]bool
+	times        map[prolog.Transition][2]float64
+	localStates  []string
+	// propNames are the states and props named by prop/2
+	propNames []string
+
+	faults     []map[string]float64
+	crashes    []Crash
+	partitions []partition
+}
+
+// ActorOf resolves the actor owning a state, falling back to the state name
+// prefix (e.g., "proposer_idle" -> "proposer") for plain transition/3 specs
+func ActorOf(stateActors map[string]string, state string) string {
+	if actor, ok := stateActors[state]; ok {
+		return actor
+	}
+	if idx := strings.Index(state, "_"); idx > 0 {
+		return state[:idx]
+	}
+	return state
+}
+
+// Load builds the composed system for the engine's current spec
+func Load(ctx context.Context, engine *prolog.Engine) (*System, error) {
+	sm, err := engine.GetStateMachine(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stateActors, err := engine.GetStateActors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	channels, err := engine.GetChannels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sends, recvs, err := engine.GetChannelOps(ctx)
+	if err != nil {
+		return nil, err
+	}
+	faults, err := engine.GetFaults(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sys, err := newSystem(sm, stateActors, channels, sends, recvs, faults)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]string, 0, len(sys.steps))
+	seen := make(map[string]bool)
+	for _, steps := range sys.steps {
+		for _, st := range steps {
+			for _, s := range []string{st.From, st.To} {
+				if !seen[s] {
+					seen[s] = true
+					states = append(states, s)
+				}
+			}
+		}
+	}
+	for _, s := range append(append([]string(nil), sys.Initial.Locals...), sm.States...) {
+		if !seen[s] {
+			seen[s] = true
+			states = append(states, s)
+		}
+	}
+	sort.Strings(states)
+	sys.localStates = states
+	if sys.props, err = engine.GetStateProps(ctx, states); err != nil {
+		return nil, err
+	}
+	progress, err := engine.GetProgress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sm.Accepting {
+		sys.accepting[s] = true
+	}
+	for _, name := range progress {
+		sys.progress[name] = true
+	}
+	if sys.propNames, err = engine.GetPropNames(ctx); err != nil {
+		return nil, err
+	}
+	times, err := engine.GetTransitionTimes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range times {
+		sys.times[prolog.Transition{From: t.From, Label: t.Label, To: t.To}] = [2]float64{t.Min, t.Max}
+	}
+	return sys, nil
+}
+
+func newSystem(sm *prolog.StateMachine, stateActors map[string]string, channels []prolog.ChannelDecl, sends, recvs []prolog.ChannelOp, faults prolog.Faults) (*System, error) {
+	sys := &System{
+		actorIndex:   make(map[string]int),
+		channelIndex: make(map[string]int),
+		stateActors:  stateActors,
+		owners:       make(map[string]string),
+		steps:        make(map[string][]*Step),
+		props:        make(map[string][]string),
+		accepting:    make(map[string]bool),
+		progress:     make(map[string]bool),
+		times:        make(map[prolog.Transition][2]float64),
+	}
+
+	// Actors are those with an initial state
+	initial := make(map[string]string)
+	for _, s := range sm.Initial {
+		actor := ActorOf(stateActors, s)
+		if _, ok := initial[actor]; !ok {
+			sys.Actors = append(sys.Actors, actor)
+		}
+		initial[actor] = s
+	}
+	sort.Strings(sys.Actors)
+	for i, actor := range sys.Actors {
+		sys.actorIndex[actor] = i
+		sys.Initial.Locals = append(sys.Initial.Locals, initial[actor])
+	}
+
+	// Channels are declared by channel/2 or implied by send/recv facts
+	capacity := make(map[string]int)
+	for _, ch := range channels {
+		if _, exists := capacity[ch.Name]; exists {
+			return nil, fmt.Errorf("channel duplicate for %s", ch.Name)
+		}
+		if ch.Capacity < 1 {
+			return nil, fmt.Errorf("channel %s capacity must be at least 1", ch.Name)
+		}
+		capacity[ch.Name] = ch.Capacity
+	}
+	for _, op := range append(append([]prolog.ChannelOp{}, sends...), recvs...) {
+		if _, ok := capacity[op.Channel]; !ok {
+			capacity[op.Channel] = DefaultCapacity
+		}
+	}
+	for name := range capacity {
+		sys.Channels = append(sys.Channels, name)
+	}
+	sort.Strings(sys.Channels)
+	for i, name := range sys.Channels {
+		sys.channelIndex[name] = i
+		sys.Capacity = append(sys.Capacity, capacity[name])
+	}
+	sys.Initial.Chans = make([][]string, len(sys.Channels))
+	sys.receivers = make([][]int, len(sys.Channels))
+
+	sys.assignOwners(sm.Transitions, append(append([]prolog.ChannelOp{}, sends...), recvs...))
+
+	// Attach send/recv facts to the transitions between the same states
+	type edge struct{ from, to string }
+	byEdge := make(map[edge][]*Step)
+	for _, t := range sm.Transitions {
+		actor, ok := sys.actorIndex[sys.ownerOf(t.From)]
+		if !ok {
+			continue
+		}
+		st := &Step{Actor: actor, From: t.From, Label: t.Label, To: t.To}
+		sys.steps[t.From] = append(sys.steps[t.From], st)
+		byEdge[edge{t.From, t.To}] = append(byEdge[edge{t.From, t.To}], st)
+	}
+	implicit := make(map[string]*Step)
+	attach := func(op prolog.ChannelOp, isRecv bool) {
+		actor, ok := sys.actorIndex[sys.ownerOf(op.From)]
+		if !ok {
+			return
+		}
+		o := Op{Channel: sys.channelIndex[op.Channel], Msg: op.Msg}
+		targets := byEdge[edge{op.From, op.To}]
+		if len(targets) == 0 {
+			key := op.From + "|" + op.Msg + "|" + op.To
+			st, ok := implicit[key]
+			if !ok {
+				st = &Step{Actor: actor, From: op.From, Label: op.Msg, To: op.To}
+				implicit[key] = st
+				sys.steps[op.From] = append(sys.steps[op.From], st)
+			}
+			targets = []*Step{st}
+		}
+		for _, st := range targets {
+			if isRecv {
+				st.Recvs = append(st.Recvs, o)
+			} else {
+				st.Sends = append(st.Sends, o)
+			}
+		}
+		if isRecv && !containsInt(sys.receivers[o.Channel], actor) {
+			sys.receivers[o.Channel] = append(sys.receivers[o.Channel], actor)
+		}
+	}
+	for _, op := range sends {
+		attach(op, false)
+	}
+	for _, op := range recvs {
+		attach(op, true)
+	}
+
+	if err := sys.applyFaults(faults); err != nil {
+		return nil, err
+	}
+	return sys, nil
+}
+
+// assignOwners gives states without an actor_state/3 owner to the first
+// actor, in name order, whose initial state reaches them. This keeps plain
+// transition/3 specs working when state names do not share a prefix.
+func (sys *System) assignOwners(transitions []prolog.Transition, ops []prolog.ChannelOp) {
+	next := make(map[string][]string)
+	for _, t := range transitions {
+		next[t.From] = append(next[t.From], t.To)
+	}
+	for _, op := range ops {
+		next[op.From] = append(next[op.From], op.To)
+	}
+	for i, actor := range sys.Actors {
+		work := []string{sys.Initial.Locals[i]}
+		for len(work) > 0 {
+			state := work[len(work)-1]
+			work = work[:len(work)-1]
+			if owner, ok := sys.stateActors[state]; ok && owner != actor {
+				continue
+			}
+			if _, ok := sys.owners[state]; ok {
+				continue
+			}
+			sys.owners[state] = actor
+			work = append(work, next[state]...)
+		}
+	}
+}
+
+// ownerOf returns the actor owning a local state
+func (sys *System) ownerOf(state string) string {
+	if actor, ok := sys.stateActors[state]; ok {
+		return actor
+	}
+	if actor, ok := sys.owners[state]; ok {
+		return actor
+	}
+	return ActorOf(sys.stateActors, state)
+}
+
+// applyFaults validates and records the declared fault model
+func (sys *System) applyFaults(faults prolog.Faults) error {
+	sys.faults = make([]map[string]float64, len(sys.Channels))
+	for _, f := range faults.Channels {
+		ch, ok := sys.channelIndex[f.Channel]
+		if !ok {
+			return fmt.Errorf("channel_fault references unknown channel %s", f.Channel)
+		}
+		switch f.Kind {
+		case FaultLose, FaultDuplicate, FaultReorder:
+		default:
+			return fmt.Errorf("channel_fault %s has unknown kind %s (expected lose, duplicate or reorder)", f.Channel, f.Kind)
+		}
+		if f.Probability < 0 || f.Probability > 1 {
+			return fmt.Errorf("channel_fault %s probability must be between 0 and 1", f.Channel)
+		}
+		if sys.faults[ch] == nil {
+			sys.faults[ch] = make(map[string]float64)
+		}
+		sys.faults[ch][f.Kind] = f.Probability
+	}
+
+	for _, c := range faults.Crashes {
+		actor, ok := sys.actorIndex[c.Actor]
+		if !ok {
+			return fmt.Errorf("actor_may_crash references unknown actor %s", c.Actor)
+		}
+		if owner := sys.ownerOf(c.Recovery); owner != c.Actor {
+			return fmt.Errorf("actor_may_crash recovery state %s does not belong to %s", c.Recovery, c.Actor)
+		}
+		if c.Probability < 0 || c.Probability > 1 {
+			return fmt.Errorf("actor_may_crash %s probability must be between 0 and 1", c.Actor)
+		}
+		sys.crashes = append(sys.crashes, Crash{Actor: actor, Recovery: c.Recovery, Probability: c.Probability})
+	}
+
+	for _, p := range faults.Partitions {
+		if len(p.A) == 0 || len(p.B) == 0 {
+			return fmt.Errorf("partition needs actors on both sides")
+		}
+		part := partition{
+			name:        fmt.Sprintf("[%s]|[%s]", strings.Join(p.A, ","), strings.Join(p.B, ",")),
+			side:        make(map[int]int),
+			probability: p.Probability,
+		}
+		for side, actors := range [][]string{p.A, p.B} {
+			for _, name := range actors {
+				actor, ok := sys.actorIndex[name]
+				if !ok {
+					return fmt.Errorf("partition %s references unknown actor %s", part.name, name)
+				}
+				if part.side[actor] != 0 {
+					return fmt.Errorf("partition %s lists %s on both sides", part.name, name)
+				}
+				part.side[actor] = side + 1
+			}
+		}
+		if p.Probability < 0 || p.Probability > 1 {
+			return fmt.Errorf("partition %s probability must be between 0 and 1", part.name)
+		}
+		sys.partitions = append(sys.partitions, part)
+	}
+	return nil
+}
+
+// HasFaults reports whether the spec declares any fault
+func (sys *System) HasFaults() bool {
+	if len(sys.crashes) > 0 || len(sys.partitions) > 0 {
+		return true
+	}
+	for _, f := range sys.faults {
+		if len(f) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Steps returns the local steps leaving a state
+func (sys *System) Steps(state string) []*Step {
+	return sys.steps[state]
+}
+
+// LocalStates returns every declared local state in name order
+func (sys *System) LocalStates() []string {
+	return sys.localStates
+}
+
+// Props returns the atomic propositions of a local state
+func (sys *System) Props(state string) []string {
+	return sys.props[state]
+}
+
+// ActorIndex returns the index of an actor in Actors
+func (sys *System) ActorIndex(actor string) (int, bool) {
+	i, ok := sys.actorIndex[actor]
+	return i, ok
+}
+
+// ChannelFault reports whether a channel fault kind is declared on a
+// channel, and its per-message probability
+func (sys *System) ChannelFault(ch int, kind string) (float64, bool) {
+	p, ok := sys.faults[ch][kind]
+	return p, ok
+}
+
+// Receivers returns the actors that receive on a channel
+func (sys *System) Receivers(ch int) []int {
+	return sys.receivers[ch]
+}
+
+// Partitioned reports whether an active partition separates the sender
+// from any receiver of a channel
+func (sys *System) Partitioned(cut []bool, sender, ch int) bool {
+	for i, active := range cut {
+		if !active {
+			continue
+		}
+		from := sys.partitions[i].side[sender]
+		if from == 0 {
+			continue
+		}
+		for _, r := range sys.receivers[ch] {
+			if to := sys.partitions[i].side[r]; to != 0 && to != from {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Crashes returns the declared actor crashes
+func (sys *System) Crashes() []Crash {
+	return sys.crashes
+}
+
+// Partitions returns the number of declared partitions
+func (sys *System) Partitions() int {
+	return len(sys.partitions)
+}
+
+// Partition describes a declared partition and its per-step probability
+func (sys *System) Partition(i int) (string, float64) {
+	return sys.partitions[i].name, sys.partitions[i].probability
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
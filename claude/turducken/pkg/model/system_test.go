@@ -0,0 +1,198 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+// pingSpec has a client that sends one request and a server that must
+// receive it before it can finish.
+const pingSpec = `
+        actor_initial(client, client_ready).
+        actor_initial(server, server_waiting).
+        actor_transition(client, client_ready, request, client_sent).
+        actor_transition(server, server_waiting, handle, server_done).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        prop(server_done, handled).
+        channel(req, 1).
+        send(req, ping, client_ready, client_sent).
+        recv(req, ping, server_waiting, server_done).
+    `
+
+func loadSystem(t *testing.T, spec string) *System {
+	t.Helper()
+	engine, err := prolog.New()
+	if err != nil {
+		t.Fatalf("prolog.New error: %v", err)
+	}
+	if err := engine.LoadSpec(spec); err != nil {
+		t.Fatalf("LoadSpec error: %v", err)
+	}
+	sys, err := Load(context.Background(), engine)
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	return sys
+}
+
+func mustCheck(t *testing.T, sys *System, formula string) bool {
+	t.Helper()
+	lts, err := sys.Explore(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Explore error: %v", err)
+	}
+	f, err := ParseFormula(formula)
+	if err != nil {
+		t.Fatalf("ParseFormula(%q) error: %v", formula, err)
+	}
+	ok, err := lts.Satisfies(f)
+	if err != nil {
+		t.Fatalf("Satisfies error: %v", err)
+	}
+	return ok
+}
+
+func TestComposedChannelsBlockReceive(t *testing.T) {
+	sys := loadSystem(t, pingSpec)
+	lts, err := sys.Explore(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Explore error: %v", err)
+	}
+	// ready/waiting -> sent/waiting with ping buffered -> sent/done
+	if len(lts.States) != 3 {
+		t.Fatalf("expected 3 global states, got %d", len(lts.States))
+	}
+	if len(lts.Succ[0]) != 1 || lts.Succ[0][0].Label != "request" {
+		t.Errorf("expected the server to wait for ping, got %+v", lts.Succ[0])
+	}
+	if !mustCheck(t, sys, "af(atom(handled))") {
+		t.Errorf("expected the request to be handled on every path")
+	}
+}
+
+func TestComposedFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults string
+		fault  string
+		broken string
+	}{
+		{"lose", "channel_fault(req, lose).", "lose(req,ping)", "af(atom(handled))"},
+		{"crash", "actor_may_crash(server, server_waiting).", "crash(server)", "ag(implies(atom(handled), ag(atom(handled))))"},
+		{"partition", "partition([client], [server]).", "partitioned(req,ping)", "af(atom(handled))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sys := loadSystem(t, pingSpec+tt.faults)
+			if !sys.HasFaults() {
+				t.Fatalf("expected faults to be declared")
+			}
+			if !mustCheck(t, loadSystem(t, pingSpec), tt.broken) {
+				t.Fatalf("expected %s to hold without faults", tt.broken)
+			}
+			if mustCheck(t, sys, tt.broken) {
+				t.Errorf("expected %s to break %s", tt.name, tt.broken)
+			}
+			if !mustCheck(t, sys, "ef(atom(handled))") {
+				t.Errorf("expected handling to remain possible under %s", tt.name)
+			}
+
+			lts, _ := sys.Explore(context.Background(), 0)
+			found := false
+			for _, edges := range lts.Succ {
+				for _, e := range edges {
+					if strings.Contains(e.Fault, tt.fault) {
+						found = true
+					}
+				}
+			}
+			if !found {
+				t.Errorf("expected an edge with fault %s", tt.fault)
+			}
+		})
+	}
+}
+
+func TestComposedDuplicateAndReorder(t *testing.T) {
+	spec := `
+        actor_initial(client, client_ready).
+        actor_initial(server, server_waiting).
+        actor_transition(client, client_ready, first, client_middle).
+        actor_transition(client, client_middle, second, client_sent).
+        actor_transition(server, server_waiting, take, server_done).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        channel(req, 2).
+        send(req, a, client_ready, client_middle).
+        send(req, b, client_middle, client_sent).
+        recv(req, b, server_waiting, server_done).
+    `
+	sys := loadSystem(t, spec)
+	if mustCheck(t, sys, "ef(atom(server_done))") {
+		t.Fatalf("expected b to be stuck behind a on a FIFO channel")
+	}
+
+	reordered := loadSystem(t, spec+"channel_fault(req, reorder).")
+	if !mustCheck(t, reordered, "ef(atom(server_done))") {
+		t.Errorf("expected reordering to let b overtake a")
+	}
+
+	duplicated := loadSystem(t, spec+"channel_fault(req, duplicate).")
+	if !mustCheck(t, duplicated, "ef(atom(client_middle))") {
+		t.Errorf("expected duplicated model to still reach client_middle")
+	}
+}
+
+func TestLoadRejectsInvalidFaults(t *testing.T) {
+	engine, _ := prolog.New()
+	for name, decl := range map[string]string{
+		"unknown channel": "channel_fault(nowhere, lose).",
+		"unknown kind":    "channel_fault(req, corrupt).",
+		"unknown actor":   "actor_may_crash(ghost, ghost_idle).",
+		"foreign state":   "actor_may_crash(server, client_ready).",
+		"partition sides": "partition([client], [client]).",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_ = engine.Reset()
+			if err := engine.LoadSpec(pingSpec + decl); err != nil {
+				t.Fatalf("LoadSpec error: %v", err)
+			}
+			if _, err := Load(context.Background(), engine); err == nil {
+				t.Errorf("expected %s to be rejected", decl)
+			}
+		})
+	}
+}
+
+func TestExploreStateLimit(t *testing.T) {
+	sys := loadSystem(t, pingSpec)
+	if _, err := sys.Explore(context.Background(), 2); !errors.Is(err, ErrStateLimit) {
+		t.Errorf("expected ErrStateLimit, got %v", err)
+	}
+}
+
+func TestBlockingReportsChannels(t *testing.T) {
+	sys := loadSystem(t, pingSpec)
+	server, _ := sys.ActorIndex("server")
+	client, _ := sys.ActorIndex("client")
+	recv := sys.Steps(sys.Initial.Locals[server])[0]
+	send := sys.Steps(sys.Initial.Locals[client])[0]
+
+	if recvs, sends := sys.Blocking(sys.Initial, recv, nil); len(recvs) != 1 || len(sends) != 0 {
+		t.Errorf("expected the server to wait on an empty req, got %v %v", recvs, sends)
+	}
+	full := sys.Initial.Clone()
+	full.Chans[0] = []string{"ping"}
+	if recvs, sends := sys.Blocking(full, send, nil); len(recvs) != 0 || len(sends) != 1 {
+		t.Errorf("expected the client to block on a full req, got %v %v", recvs, sends)
+	}
+	if recvs, sends := sys.Blocking(sys.Initial, send, nil); len(recvs)+len(sends) != 0 {
+		t.Errorf("expected an enabled step not to block, got %v %v", recvs, sends)
+	}
+}
@@ -0,0 +1,280 @@
+package prolog
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Params binds a query's variables by name instead of ? placeholders. Pass
+// it as the only argument:
+//
+//	e.QueryOne(ctx, "state_guard(State, G).", prolog.Params{"State": "idle"})
+type Params map[string]interface{}
+
+// String binds as double-quoted text rather than an atom
+type String string
+
+// bind returns query with each ? placeholder, or with Params each named
+// variable, replaced by the Prolog text for its argument:
+//
+//	string             an atom, quoted as needed
+//	String             double-quoted text
+//	ints, floats       numbers; float64 always binds a float
+//	bool               the atom true or false
+//	JSONTerm           the term it encodes (see DecodeTerm)
+//	slices and arrays  lists of the above
+//
+// Placeholders inside quotes and comments are left alone.
+func bind(query string, args []interface{}) (string, error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+	if params, ok := args[0].(Params); ok && len(args) == 1 {
+		return bindNamed(query, params)
+	}
+
+	next := 0
+	bound, err := rewriteQuery(query, func(tok string) (string, bool, error) {
+		if tok != "?" {
+			return "", false, nil
+		}
+		if next >= len(args) {
+			return "", false, fmt.Errorf("query has more ? placeholders than the %d arguments", len(args))
+		}
+		text, err := termText(args[next])
+		if err != nil {
+			return "", false, fmt.Errorf("argument %d: %w", next+1, err)
+		}
+		next++
+		return text, true, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if next < len(args) {
+		return "", fmt.Errorf("query has %d ? placeholders for %d arguments", next, len(args))
+	}
+	return bound, nil
+}
+
+func bindNamed(query string, params Params) (string, error) {
+	texts := make(map[string]string, len(params))
+	for name, v := range params {
+		if !isVariableName(name) {
+			return "", fmt.Errorf("param %q is not a variable name", name)
+		}
+		text, err := termText(v)
+		if err != nil {
+			return "", fmt.Errorf("param %s: %w", name, err)
+		}
+		texts[name] = text
+	}
+
+	used := make(map[string]bool, len(params))
+	bound, err := rewriteQuery(query, func(tok string) (string, bool, error) {
+		text, ok := texts[tok]
+		if ok {
+			used[tok] = true
+		}
+		return text, ok, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	var unused []string
+	for name := range params {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	if len(unused) > 0 {
+		sort.Strings(unused)
+		return "", fmt.Errorf("query has no variable %s", strings.Join(unused, ", "))
+	}
+	return bound, nil
+}
+
+func isVariableName(name string) bool {
+	if name == "" || name == "_" || !(name[0] == '_' || name[0] >= 'A' && name[0] <= 'Z') {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// termText returns the Prolog text for a Go value, parenthesized where an
+// operator next to it could otherwise absorb it
+func termText(v interface{}) (string, error) {
+	var text string
+	switch t := v.(type) {
+	case JSONTerm:
+		s, err := DecodeTerm(t)
+		if err != nil {
+			return "", err
+		}
+		text = s
+	case String:
+		text = quoteText(string(t), '"')
+	case string:
+		text = QuoteAtom(t)
+	case bool:
+		text = strconv.FormatBool(t)
+	case nil:
+		return "", fmt.Errorf("cannot bind nil")
+	default:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			text = strconv.FormatInt(rv.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if rv.Uint() > math.MaxInt64 {
+				return "", fmt.Errorf("integer %d out of range", rv.Uint())
+			}
+			text = strconv.FormatUint(rv.Uint(), 10)
+		case reflect.Float32, reflect.Float64:
+			f := rv.Float()
+			if math.IsInf(f, 0) || math.IsNaN(f) {
+				return "", fmt.Errorf("cannot bind float %v", f)
+			}
+			text = formatFloat(f)
+		case reflect.Slice, reflect.Array:
+			elems := make([]string, rv.Len())
+			for i := range elems {
+				s, err := termText(rv.Index(i).Interface())
+				if err != nil {
+					return "", err
+				}
+				elems[i] = s
+			}
+			return "[" + strings.Join(elems, ",") + "]", nil
+		case reflect.String:
+			text = QuoteAtom(rv.String())
+		default:
+			return "", fmt.Errorf("cannot bind %T", v)
+		}
+	}
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "'") {
+		text = "(" + text + ")"
+	}
+	return text, nil
+}
+
+// rewriteQuery tokenizes query just enough to find variables and ? outside
+// quotes, character codes and comments, passing each to replace. Other
+// text is copied unchanged.
+func rewriteQuery(query string, replace func(tok string) (string, bool, error)) (string, error) {
+	var sb strings.Builder
+	emit := func(tok string) error {
+		text, ok, err := replace(tok)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			text = tok
+		}
+		sb.WriteString(text)
+		return nil
+	}
+
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == '%':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			sb.WriteString(query[i : i+end])
+			i += end
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return "", fmt.Errorf("unterminated comment")
+			}
+			sb.WriteString(query[i : i+end+4])
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`':
+			end, err := quotedEnd(query, i)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(query[i:end])
+			i = end
+		case c == '0' && i+1 < len(query) && query[i+1] == '\'':
+			// 0'c is a character code
+			end := i + 3
+			if strings.HasPrefix(query[i+2:], "\\") || strings.HasPrefix(query[i+2:], "''") {
+				end++
+			}
+			if end > len(query) {
+				end = len(query)
+			}
+			sb.WriteString(query[i:end])
+			i = end
+		case isAlnum(c):
+			end := i
+			for end < len(query) && isAlnum(query[end]) {
+				end++
+			}
+			if err := emit(query[i:end]); err != nil {
+				return "", err
+			}
+			i = end
+		case isSymbolChar(c):
+			end := i
+			for end < len(query) && isSymbolChar(query[end]) {
+				end++
+			}
+			tok := query[i:end]
+			// "?." before layout is a placeholder then the end of the clause
+			if tok == "?." && (end == len(query) || strings.ContainsRune(" \t\r\n%", rune(query[end]))) {
+				if err := emit("?"); err != nil {
+					return "", err
+				}
+				sb.WriteString(".")
+			} else if err := emit(tok); err != nil {
+				return "", err
+			}
+			i = end
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String(), nil
+}
+
+// quotedEnd returns the index just past the quoted text starting at start
+func quotedEnd(query string, start int) (int, error) {
+	q := query[start]
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case q:
+			if i+1 < len(query) && query[i+1] == q {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated quoted text")
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c >= 0x80
+}
+
+func isSymbolChar(c byte) bool {
+	return strings.IndexByte(`+-*/\^<>=~:.?@#&$`, c) >= 0
+}
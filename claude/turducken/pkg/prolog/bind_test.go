@@ -0,0 +1,89 @@
+package prolog
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		query string
+		args  []interface{}
+		want  string
+	}{
+		{"state_guard(?, G).", []interface{}{"idle"}, "state_guard(idle, G)."},
+		{"p(?, ?, ?).", []interface{}{"Idle", "it's", `a\b`}, `p(('Idle'), ('it\'s'), ('a\\b')).`},
+		{"X = ?.", []interface{}{String(`say "hi"`)}, `X = "say \"hi\"".`},
+		{"X is 3 - ?, Y = ?", []interface{}{-2, 1.0}, "X is 3 - (-2), Y = 1.0"},
+		{"X = ?.\n", []interface{}{[]interface{}{"a", 1, true}}, "X = [a,1,true].\n"},
+		{"X = '?', Y = \"?\", Z = 0'?, W = ? % ?\n.", []interface{}{"w"}, "X = '?', Y = \"?\", Z = 0'?, W = w % ?\n."},
+		{"X = ?- /* ? */ ?.", []interface{}{"a"}, "X = ?- /* ? */ a."},
+		{"X = ?.", []interface{}{JSONTerm(`{"functor": "f", "args": ["A", -1]}`)}, "X = f('A',-1)."},
+	}
+	for _, tt := range tests {
+		got, err := bind(tt.query, tt.args)
+		if err != nil {
+			t.Errorf("%s: bind error: %v", tt.query, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.query, tt.want, got)
+		}
+	}
+
+	for _, args := range [][]interface{}{{"a"}, {"a", "b", "c"}, {nil, "b"}, {struct{}{}, "b"}} {
+		if got, err := bind("p(?, ?).", args); err == nil {
+			t.Errorf("%v: expected an error, got %q", args, got)
+		}
+	}
+}
+
+func TestBindParams(t *testing.T) {
+	got, err := bind("p(State, 'State', Other), State \\== x.", []interface{}{Params{"State": "Idle"}})
+	if err != nil {
+		t.Fatalf("bind error: %v", err)
+	}
+	if want := "p(('Idle'), 'State', Other), ('Idle') \\== x."; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	if _, err := bind("p(State).", []interface{}{Params{"Missing": 1}}); err == nil {
+		t.Error("expected an unused param to be rejected")
+	}
+	if _, err := bind("p(state).", []interface{}{Params{"state": 1}}); err == nil {
+		t.Error("expected a lowercase param name to be rejected")
+	}
+}
+
+func TestQueryWithArgs(t *testing.T) {
+	e, err := New(WithSpec(`
+        state_guard('Odd state', low).
+        label(idle, "text").
+        weight(idle, 2.5).
+    `))
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	ctx := context.Background()
+
+	type guard struct{ G string }
+	guards, err := QueryInto[guard](ctx, e, "state_guard(?, G).", "Odd state")
+	if err != nil || len(guards) != 1 || guards[0].G != "low" {
+		t.Errorf("expected the quoted state to match, got %v, %v", guards, err)
+	}
+
+	ok, err := e.QueryOne(ctx, "label(?, ?), weight(S, W), W > ?.", "idle", String("text"), 2)
+	if err != nil || !ok {
+		t.Errorf("expected atom, string and number arguments to match, got %v, %v", ok, err)
+	}
+
+	rows, err := e.RawQueryBindings(ctx, "weight(S, W).", Params{"S": "idle"})
+	if err != nil || len(rows) != 1 || rows[0]["W"] != "2.5" || rows[0]["S"] != "" {
+		t.Errorf("expected S to be bound by name, got %v, %v", rows, err)
+	}
+
+	// An argument can't inject a second goal
+	if ok, err := e.QueryOne(ctx, "label(?, _).", "idle, true"); err != nil || ok {
+		t.Errorf("expected the argument to stay one atom, got %v, %v", ok, err)
+	}
+}
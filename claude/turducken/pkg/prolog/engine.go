@@ -2,8 +2,13 @@ package prolog
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -17,19 +22,80 @@ type Engine struct {
 	mu          sync.RWMutex
 	interpreter *prolog.Interpreter
 	specSource  string
+	version     string
+	logger      *log.Logger
+	output      io.Writer
+	sandbox     *sandbox
+	specTrusted bool
+	params      map[string]float64
+	// snapshot is the current Snapshot, made on first use
+	snapshot *Snapshot
+}
+
+// Option configures an Engine created by New
+type Option func(*options)
+
+type options struct {
+	logger  *log.Logger
+	output  io.Writer
+	version string
+	spec    string
+	sandbox *Limits
+}
+
+// WithLogger sends the engine's diagnostics to logger. By default they are
+// discarded.
+func WithLogger(logger *log.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// WithOutput sends what specs print, with write/1 and friends, to w. By
+// default it is discarded.
+func WithOutput(w io.Writer) Option {
+	return func(o *options) { o.output = w }
+}
+
+// WithVersion asserts turducken_version/1, as AssertTurduckenVersion does
+func WithVersion(version string) Option {
+	return func(o *options) { o.version = version }
+}
+
+// WithSpec loads a specification, as LoadSpec does
+func WithSpec(source string) Option {
+	return func(o *options) { o.spec = source }
 }
 
 // New creates a new Prolog engine with the core turducken predicates loaded
-func New() (*Engine, error) {
+func New(opts ...Option) (*Engine, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.logger == nil {
+		o.logger = log.New(io.Discard, "", 0)
+	}
+
 	e := &Engine{
-		interpreter: prolog.New(nil, nil),
+		logger: o.logger,
+		output: o.output,
 	}
+	if o.sandbox != nil {
+		e.sandbox = &sandbox{limits: *o.sandbox}
+	}
+	e.interpreter = e.newInterpreter()
 
 	// Load core predicates for CTL, CSP, and visualization
 	if err := e.loadCore(); err != nil {
 		return nil, fmt.Errorf("loading core predicates: %w", err)
 	}
-
+	if err := e.AssertTurduckenVersion(o.version); err != nil {
+		return nil, fmt.Errorf("asserting version: %w", err)
+	}
+	if o.spec != "" {
+		if err := e.LoadSpec(o.spec); err != nil {
+			return nil, fmt.Errorf("loading spec: %w", err)
+		}
+	}
 	return e, nil
 }
 
@@ -47,6 +113,9 @@ func (e *Engine) loadCore() error {
 % accepting(State) - marks accepting state
 % state_guard(State, Guard) - optional guard name for a state (Guard/1 uses Dice)
 % transition_guard(From, Label, To, Guard) - optional guard for a transition (Guard/1)
+% transition_duration(From, Label, To, Dist) - simulated time a transition takes
+%   Dist is const(T), uniform(Low, High), exp(Rate) or normal(Mean, StdDev)
+% transition_priority(From, Label, To, Priority) - weight for the priority scheduler
 % Allow definitions to be scattered across generated + user code.
 :- discontiguous(state/2).
 :- discontiguous(transition/3).
@@ -70,6 +139,19 @@ func (e *Engine) loadCore() error {
 :- discontiguous(state_guard/2).
 :- discontiguous(transition_guard/4).
 :- discontiguous(transition_prob/4).
+:- discontiguous(transition_duration/4).
+:- discontiguous(transition_priority/4).
+:- discontiguous(accumulator/2).
+:- discontiguous(reward/3).
+:- discontiguous(random_var/2).
+:- discontiguous(param/2).
+:- discontiguous(channel_fault/2).
+:- discontiguous(channel_fault/3).
+:- discontiguous(actor_may_crash/2).
+:- discontiguous(actor_may_crash/3).
+:- discontiguous(partition/2).
+:- discontiguous(partition/3).
+:- discontiguous(progress/1).
 
 % --- CTL Operators (Kripke structure based) ---
 % The model is defined by: state/2, transition/3, prop/2
@@ -149,7 +231,107 @@ ctl_au(State, Phi, Psi, Visited) :-
     Nexts \= [],
     forall(member(N, Nexts), ctl_au(N, Phi, Psi, [State|Visited])).
 
+% --- Bounded CTL Operators ---
+% Step bounds count transitions, e.g. ef_le(6, atom(committed)). Time bounds
+% add up transition_duration/4 times, e.g. af_within(2.5, atom(done)):
+% existential operators may take each transition at its fastest, universal
+% ones must allow for its slowest.
+
+% transition_time(From, Label, To, Min, Max) - the least and greatest time a
+% transition takes: zero when undeclared, Max = inf when unbounded
+transition_time(From, Label, To, Min, Max) :-
+    (transition_duration(From, Label, To, D) ->
+        param_dist(D, Dist), dist_bounds(Dist, Min, Max)
+    ; Min = 0, Max = 0).
+dist_bounds(const(V), V, V) :- !.
+dist_bounds(uniform(Low, High), Low, High) :- !.
+dist_bounds(V, V, V) :- number(V), !.
+dist_bounds(_, 0, inf).
+
+% E[Phi U<=N Psi] - some path reaches Psi within N steps
+ctl_eu_le(State, _Phi, Psi, _N) :-
+    ctl_sat(State, Psi), !.
+ctl_eu_le(State, Phi, Psi, N) :-
+    N > 0,
+    ctl_sat(State, Phi),
+    N1 is N - 1,
+    transition(State, _, Next),
+    ctl_eu_le(Next, Phi, Psi, N1), !.
+
+% A[Phi U<=N Psi] - every path reaches Psi within N steps
+ctl_au_le(State, _Phi, Psi, _N) :-
+    ctl_sat(State, Psi), !.
+ctl_au_le(State, Phi, Psi, N) :-
+    N > 0,
+    ctl_sat(State, Phi),
+    N1 is N - 1,
+    findall(Next, transition(State, _, Next), Nexts),
+    Nexts \= [],
+    forall(member(Next, Nexts), ctl_au_le(Next, Phi, Psi, N1)).
+
+% EG<=N Phi - some path keeps Phi for its first N steps
+ctl_eg_le(State, Phi, N) :-
+    ctl_sat(State, Phi),
+    (N =< 0 -> true ;
+     (N1 is N - 1,
+      transition(State, _, Next),
+      ctl_eg_le(Next, Phi, N1))), !.
+
+% AG<=N Phi - every state within N steps satisfies Phi
+ctl_ag_le(State, Phi, N) :-
+    ctl_sat(State, Phi),
+    (N =< 0 -> true ;
+     (N1 is N - 1,
+      forall(transition(State, _, Next), ctl_ag_le(Next, Phi, N1)))).
+
+% Time-bounded operators remember the states visited since time last passed,
+% so cycles of instantaneous transitions terminate
+time_visited(Time, State, Visited, V) :-
+    (Time > 0 -> V = [] ; V = [State|Visited]).
+
+% E[Phi U<=T Psi] - some path and timing reaches Psi by time T
+ctl_eu_within(State, _Phi, Psi, _T, _Visited) :-
+    ctl_sat(State, Psi), !.
+ctl_eu_within(State, Phi, Psi, T, Visited) :-
+    \+ member(State, Visited),
+    ctl_sat(State, Phi),
+    transition(State, Label, Next),
+    transition_time(State, Label, Next, Min, _),
+    Min =< T,
+    T1 is T - Min,
+    time_visited(Min, State, Visited, V),
+    ctl_eu_within(Next, Phi, Psi, T1, V), !.
+
+% A[Phi U<=T Psi] - every path reaches Psi by time T however long each
+% transition takes
+ctl_au_within(State, _Phi, Psi, _T, _Visited) :-
+    ctl_sat(State, Psi), !.
+ctl_au_within(State, Phi, Psi, T, Visited) :-
+    \+ member(State, Visited),
+    ctl_sat(State, Phi),
+    findall(Label-Next, transition(State, Label, Next), Nexts),
+    Nexts \= [],
+    forall(member(Label-Next, Nexts),
+           (transition_time(State, Label, Next, _, Max),
+            Max \== inf,
+            Max =< T,
+            T1 is T - Max,
+            time_visited(Max, State, Visited, V),
+            ctl_au_within(Next, Phi, Psi, T1, V))).
+
+% AG<=T Phi - every state some timing reaches by time T satisfies Phi
+ctl_ag_within(State, Phi, T, Visited) :-
+    ctl_sat(State, Phi),
+    (member(State, Visited) -> true ;
+     forall((transition(State, Label, Next),
+             transition_time(State, Label, Next, Min, _),
+             Min =< T),
+            (T1 is T - Min,
+             time_visited(Min, State, Visited, V),
+             ctl_ag_within(Next, Phi, T1, V)))).
+
 % Satisfaction relation
+ctl_sat(_, true).
 ctl_sat(State, atom(P)) :- prop(State, P).
 ctl_sat(State, not(Phi)) :- \+ ctl_sat(State, Phi).
 ctl_sat(State, and(Phi, Psi)) :- ctl_sat(State, Phi), ctl_sat(State, Psi).
@@ -162,12 +344,175 @@ ctl_sat(State, eg(Phi)) :- ctl_eg(State, Phi).
 ctl_sat(State, ag(Phi)) :- ctl_ag(State, Phi).
 ctl_sat(State, eu(Phi, Psi)) :- ctl_eu(State, Phi, Psi, []).
 ctl_sat(State, au(Phi, Psi)) :- ctl_au(State, Phi, Psi, []).
-
-% Check property from initial state
+ctl_sat(State, implies(Phi, Psi)) :- (ctl_sat(State, Phi) -> ctl_sat(State, Psi) ; true).
+ctl_sat(State, iff(Phi, Psi)) :- (ctl_sat(State, Phi) -> ctl_sat(State, Psi) ; \+ ctl_sat(State, Psi)).
+% Weak until lets Phi hold forever; release: Psi holds until and including
+% the first Phi state, or forever
+ctl_sat(State, ew(Phi, Psi)) :- (ctl_sat(State, eu(Phi, Psi)) ; ctl_sat(State, eg(Phi))), !.
+ctl_sat(State, aw(Phi, Psi)) :- \+ ctl_sat(State, eu(not(Psi), and(not(Phi), not(Psi)))).
+ctl_sat(State, er(Phi, Psi)) :- \+ ctl_sat(State, au(not(Phi), not(Psi))).
+ctl_sat(State, ar(Phi, Psi)) :- \+ ctl_sat(State, eu(not(Phi), not(Psi))).
+ctl_sat(State, ef_le(N, Phi)) :- step_bound(N), ctl_eu_le(State, true, Phi, N).
+ctl_sat(State, af_le(N, Phi)) :- step_bound(N), ctl_au_le(State, true, Phi, N).
+ctl_sat(State, eg_le(N, Phi)) :- step_bound(N), ctl_eg_le(State, Phi, N).
+ctl_sat(State, ag_le(N, Phi)) :- step_bound(N), ctl_ag_le(State, Phi, N).
+ctl_sat(State, eu_le(N, Phi, Psi)) :- step_bound(N), ctl_eu_le(State, Phi, Psi, N).
+ctl_sat(State, au_le(N, Phi, Psi)) :- step_bound(N), ctl_au_le(State, Phi, Psi, N).
+ctl_sat(State, ef_within(T, Phi)) :- time_bound(T), ctl_eu_within(State, true, Phi, T, []).
+ctl_sat(State, af_within(T, Phi)) :- time_bound(T), ctl_au_within(State, true, Phi, T, []).
+ctl_sat(State, ag_within(T, Phi)) :- time_bound(T), ctl_ag_within(State, Phi, T, []).
+ctl_sat(State, eu_within(T, Phi, Psi)) :- time_bound(T), ctl_eu_within(State, Phi, Psi, T, []).
+ctl_sat(State, au_within(T, Phi, Psi)) :- time_bound(T), ctl_au_within(State, Phi, Psi, T, []).
+
+step_bound(N) :- integer(N), N >= 0.
+time_bound(T) :- number(T), T >= 0.
+
+% Check property from initial state. check_ctl/1 holds when some initial
+% state satisfies Phi, check_ctl_all/1 when every one does, as universal
+% properties of specs with several initial states need.
 check_ctl(Phi) :-
     initial(S),
     ctl_sat(S, Phi).
 
+check_ctl_all(Phi) :-
+    initial(_), !,
+    \+ (initial(S), \+ ctl_sat(S, Phi)).
+
+% ctl_state_sat(Phi, State, Sat) - whether each state satisfies Phi
+ctl_state_sat(Phi, State, Sat) :-
+    mu_states(States),
+    member(State, States),
+    (ctl_sat(State, Phi) -> Sat = true ; Sat = false).
+
+% --- Modal Mu-Calculus ---
+% Formulas are evaluated to sorted lists of states over transition/3:
+%   true, false, atom(P), not(F), and(F1, F2), or(F1, F2), implies(F1, F2)
+%   diamond(A, F)  - some A-labelled transition leads to F
+%   box(A, F)      - every A-labelled transition leads to F
+%   mu(X, F)       - least fixpoint of F in the Prolog variable X
+%   nu(X, F)       - greatest fixpoint of F in X
+% Actions A are a label, a list of labels, not(A), or any (also a variable).
+% Fixpoint variables must occur under an even number of negations. CTL
+% operators may be mixed in and are translated by ctl_to_mu/2, e.g.
+%   check_mu(nu(X, mu(Y, or(and(atom(prepared), diamond(send_prepare, X)),
+%                           diamond(any, Y))))).
+
+check_mu(F) :-
+    mu_sat(F, Sat),
+    initial(S),
+    mu_member(S, Sat), !.
+
+check_mu_all(F) :-
+    initial(_), !,
+    mu_sat(F, Sat),
+    \+ (initial(S), \+ mu_member(S, Sat)).
+
+% mu_state_sat(F, State, Sat) - whether each state satisfies F
+mu_state_sat(F, State, Sat) :-
+    mu_sat(F, SatStates),
+    mu_states(States),
+    member(State, States),
+    (mu_member(State, SatStates) -> Sat = true ; Sat = false).
+
+mu_sat(F, Sat) :-
+    ctl_to_mu(F, M),
+    mu_states(States),
+    mu_eval(M, States, [], Sat).
+
+mu_states(States) :-
+    findall(S, (state(S, _) ; initial(S) ; transition(S, _, _) ; transition(_, _, S)), Bag),
+    sort(Bag, States).
+
+mu_eval(X, _, Env, Sat) :-
+    var(X), !,
+    (mu_lookup(X, Env, Sat) -> true
+    ; throw(error(existence_error(fixpoint_variable, X), check_mu/1))).
+mu_eval(true, States, _, States) :- !.
+mu_eval(false, _, _, []) :- !.
+mu_eval(atom(P), States, _, Sat) :- !,
+    findall(S, (member(S, States), prop(S, P)), Sat).
+mu_eval(not(F), States, Env, Sat) :- !,
+    mu_eval(F, States, Env, S1),
+    mu_subtract(States, S1, Sat).
+mu_eval(and(F1, F2), States, Env, Sat) :- !,
+    mu_eval(F1, States, Env, S1),
+    mu_eval(F2, States, Env, S2),
+    mu_intersect(S1, S2, Sat).
+mu_eval(or(F1, F2), States, Env, Sat) :- !,
+    mu_eval(F1, States, Env, S1),
+    mu_eval(F2, States, Env, S2),
+    append(S1, S2, S12),
+    sort(S12, Sat).
+mu_eval(implies(F1, F2), States, Env, Sat) :- !,
+    mu_eval(or(not(F1), F2), States, Env, Sat).
+mu_eval(diamond(A, F), States, Env, Sat) :- !,
+    mu_eval(F, States, Env, S1),
+    findall(S, (member(S, States),
+                once((transition(S, L, T), mu_action(A, L), mu_member(T, S1)))), Sat).
+mu_eval(box(A, F), States, Env, Sat) :- !,
+    mu_eval(F, States, Env, S1),
+    findall(S, (member(S, States),
+                \+ (transition(S, L, T), mu_action(A, L), \+ mu_member(T, S1))), Sat).
+mu_eval(mu(X, F), States, Env, Sat) :- !,
+    mu_fix(X, F, States, Env, [], Sat).
+mu_eval(nu(X, F), States, Env, Sat) :- !,
+    mu_fix(X, F, States, Env, States, Sat).
+mu_eval(F, _, _, _) :-
+    throw(error(domain_error(mu_formula, F), check_mu/1)).
+
+% Iterate from the empty set (mu) or all states (nu) until nothing changes
+mu_fix(X, F, States, Env, Current, Sat) :-
+    mu_eval(F, States, [X-Current|Env], Next),
+    (Next == Current -> Sat = Current
+    ; mu_fix(X, F, States, Env, Next, Sat)).
+
+mu_lookup(X, [Y-Sat|_], Sat) :- X == Y, !.
+mu_lookup(X, [_|Env], Sat) :- mu_lookup(X, Env, Sat).
+
+mu_action(A, _) :- var(A), !.
+mu_action(any, _) :- !.
+mu_action(not(A), L) :- !, \+ mu_action(A, L).
+mu_action([A|As], L) :- !, mu_member(L, [A|As]).
+mu_action(L, L).
+
+mu_member(X, List) :- once(member(X, List)).
+mu_intersect(S1, S2, Sat) :- findall(S, (member(S, S1), mu_member(S, S2)), Sat).
+mu_subtract(S1, S2, Sat) :- findall(S, (member(S, S1), \+ mu_member(S, S2)), Sat).
+
+% ctl_to_mu(Ctl, Mu) - translates the CTL operators in a formula, leaving
+% mu-calculus operators in place. As in check_ctl/1, ax, af and au need a
+% successor, so they never hold in a deadlock. Bounded operators are not
+% translated.
+ctl_to_mu(X, X) :- var(X), !.
+ctl_to_mu(true, true) :- !.
+ctl_to_mu(false, false) :- !.
+ctl_to_mu(atom(P), atom(P)) :- !.
+ctl_to_mu(not(F), not(M)) :- !, ctl_to_mu(F, M).
+ctl_to_mu(and(F1, F2), and(M1, M2)) :- !, ctl_to_mu(F1, M1), ctl_to_mu(F2, M2).
+ctl_to_mu(or(F1, F2), or(M1, M2)) :- !, ctl_to_mu(F1, M1), ctl_to_mu(F2, M2).
+ctl_to_mu(implies(F1, F2), implies(M1, M2)) :- !, ctl_to_mu(F1, M1), ctl_to_mu(F2, M2).
+ctl_to_mu(diamond(A, F), diamond(A, M)) :- !, ctl_to_mu(F, M).
+ctl_to_mu(box(A, F), box(A, M)) :- !, ctl_to_mu(F, M).
+ctl_to_mu(mu(X, F), mu(X, M)) :- !, ctl_to_mu(F, M).
+ctl_to_mu(nu(X, F), nu(X, M)) :- !, ctl_to_mu(F, M).
+ctl_to_mu(ex(F), diamond(any, M)) :- !, ctl_to_mu(F, M).
+ctl_to_mu(ax(F), and(box(any, M), diamond(any, true))) :- !, ctl_to_mu(F, M).
+ctl_to_mu(ef(F), mu(X, or(M, diamond(any, X)))) :- !, ctl_to_mu(F, M).
+ctl_to_mu(af(F), mu(X, or(M, and(box(any, X), diamond(any, true))))) :- !, ctl_to_mu(F, M).
+ctl_to_mu(eg(F), nu(X, and(M, diamond(any, X)))) :- !, ctl_to_mu(F, M).
+ctl_to_mu(ag(F), nu(X, and(M, box(any, X)))) :- !, ctl_to_mu(F, M).
+ctl_to_mu(eu(F1, F2), mu(X, or(M2, and(M1, diamond(any, X))))) :- !,
+    ctl_to_mu(F1, M1), ctl_to_mu(F2, M2).
+ctl_to_mu(au(F1, F2), mu(X, or(M2, and(M1, and(box(any, X), diamond(any, true)))))) :- !,
+    ctl_to_mu(F1, M1), ctl_to_mu(F2, M2).
+ctl_to_mu(iff(F1, F2), and(implies(M1, M2), implies(M2, M1))) :- !,
+    ctl_to_mu(F1, M1), ctl_to_mu(F2, M2).
+ctl_to_mu(ew(F1, F2), M) :- !, ctl_to_mu(or(eu(F1, F2), eg(F1)), M).
+ctl_to_mu(aw(F1, F2), M) :- !, ctl_to_mu(not(eu(not(F2), and(not(F1), not(F2)))), M).
+ctl_to_mu(er(F1, F2), M) :- !, ctl_to_mu(not(au(not(F1), not(F2))), M).
+ctl_to_mu(ar(F1, F2), M) :- !, ctl_to_mu(not(eu(not(F1), not(F2))), M).
+ctl_to_mu(F, F).
+
 % --- CSP-Style Message Passing ---
 % channel(Name, Capacity) - buffered channel with capacity
 % send(Channel, Msg, FromState, ToState) - send message
@@ -183,15 +528,85 @@ check_ctl(Phi) :-
 % Default guard predicates (overridden by user specs when provided)
 state_guard(_, _) :- fail.
 transition_guard(_, _, _, _) :- fail.
-
-% Dice predicate used during simulation (dice0_value/1 is asserted by simulator)
-:- dynamic(dice0_value/1).
-dice0_value(_) :- fail.
+transition_duration(_, _, _, _) :- fail.
+transition_priority(_, _, _, _) :- fail.
+transition_prob(_, _, _, _) :- fail.
+
+% Parameters (param_override/2 is asserted for per-request overrides and sweeps)
+% param(Name, Default) - declares a tunable number
+% param_value(Name, Value) - the override for this request, or the default
+% param(Name) may stand for the value inside transition_prob/4, dice0/2 and
+% the arguments of transition_duration/4 and random_var/2 distributions,
+% including in arithmetic, e.g. transition_prob(a, go, b, 1 - param(rate))
+param(_, _) :- fail.
+:- dynamic(param_override/2).
+param_override(_, _) :- fail.
+param_value(Name, Value) :-
+    (param_override(Name, V) -> Value = V ; param(Name, Value)).
+param_expr(param(Name), V) :- !, param_value(Name, V).
+param_expr(E, E) :- (var(E) ; atomic(E)), !.
+param_expr(E, R) :- E =.. [Op|Args], param_exprs(Args, RArgs), R =.. [Op|RArgs].
+param_exprs([], []).
+param_exprs([A|As], [R|Rs]) :- param_expr(A, R), param_exprs(As, Rs).
+param_number(E, V) :-
+    (catch((param_expr(E, X), V0 is X), _, fail) -> V = V0 ; V = E).
+param_numbers([], []).
+param_numbers([A|As], [V|Vs]) :- param_number(A, V), param_numbers(As, Vs).
+param_dist(D, V) :- atomic(D), !, param_number(D, V).
+param_dist(D, V) :- functor(D, F, _), member(F, [param, +, -, *, /]), !, param_number(D, V).
+param_dist(D, R) :- compound(D), !, D =.. [Kind|Args], param_numbers(Args, Vs), R =.. [Kind|Vs].
+param_dist(D, D).
+
+% Random variables used during simulation (roll_value/2 is asserted by simulator)
+% random_var(Name, Dist) - declares a random variable, e.g. uniform(0, 10)
+% roll(Name, Value) - the actor's current draw, or the mean when not simulating
+random_var(_, _) :- fail.
+:- dynamic(roll_value/2).
+roll_value(_, _) :- fail.
+roll(Name, Value) :-
+    (roll_value(Name, V) -> Value = V ; random_var(Name, Dist), dist_mean(Dist, Value)).
+dist_mean(const(V), V).
+dist_mean(V, V) :- number(V).
+dist_mean(uniform(Low, High), M) :- M is (Low + High) / 2.
+dist_mean(exp(Rate), M) :- M is 1 / Rate.
+dist_mean(normal(Mean, _), Mean).
+
+% dice0 is an implicit uniform(0, 1) random variable; when not simulating,
+% dice0/2 is always true
 dice0(Low, High) :-
-    (dice0_value(D) -> D >= Low, D < High ; true).
+    (roll_value(dice0, D) ->
+        param_expr(Low, L), param_expr(High, H), D >= L, D < H
+    ; true).
 prob(dice0, Low, High) :-
     dice0(Low, High).
 
+% Accumulators used during simulation (accumulator_value/2 is asserted by simulator)
+% accumulator(Name, Initial) - declares a simulation variable
+% reward(Name, Label, Amount) - adds Amount to Name each time Label fires
+% acc(Name, Value) - current value, or the initial value when not simulating
+accumulator(_, _) :- fail.
+reward(_, _, _) :- fail.
+:- dynamic(accumulator_value/2).
+accumulator_value(_, _) :- fail.
+acc(Name, Value) :-
+    (accumulator_value(Name, V) -> Value = V ; accumulator(Name, Value)).
+
+% Fault model applied by the composed model checker and the simulator
+% channel_fault(Chan, Kind) - Chan may lose, duplicate or reorder messages
+% actor_may_crash(Actor, RecoveryState) - Actor may crash and restart in RecoveryState
+% partition(ActorsA, ActorsB) - messages between the two groups may be dropped
+% The /3 forms add the per-step probability the simulator uses (default 0.1)
+channel_fault(_, _) :- fail.
+channel_fault(_, _, _) :- fail.
+actor_may_crash(_, _) :- fail.
+actor_may_crash(_, _, _) :- fail.
+partition(_, _) :- fail.
+partition(_, _, _) :- fail.
+
+% Progress markers for deadlock and livelock analysis
+% progress(Name) - reaching state Name, or firing label Name, is progress
+progress(_) :- fail.
+
 % --- Visualization Extraction ---
 
 % Get all states for state machine diagram
@@ -267,9 +682,6 @@ member(X, [_|T]) :- member(X, T).
 append([], L, L).
 append([H|T], L, [H|R]) :- append(T, L, R).
 
-length([], 0).
-length([_|T], N) :- length(T, N1), N is N1 + 1.
-
 % forall(Cond, Action) - for all solutions of Cond, Action must succeed
 forall(Cond, Action) :- \+ (Cond, \+ Action).
 `
@@ -282,7 +694,20 @@ func (e *Engine) LoadSpec(source string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	e.specSource = source
+	e.specSource, e.specTrusted = source, false
+	e.params, e.snapshot = nil, nil
+	return e.interpreter.ExecContext(e.limited(context.Background()), source)
+}
+
+// LoadTrustedSpec loads a specification as LoadSpec does, but outside any
+// sandbox, as for a spec file given on the command line
+func (e *Engine) LoadTrustedSpec(source string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	defer e.trust()()
+	e.specSource, e.specTrusted = source, true
+	e.params, e.snapshot = nil, nil
 	return e.interpreter.Exec(source)
 }
 
@@ -291,18 +716,33 @@ func (e *Engine) LoadSpecFile(path string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	defer e.trust()()
+
+	// The text is kept for Snapshot and GetSource
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	e.specSource, e.specTrusted = string(content), true
+	e.params, e.snapshot = nil, nil
 	if err := e.interpreter.Exec(fmt.Sprintf(`:- consult('%s').`, path)); err != nil {
 		return err
 	}
 	return nil
 }
 
-// Query executes a Prolog query and returns solutions
-func (e *Engine) Query(ctx context.Context, query string) ([]map[string]string, error) {
+// Query executes a Prolog query and returns solutions. Arguments bind to
+// ? placeholders in the query, or to its variables as Params.
+func (e *Engine) Query(ctx context.Context, query string, args ...interface{}) ([]map[string]string, error) {
+	query, err := bind(query, args)
+	if err != nil {
+		return nil, err
+	}
+
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	sols, err := e.interpreter.QueryContext(ctx, query)
+	sols, err := e.interpreter.QueryContext(e.limited(ctx), query)
 	if err != nil {
 		return nil, err
 	}
@@ -320,12 +760,18 @@ func (e *Engine) Query(ctx context.Context, query string) ([]map[string]string,
 	return results, sols.Err()
 }
 
-// QueryOne executes a query expecting at most one solution
-func (e *Engine) QueryOne(ctx context.Context, query string) (bool, error) {
+// QueryOne executes a query expecting at most one solution, binding args
+// as Query does
+func (e *Engine) QueryOne(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	query, err := bind(query, args)
+	if err != nil {
+		return false, err
+	}
+
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	sols, err := e.interpreter.QueryContext(ctx, query)
+	sols, err := e.interpreter.QueryContext(e.limited(ctx), query)
 	if err != nil {
 		return false, err
 	}
@@ -399,6 +845,20 @@ func termToString(v interface{}) string {
 	return fmt.Sprintf("%v", v)
 }
 
+// Helper function to convert prolog term to float, preserving fractions
+func termToFloat(v interface{}) float64 {
+	switch t := v.(type) {
+	case int:
+		return float64(t)
+	case int64:
+		return float64(t)
+	case float64:
+		return t
+	default:
+		return 0
+	}
+}
+
 // Helper function to convert prolog term to int
 func termToInt(v interface{}) int {
 	switch t := v.(type) {
@@ -427,76 +887,53 @@ func (e *Engine) GetStateMachine(ctx context.Context) (*StateMachine, error) {
 
 	// Get transitions and collect states from them
 	stateSet := make(map[string]bool)
-	sols, err := e.interpreter.QueryContext(ctx, "transition(From, Label, To).")
-	if err != nil {
-		log.Printf("Error querying transitions: %v", err)
-		return sm, nil
-	}
-
-	for sols.Next() {
+	err := e.extract(ctx, "transition(From, Label, To).", func(sols *prolog.Solutions) error {
 		var result struct {
 			From  interface{}
 			Label interface{}
 			To    interface{}
 		}
 		if err := sols.Scan(&result); err != nil {
-			log.Printf("Error scanning transition: %v", err)
-			continue
+			return err
 		}
-		fromStr := termToString(result.From)
-		labelStr := termToString(result.Label)
-		toStr := termToString(result.To)
-		log.Printf("Found transition: %s --%s--> %s", fromStr, labelStr, toStr)
-		sm.Transitions = append(sm.Transitions, Transition{
-			From:  fromStr,
-			Label: labelStr,
-			To:    toStr,
-		})
-		stateSet[fromStr] = true
-		stateSet[toStr] = true
-	}
-	sols.Close()
-
-	// Get initial states
-	sols, err = e.interpreter.QueryContext(ctx, "initial(S).")
-	if err != nil {
-		log.Printf("Error querying initial: %v", err)
-	} else {
-		for sols.Next() {
-			var result struct {
-				S interface{}
-			}
-			if err := sols.Scan(&result); err != nil {
-				log.Printf("Error scanning initial: %v", err)
-				continue
-			}
-			sStr := termToString(result.S)
-			log.Printf("Found initial state: %s", sStr)
-			sm.Initial = append(sm.Initial, sStr)
-			stateSet[sStr] = true
+		t := Transition{
+			From:  termToString(result.From),
+			Label: termToString(result.Label),
+			To:    termToString(result.To),
 		}
-		sols.Close()
+		e.logger.Printf("Found transition: %s --%s--> %s", t.From, t.Label, t.To)
+		sm.Transitions = append(sm.Transitions, t)
+		stateSet[t.From] = true
+		stateSet[t.To] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Get accepting states
-	sols, err = e.interpreter.QueryContext(ctx, "accepting(S).")
-	if err != nil {
-		log.Printf("Error querying accepting: %v", err)
-	} else {
-		for sols.Next() {
+	// Get initial and accepting states
+	for _, q := range []struct {
+		query  string
+		states *[]string
+	}{
+		{"initial(S).", &sm.Initial},
+		{"accepting(S).", &sm.Accepting},
+	} {
+		err := e.extract(ctx, q.query, func(sols *prolog.Solutions) error {
 			var result struct {
 				S interface{}
 			}
 			if err := sols.Scan(&result); err != nil {
-				log.Printf("Error scanning accepting: %v", err)
-				continue
+				return err
 			}
-			sStr := termToString(result.S)
-			log.Printf("Found accepting state: %s", sStr)
-			sm.Accepting = append(sm.Accepting, sStr)
-			stateSet[sStr] = true
+			state := termToString(result.S)
+			*q.states = append(*q.states, state)
+			stateSet[state] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
-		sols.Close()
 	}
 
 	// Convert state set to slice
@@ -504,7 +941,7 @@ func (e *Engine) GetStateMachine(ctx context.Context) (*StateMachine, error) {
 		sm.States = append(sm.States, s)
 	}
 
-	log.Printf("GetStateMachine returning %d states, %d transitions", len(sm.States), len(sm.Transitions))
+	e.logger.Printf("GetStateMachine returning %d states, %d transitions", len(sm.States), len(sm.Transitions))
 	return sm, nil
 }
 
@@ -533,37 +970,39 @@ func (e *Engine) GetSequenceDiagram(ctx context.Context) (*SequenceDiagram, erro
 	}
 
 	// Get lifelines
-	sols, err := e.interpreter.QueryContext(ctx, "lifeline(L).")
-	if err == nil {
-		for sols.Next() {
-			var result struct {
-				L interface{}
-			}
-			if err := sols.Scan(&result); err == nil {
-				seq.Lifelines = append(seq.Lifelines, termToString(result.L))
-			}
+	err := e.extract(ctx, "lifeline(L).", func(sols *prolog.Solutions) error {
+		var result struct {
+			L interface{}
 		}
-		sols.Close()
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		seq.Lifelines = append(seq.Lifelines, termToString(result.L))
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Get messages
 	formats := make(map[string]string)
-	sols, err = e.interpreter.QueryContext(ctx, "message_format(Label, Format).")
-	if err == nil {
-		for sols.Next() {
-			var result struct {
-				Label  interface{}
-				Format interface{}
-			}
-			if err := sols.Scan(&result); err == nil {
-				label := termToString(result.Label)
-				format := termToString(result.Format)
-				if label != "" && format != "" {
-					formats[label] = format
-				}
-			}
+	err = e.extract(ctx, "message_format(Label, Format).", func(sols *prolog.Solutions) error {
+		var result struct {
+			Label  interface{}
+			Format interface{}
 		}
-		sols.Close()
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		label := termToString(result.Label)
+		format := termToString(result.Format)
+		if label != "" && format != "" {
+			formats[label] = format
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	formatLabel := func(msgLabel, displayLabel string) string {
@@ -573,25 +1012,26 @@ func (e *Engine) GetSequenceDiagram(ctx context.Context) (*SequenceDiagram, erro
 		return displayLabel
 	}
 
-	sols, err = e.interpreter.QueryContext(ctx, "message(Seq, From, To, Label).")
-	if err == nil {
-		for sols.Next() {
-			var result struct {
-				Seq   interface{}
-				From  interface{}
-				To    interface{}
-				Label interface{}
-			}
-			if err := sols.Scan(&result); err == nil {
-				seq.Messages = append(seq.Messages, SequenceMessage{
-					Seq:   termToInt(result.Seq),
-					From:  termToString(result.From),
-					To:    termToString(result.To),
-					Label: termToString(result.Label),
-				})
-			}
+	err = e.extract(ctx, "message(Seq, From, To, Label).", func(sols *prolog.Solutions) error {
+		var result struct {
+			Seq   interface{}
+			From  interface{}
+			To    interface{}
+			Label interface{}
 		}
-		sols.Close()
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		seq.Messages = append(seq.Messages, SequenceMessage{
+			Seq:   termToInt(result.Seq),
+			From:  termToString(result.From),
+			To:    termToString(result.To),
+			Label: termToString(result.Label),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	if len(seq.Messages) == 0 {
@@ -601,73 +1041,75 @@ func (e *Engine) GetSequenceDiagram(ctx context.Context) (*SequenceDiagram, erro
 		}
 
 		annotations := make(map[string][]annotation)
-		sols, err = e.interpreter.QueryContext(ctx, "msg_annotation(Label, Direction, Actor).")
-		if err == nil {
-			for sols.Next() {
-				var result struct {
-					Label     interface{}
-					Direction interface{}
-					Actor     interface{}
-				}
-				if err := sols.Scan(&result); err == nil {
-					label := termToString(result.Label)
-					annotations[label] = append(annotations[label], annotation{
-						Direction: termToString(result.Direction),
-						Other:     termToString(result.Actor),
-					})
-				}
+		err := e.extract(ctx, "msg_annotation(Label, Direction, Actor).", func(sols *prolog.Solutions) error {
+			var result struct {
+				Label     interface{}
+				Direction interface{}
+				Actor     interface{}
+			}
+			if err := sols.Scan(&result); err != nil {
+				return err
 			}
-			sols.Close()
+			label := termToString(result.Label)
+			annotations[label] = append(annotations[label], annotation{
+				Direction: termToString(result.Direction),
+				Other:     termToString(result.Actor),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
 
 		if len(annotations) > 0 {
 			lifelinesSeen := make(map[string]bool)
-			sols, err = e.interpreter.QueryContext(ctx, "actor_transition(Actor, From, Label, To).")
-			if err == nil {
-				seqNum := 1
-				for sols.Next() {
-					var result struct {
-						Actor interface{}
-						From  interface{}
-						Label interface{}
-						To    interface{}
+			seqNum := 1
+			err := e.extract(ctx, "actor_transition(Actor, From, Label, To).", func(sols *prolog.Solutions) error {
+				var result struct {
+					Actor interface{}
+					From  interface{}
+					Label interface{}
+					To    interface{}
+				}
+				if err := sols.Scan(&result); err != nil {
+					return err
+				}
+				actor := termToString(result.Actor)
+				label := termToString(result.Label)
+				for _, ann := range annotations[label] {
+					var from string
+					var to string
+					switch ann.Direction {
+					case "send":
+						from = actor
+						to = ann.Other
+					case "recv":
+						from = ann.Other
+						to = actor
+					default:
+						continue
 					}
-					if err := sols.Scan(&result); err == nil {
-						actor := termToString(result.Actor)
-						label := termToString(result.Label)
-						for _, ann := range annotations[label] {
-							var from string
-							var to string
-							switch ann.Direction {
-							case "send":
-								from = actor
-								to = ann.Other
-							case "recv":
-								from = ann.Other
-								to = actor
-							default:
-								continue
-							}
-							seq.Messages = append(seq.Messages, SequenceMessage{
-								Seq:   seqNum,
-								From:  from,
-								To:    to,
-								Label: formatLabel(label, label),
-							})
-							seqNum++
-
-							if !lifelinesSeen[from] {
-								seq.Lifelines = append(seq.Lifelines, from)
-								lifelinesSeen[from] = true
-							}
-							if !lifelinesSeen[to] {
-								seq.Lifelines = append(seq.Lifelines, to)
-								lifelinesSeen[to] = true
-							}
-						}
+					seq.Messages = append(seq.Messages, SequenceMessage{
+						Seq:   seqNum,
+						From:  from,
+						To:    to,
+						Label: formatLabel(label, label),
+					})
+					seqNum++
+
+					if !lifelinesSeen[from] {
+						seq.Lifelines = append(seq.Lifelines, from)
+						lifelinesSeen[from] = true
+					}
+					if !lifelinesSeen[to] {
+						seq.Lifelines = append(seq.Lifelines, to)
+						lifelinesSeen[to] = true
 					}
 				}
-				sols.Close()
+				return nil
+			})
+			if err != nil {
+				return nil, err
 			}
 		}
 	}
@@ -681,70 +1123,18 @@ func (e *Engine) GetSequenceDiagram(ctx context.Context) (*SequenceDiagram, erro
 			Actor string
 		}
 
-		actors := make(map[string]bool)
-		for _, query := range []string{"actor(Name).", "actor(Name, _)."} {
-			sols, err = e.interpreter.QueryContext(ctx, query)
-			if err != nil {
-				continue
-			}
-			for sols.Next() {
-				var result struct {
-					Name interface{}
-				}
-				if err := sols.Scan(&result); err == nil {
-					name := termToString(result.Name)
-					if name != "" {
-						actors[name] = true
-					}
-				}
-			}
-			sols.Close()
+		actors, err := e.actors(ctx)
+		if err != nil {
+			return nil, err
+		}
+		isActor := make(map[string]bool, len(actors))
+		for _, name := range actors {
+			isActor[name] = true
 		}
 
-		stateActors := make(map[string]string)
-		for _, query := range []string{
-			"actor_state(Actor, State, _).",
-			"actor_initial(Actor, State).",
-			"actor_transition(Actor, From, _Label, To).",
-		} {
-			sols, err = e.interpreter.QueryContext(ctx, query)
-			if err != nil {
-				continue
-			}
-			for sols.Next() {
-				switch query {
-				case "actor_transition(Actor, From, _Label, To).":
-					var result struct {
-						Actor interface{}
-						From  interface{}
-						To    interface{}
-					}
-					if err := sols.Scan(&result); err == nil {
-						actor := termToString(result.Actor)
-						from := termToString(result.From)
-						to := termToString(result.To)
-						if actor != "" && from != "" {
-							stateActors[from] = actor
-						}
-						if actor != "" && to != "" {
-							stateActors[to] = actor
-						}
-					}
-				default:
-					var result struct {
-						Actor interface{}
-						State interface{}
-					}
-					if err := sols.Scan(&result); err == nil {
-						actor := termToString(result.Actor)
-						state := termToString(result.State)
-						if actor != "" && state != "" {
-							stateActors[state] = actor
-						}
-					}
-				}
-			}
-			sols.Close()
+		stateActors, err := e.stateActors(ctx)
+		if err != nil {
+			return nil, err
 		}
 
 		extractActor := func(state string) string {
@@ -754,12 +1144,12 @@ func (e *Engine) GetSequenceDiagram(ctx context.Context) (*SequenceDiagram, erro
 			if actor, ok := stateActors[state]; ok && actor != "" {
 				return actor
 			}
-			if actors[state] {
+			if isActor[state] {
 				return state
 			}
 			if idx := strings.Index(state, "_"); idx > 0 {
 				prefix := state[:idx]
-				if len(actors) == 0 || actors[prefix] {
+				if len(isActor) == 0 || isActor[prefix] {
 					return prefix
 				}
 			}
@@ -770,47 +1160,35 @@ func (e *Engine) GetSequenceDiagram(ctx context.Context) (*SequenceDiagram, erro
 		}
 
 		senders := make(map[chanMsg]endpoint)
-		sols, err = e.interpreter.QueryContext(ctx, "send(Channel, Msg, From, _To).")
-		if err == nil {
-			for sols.Next() {
+		receivers := make(map[chanMsg]endpoint)
+		for _, q := range []struct {
+			query     string
+			endpoints map[chanMsg]endpoint
+		}{
+			{"send(Channel, Msg, From, _To).", senders},
+			{"recv(Channel, Msg, From, _To).", receivers},
+		} {
+			err := e.extract(ctx, q.query, func(sols *prolog.Solutions) error {
 				var result struct {
 					Channel interface{}
 					Msg     interface{}
 					From    interface{}
 				}
-				if err := sols.Scan(&result); err == nil {
-					key := chanMsg{
-						Channel: termToString(result.Channel),
-						Msg:     termToString(result.Msg),
-					}
-					senders[key] = endpoint{
-						Actor: extractActor(termToString(result.From)),
-					}
+				if err := sols.Scan(&result); err != nil {
+					return err
 				}
-			}
-			sols.Close()
-		}
-
-		receivers := make(map[chanMsg]endpoint)
-		sols, err = e.interpreter.QueryContext(ctx, "recv(Channel, Msg, From, _To).")
-		if err == nil {
-			for sols.Next() {
-				var result struct {
-					Channel interface{}
-					Msg     interface{}
-					From    interface{}
+				key := chanMsg{
+					Channel: termToString(result.Channel),
+					Msg:     termToString(result.Msg),
 				}
-				if err := sols.Scan(&result); err == nil {
-					key := chanMsg{
-						Channel: termToString(result.Channel),
-						Msg:     termToString(result.Msg),
-					}
-					receivers[key] = endpoint{
-						Actor: extractActor(termToString(result.From)),
-					}
+				q.endpoints[key] = endpoint{
+					Actor: extractActor(termToString(result.From)),
 				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
 			}
-			sols.Close()
 		}
 
 		if len(senders) > 0 {
@@ -872,25 +1250,21 @@ func (e *Engine) GetPieChart(ctx context.Context) ([]PieSlice, error) {
 	defer e.mu.RUnlock()
 
 	var slices []PieSlice
-
-	sols, err := e.interpreter.QueryContext(ctx, "pie_slice(Label, Value).")
-	if err == nil {
-		for sols.Next() {
-			var result struct {
-				Label interface{}
-				Value interface{}
-			}
-			if err := sols.Scan(&result); err == nil {
-				slices = append(slices, PieSlice{
-					Label: termToString(result.Label),
-					Value: float64(termToInt(result.Value)),
-				})
-			}
+	err := e.extract(ctx, "pie_slice(Label, Value).", func(sols *prolog.Solutions) error {
+		var result struct {
+			Label interface{}
+			Value Number
 		}
-		sols.Close()
-	}
-
-	return slices, nil
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		slices = append(slices, PieSlice{
+			Label: termToString(result.Label),
+			Value: float64(result.Value),
+		})
+		return nil
+	})
+	return slices, err
 }
 
 // LinePoint represents a point on a line chart
@@ -906,27 +1280,23 @@ func (e *Engine) GetLineChart(ctx context.Context) ([]LinePoint, error) {
 	defer e.mu.RUnlock()
 
 	var points []LinePoint
-
-	sols, err := e.interpreter.QueryContext(ctx, "line_point(Series, X, Y).")
-	if err == nil {
-		for sols.Next() {
-			var result struct {
-				Series interface{}
-				X      interface{}
-				Y      interface{}
-			}
-			if err := sols.Scan(&result); err == nil {
-				points = append(points, LinePoint{
-					Series: termToString(result.Series),
-					X:      float64(termToInt(result.X)),
-					Y:      float64(termToInt(result.Y)),
-				})
-			}
+	err := e.extract(ctx, "line_point(Series, X, Y).", func(sols *prolog.Solutions) error {
+		var result struct {
+			Series interface{}
+			X      Number
+			Y      Number
 		}
-		sols.Close()
-	}
-
-	return points, nil
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		points = append(points, LinePoint{
+			Series: termToString(result.Series),
+			X:      float64(result.X),
+			Y:      float64(result.Y),
+		})
+		return nil
+	})
+	return points, err
 }
 
 // StateMachine represents extracted state machine data
@@ -957,27 +1327,23 @@ func (e *Engine) GetProperties(ctx context.Context) ([]Property, error) {
 	defer e.mu.RUnlock()
 
 	var properties []Property
-
-	sols, err := e.interpreter.QueryContext(ctx, "property(Name, Desc, Formula).")
-	if err == nil {
-		for sols.Next() {
-			var result struct {
-				Name    interface{}
-				Desc    interface{}
-				Formula interface{}
-			}
-			if err := sols.Scan(&result); err == nil {
-				properties = append(properties, Property{
-					Name:        termToString(result.Name),
-					Description: termToString(result.Desc),
-					Formula:     termToString(result.Formula),
-				})
-			}
+	err := e.extract(ctx, "property(Name, Desc, Formula).", func(sols *prolog.Solutions) error {
+		var result struct {
+			Name    interface{}
+			Desc    interface{}
+			Formula interface{}
 		}
-		sols.Close()
-	}
-
-	return properties, nil
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		properties = append(properties, Property{
+			Name:        termToString(result.Name),
+			Description: termToString(result.Desc),
+			Formula:     termToString(result.Formula),
+		})
+		return nil
+	})
+	return properties, err
 }
 
 // Doc represents a documentation entry
@@ -992,25 +1358,21 @@ func (e *Engine) GetDocs(ctx context.Context) ([]Doc, error) {
 	defer e.mu.RUnlock()
 
 	var docs []Doc
-
-	sols, err := e.interpreter.QueryContext(ctx, "doc(Topic, Content).")
-	if err == nil {
-		for sols.Next() {
-			var result struct {
-				Topic   interface{}
-				Content interface{}
-			}
-			if err := sols.Scan(&result); err == nil {
-				docs = append(docs, Doc{
-					Topic:   termToString(result.Topic),
-					Content: termToString(result.Content),
-				})
-			}
+	err := e.extract(ctx, "doc(Topic, Content).", func(sols *prolog.Solutions) error {
+		var result struct {
+			Topic   interface{}
+			Content interface{}
 		}
-		sols.Close()
-	}
-
-	return docs, nil
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		docs = append(docs, Doc{
+			Topic:   termToString(result.Topic),
+			Content: termToString(result.Content),
+		})
+		return nil
+	})
+	return docs, err
 }
 
 // GetActors extracts actor definitions
@@ -1018,6 +1380,10 @@ func (e *Engine) GetActors(ctx context.Context) ([]string, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
+	return e.actors(ctx)
+}
+
+func (e *Engine) actors(ctx context.Context) ([]string, error) {
 	var actors []string
 	seen := make(map[string]bool)
 
@@ -1027,27 +1393,927 @@ func (e *Engine) GetActors(ctx context.Context) ([]string, error) {
 	}
 
 	for _, query := range queries {
-		sols, err := e.interpreter.QueryContext(ctx, query)
+		err := e.extract(ctx, query, func(sols *prolog.Solutions) error {
+			var result struct {
+				Name interface{}
+			}
+			if err := sols.Scan(&result); err != nil {
+				return err
+			}
+			name := termToString(result.Name)
+			if name != "" && !seen[name] {
+				seen[name] = true
+				actors = append(actors, name)
+			}
+			return nil
+		})
 		if err != nil {
-			continue
+			return nil, err
+		}
+	}
+
+	return actors, nil
+}
+
+// GetStateActors maps each actor-owned state to its actor, using
+// actor_state/3, actor_initial/2 and actor_transition/4.
+func (e *Engine) GetStateActors(ctx context.Context) (map[string]string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.stateActors(ctx)
+}
+
+func (e *Engine) stateActors(ctx context.Context) (map[string]string, error) {
+	stateActors := make(map[string]string)
+	for _, query := range []string{
+		"actor_state(Actor, State, _).",
+		"actor_initial(Actor, State).",
+		"actor_transition(Actor, From, _Label, To).",
+	} {
+		err := e.extract(ctx, query, func(sols *prolog.Solutions) error {
+			var result struct {
+				Actor interface{}
+				State interface{}
+				From  interface{}
+				To    interface{}
+			}
+			if err := sols.Scan(&result); err != nil {
+				return err
+			}
+			actor := termToString(result.Actor)
+			if actor == "" {
+				return nil
+			}
+			for _, state := range []interface{}{result.State, result.From, result.To} {
+				if name := termToString(state); name != "" {
+					stateActors[name] = actor
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stateActors, nil
+}
+
+// ActorStateMachine is one actor's declared state machine
+type ActorStateMachine struct {
+	Actor       string       `json:"actor"`
+	States      []string     `json:"states"`
+	Transitions []Transition `json:"transitions"`
+	Initial     string       `json:"initial"`
+}
+
+// GetActorStateMachines extracts per-actor state machines from
+// actor_state/3, actor_initial/2 and actor_transition/4, sorted by actor.
+// States named only by a transition are included. Specs written with plain
+// transition/3 facts have no actor state machines.
+func (e *Engine) GetActorStateMachines(ctx context.Context) ([]ActorStateMachine, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	machines := make(map[string]*ActorStateMachine)
+	seen := make(map[string]bool)
+	machine := func(actor string) *ActorStateMachine {
+		m, ok := machines[actor]
+		if !ok {
+			m = &ActorStateMachine{Actor: actor, States: []string{}, Transitions: []Transition{}}
+			machines[actor] = m
+		}
+		return m
+	}
+	addState := func(m *ActorStateMachine, state string) {
+		if state == "" || seen[m.Actor+"|"+state] {
+			return
+		}
+		seen[m.Actor+"|"+state] = true
+		m.States = append(m.States, state)
+	}
+
+	for _, query := range []string{
+		"actor_state(Actor, State, _).",
+		"actor_initial(Actor, State).",
+	} {
+		initial := strings.HasPrefix(query, "actor_initial")
+		err := e.extract(ctx, query, func(sols *prolog.Solutions) error {
+			var result struct {
+				Actor interface{}
+				State interface{}
+			}
+			if err := sols.Scan(&result); err != nil {
+				return err
+			}
+			actor := termToString(result.Actor)
+			if actor == "" {
+				return nil
+			}
+			m := machine(actor)
+			state := termToString(result.State)
+			addState(m, state)
+			if initial && m.Initial == "" {
+				m.Initial = state
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := e.extract(ctx, "actor_transition(Actor, From, Label, To).", func(sols *prolog.Solutions) error {
+		var result struct {
+			Actor interface{}
+			From  interface{}
+			Label interface{}
+			To    interface{}
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		actor := termToString(result.Actor)
+		if actor == "" {
+			return nil
+		}
+		m := machine(actor)
+		t := Transition{
+			From:  termToString(result.From),
+			Label: termToString(result.Label),
+			To:    termToString(result.To),
+		}
+		m.Transitions = append(m.Transitions, t)
+		addState(m, t.From)
+		addState(m, t.To)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]ActorStateMachine, 0, len(machines))
+	for _, m := range machines {
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Actor < out[j].Actor })
+	return out, nil
+}
+
+// Param is a tunable number declared by param/2
+type Param struct {
+	Name    string  `json:"name"`
+	Default float64 `json:"default"`
+}
+
+// GetParams extracts param/2 declarations
+func (e *Engine) GetParams(ctx context.Context) ([]Param, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var params []Param
+	err := e.extract(ctx, "param(Name, Default).", func(sols *prolog.Solutions) error {
+		var result struct {
+			Name    interface{}
+			Default Number
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		params = append(params, Param{
+			Name:    termToString(result.Name),
+			Default: float64(result.Default),
+		})
+		return nil
+	})
+	return params, err
+}
+
+// SetParams overrides param/2 defaults for every later query on this
+// engine. Each name must be declared by param/2. An empty map clears the
+// overrides.
+func (e *Engine) SetParams(ctx context.Context, values map[string]float64) error {
+	declared, err := e.GetParams(ctx)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(declared))
+	for _, p := range declared {
+		known[p.Name] = true
+	}
+	for name := range values {
+		if !known[name] {
+			return fmt.Errorf("unknown param %s (declare it with param/2)", name)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.interpreter.Exec(":- retractall(param_override(_, _))."); err != nil {
+		return err
+	}
+	e.params, e.snapshot = nil, nil
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := e.exec(":- assertz(param_override(?, ?)).", name, values[name]); err != nil {
+			return err
+		}
+	}
+	if len(values) > 0 {
+		e.params = make(map[string]float64, len(values))
+		for name, v := range values {
+			e.params[name] = v
+		}
+	}
+	return nil
+}
+
+// Clone returns a new engine with the same spec, version, sandbox and
+// param overrides, so a request can override params or assert facts
+// without affecting others. It is an engine from e's Snapshot.
+func (e *Engine) Clone() (*Engine, error) {
+	return e.Snapshot().Engine()
+}
+
+// Fresh returns a new engine with the same logger, output, version and
+// sandbox as e, but no spec loaded
+func (e *Engine) Fresh() (*Engine, error) {
+	e.mu.RLock()
+	opts := e.options()
+	e.mu.RUnlock()
+	return New(opts...)
+}
+
+// options returns the options to create an engine like e. Callers must
+// hold e.mu.
+func (e *Engine) options() []Option {
+	opts := []Option{WithLogger(e.logger), WithOutput(e.output), WithVersion(e.version)}
+	if e.sandbox != nil {
+		opts = append(opts, WithSandbox(e.sandbox.limits))
+	}
+	return opts
+}
+
+// TransitionProb is a transition_prob/4 declaration with its probability
+// evaluated. Prob is NaN when the expression cannot be evaluated, and Expr
+// keeps the declared expression for error messages.
+type TransitionProb struct {
+	From  string  `json:"from"`
+	Label string  `json:"label"`
+	To    string  `json:"to"`
+	Prob  float64 `json:"prob"`
+	Expr  string  `json:"expr"`
+}
+
+// GetTransitionProbabilities extracts transition_prob/4 declarations,
+// evaluating param(Name) references and arithmetic
+func (e *Engine) GetTransitionProbabilities(ctx context.Context) ([]TransitionProb, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var probs []TransitionProb
+	err := e.extract(ctx, "transition_prob(From, Label, To, Expr), "+
+		"(catch((param_expr(Expr, X), P is X), _, fail) -> Prob = P ; Prob = invalid).", func(sols *prolog.Solutions) error {
+		var result struct {
+			From  interface{}
+			Label interface{}
+			To    interface{}
+			Expr  prolog.TermString
+			Prob  interface{}
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		p := TransitionProb{
+			From:  termToString(result.From),
+			Label: termToString(result.Label),
+			To:    termToString(result.To),
+			Prob:  math.NaN(),
+			Expr:  string(result.Expr),
+		}
+		switch v := result.Prob.(type) {
+		case int64, float64, int:
+			p.Prob = termToFloat(v)
+		}
+		probs = append(probs, p)
+		return nil
+	})
+	return probs, err
+}
+
+// TransitionDuration declares the simulated time distribution of a transition
+type TransitionDuration struct {
+	From  string `json:"from"`
+	Label string `json:"label"`
+	To    string `json:"to"`
+	Dist  string `json:"dist"`
+}
+
+// GetTransitionDurations extracts transition_duration/4 declarations
+func (e *Engine) GetTransitionDurations(ctx context.Context) ([]TransitionDuration, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var durations []TransitionDuration
+	err := e.extract(ctx, "transition_duration(From, Label, To, D), param_dist(D, Dist).", func(sols *prolog.Solutions) error {
+		var result struct {
+			From  interface{}
+			Label interface{}
+			To    interface{}
+			Dist  prolog.TermString
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		durations = append(durations, TransitionDuration{
+			From:  termToString(result.From),
+			Label: termToString(result.Label),
+			To:    termToString(result.To),
+			Dist:  string(result.Dist),
+		})
+		return nil
+	})
+	return durations, err
+}
+
+// TransitionTime bounds the time a transition with a transition_duration/4
+// declaration takes. Max is +Inf for unbounded distributions.
+type TransitionTime struct {
+	From  string
+	Label string
+	To    string
+	Min   float64
+	Max   float64
+}
+
+// GetTransitionTimes extracts the least and greatest time of each transition
+// with a declared duration, as used by the time-bounded CTL operators
+func (e *Engine) GetTransitionTimes(ctx context.Context) ([]TransitionTime, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var times []TransitionTime
+	err := e.extract(ctx, "transition_duration(From, Label, To, _), transition_time(From, Label, To, Min, Max).", func(sols *prolog.Solutions) error {
+		var result struct {
+			From  interface{}
+			Label interface{}
+			To    interface{}
+			Min   Number
+			Max   interface{}
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		t := TransitionTime{
+			From:  termToString(result.From),
+			Label: termToString(result.Label),
+			To:    termToString(result.To),
+			Min:   float64(result.Min),
+			Max:   termToFloat(result.Max),
+		}
+		if termToString(result.Max) == "inf" {
+			t.Max = math.Inf(1)
+		}
+		times = append(times, t)
+		return nil
+	})
+	return times, err
+}
+
+// RandomVar declares a named random variable drawn independently for each actor
+type RandomVar struct {
+	Name string `json:"name"`
+	Dist string `json:"dist"`
+}
+
+// GetRandomVars extracts random_var/2 declarations
+func (e *Engine) GetRandomVars(ctx context.Context) ([]RandomVar, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var vars []RandomVar
+	err := e.extract(ctx, "random_var(Name, D), param_dist(D, Dist).", func(sols *prolog.Solutions) error {
+		var result struct {
+			Name interface{}
+			Dist prolog.TermString
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		vars = append(vars, RandomVar{
+			Name: termToString(result.Name),
+			Dist: string(result.Dist),
+		})
+		return nil
+	})
+	return vars, err
+}
+
+// TransitionPriority declares a transition's priority for the priority scheduler
+type TransitionPriority struct {
+	From     string  `json:"from"`
+	Label    string  `json:"label"`
+	To       string  `json:"to"`
+	Priority float64 `json:"priority"`
+}
+
+// GetTransitionPriorities extracts transition_priority/4 declarations
+func (e *Engine) GetTransitionPriorities(ctx context.Context) ([]TransitionPriority, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var priorities []TransitionPriority
+	err := e.extract(ctx, "transition_priority(From, Label, To, Priority).", func(sols *prolog.Solutions) error {
+		var result struct {
+			From     interface{}
+			Label    interface{}
+			To       interface{}
+			Priority Number
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		priorities = append(priorities, TransitionPriority{
+			From:     termToString(result.From),
+			Label:    termToString(result.Label),
+			To:       termToString(result.To),
+			Priority: float64(result.Priority),
+		})
+		return nil
+	})
+	return priorities, err
+}
+
+// Accumulator declares a simulation variable and its initial value
+type Accumulator struct {
+	Name    string  `json:"name"`
+	Initial float64 `json:"initial"`
+}
+
+// GetAccumulators extracts accumulator/2 declarations
+func (e *Engine) GetAccumulators(ctx context.Context) ([]Accumulator, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var accumulators []Accumulator
+	err := e.extract(ctx, "accumulator(Name, Initial).", func(sols *prolog.Solutions) error {
+		var result struct {
+			Name    interface{}
+			Initial Number
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		accumulators = append(accumulators, Accumulator{
+			Name:    termToString(result.Name),
+			Initial: float64(result.Initial),
+		})
+		return nil
+	})
+	return accumulators, err
+}
+
+// Reward adds Amount to an accumulator each time a transition labelled Label fires
+type Reward struct {
+	Name   string  `json:"name"`
+	Label  string  `json:"label"`
+	Amount float64 `json:"amount"`
+}
+
+// GetRewards extracts reward/3 declarations
+func (e *Engine) GetRewards(ctx context.Context) ([]Reward, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var rewards []Reward
+	err := e.extract(ctx, "reward(Name, Label, Amount).", func(sols *prolog.Solutions) error {
+		var result struct {
+			Name   interface{}
+			Label  interface{}
+			Amount Number
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		rewards = append(rewards, Reward{
+			Name:   termToString(result.Name),
+			Label:  termToString(result.Label),
+			Amount: float64(result.Amount),
+		})
+		return nil
+	})
+	return rewards, err
+}
+
+// ChannelDecl declares a channel and its buffer capacity
+type ChannelDecl struct {
+	Name     string `json:"name"`
+	Capacity int    `json:"capacity"`
+}
+
+// GetChannels extracts channel/2 declarations
+func (e *Engine) GetChannels(ctx context.Context) ([]ChannelDecl, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var channels []ChannelDecl
+	err := e.extract(ctx, "channel(Name, Capacity).", func(sols *prolog.Solutions) error {
+		var result struct {
+			Name     interface{}
+			Capacity int
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		channels = append(channels, ChannelDecl{
+			Name:     termToString(result.Name),
+			Capacity: result.Capacity,
+		})
+		return nil
+	})
+	return channels, err
+}
+
+// ChannelOp is a send/4 or recv/4 fact: moving from From to To sends or
+// receives Msg on Channel
+type ChannelOp struct {
+	Channel string `json:"channel"`
+	Msg     string `json:"msg"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// GetChannelOps extracts send/4 and recv/4 facts
+func (e *Engine) GetChannelOps(ctx context.Context) (sends []ChannelOp, recvs []ChannelOp, err error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if sends, err = e.channelOps(ctx, "send"); err != nil {
+		return nil, nil, err
+	}
+	if recvs, err = e.channelOps(ctx, "recv"); err != nil {
+		return nil, nil, err
+	}
+	return sends, recvs, nil
+}
+
+func (e *Engine) channelOps(ctx context.Context, pred string) ([]ChannelOp, error) {
+	var ops []ChannelOp
+	err := e.extract(ctx, pred+"(Channel, Msg, From, To).", func(sols *prolog.Solutions) error {
+		var result struct {
+			Channel interface{}
+			Msg     interface{}
+			From    interface{}
+			To      interface{}
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		ops = append(ops, ChannelOp{
+			Channel: termToString(result.Channel),
+			Msg:     termToString(result.Msg),
+			From:    termToString(result.From),
+			To:      termToString(result.To),
+		})
+		return nil
+	})
+	return ops, err
+}
+
+// GetProgress returns the states and labels marked by progress/1
+func (e *Engine) GetProgress(ctx context.Context) ([]string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var names []string
+	err := e.extract(ctx, "progress(Name).", func(sols *prolog.Solutions) error {
+		var result struct {
+			Name interface{}
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		names = append(names, termToString(result.Name))
+		return nil
+	})
+	return names, err
+}
+
+// GetStateProps returns the prop/2 atomic propositions of each given state
+func (e *Engine) GetStateProps(ctx context.Context, states []string) (map[string][]string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	props := make(map[string][]string, len(states))
+	for _, state := range states {
+		seen := make(map[string]bool)
+		query, err := bind("prop(?, Prop).", []interface{}{state})
+		if err != nil {
+			return nil, err
+		}
+		err = e.extract(ctx, query, func(sols *prolog.Solutions) error {
+			var result struct {
+				Prop interface{}
+			}
+			if err := sols.Scan(&result); err != nil {
+				return err
+			}
+			if p := termToString(result.Prop); p != "" && !seen[p] {
+				seen[p] = true
+				props[state] = append(props[state], p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return props, nil
+}
+
+// Verdict is whether one state satisfies a formula
+type Verdict struct {
+	State     string `json:"state"`
+	Satisfied bool   `json:"satisfied"`
+}
+
+// StateCheck is a formula checked at every state of transition/3
+type StateCheck struct {
+	// Initial holds the verdict at each initial/1 state
+	Initial    []Verdict `json:"initial"`
+	Satisfying []string  `json:"satisfying"`
+	Violating  []string  `json:"violating"`
+}
+
+// Satisfied reports whether some initial state satisfies the formula, as
+// check_ctl/1 and check_mu/1 require
+func (c *StateCheck) Satisfied() bool {
+	for _, v := range c.Initial {
+		if v.Satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+// SatisfiedAll reports whether every initial state satisfies the formula,
+// as check_ctl_all/1 and check_mu_all/1 require
+func (c *StateCheck) SatisfiedAll() bool {
+	for _, v := range c.Initial {
+		if !v.Satisfied {
+			return false
+		}
+	}
+	return len(c.Initial) > 0
+}
+
+// CheckStates checks a formula, in term syntax, at every state of
+// transition/3: with ctl_sat/2, or with the mu-calculus when mu is set.
+// The formula is bound as an atom and read as a single term, so whatever
+// its text, it is only ever checked, never run.
+func (e *Engine) CheckStates(ctx context.Context, formula string, mu bool) (*StateCheck, error) {
+	pred := "ctl_state_sat"
+	if mu {
+		pred = "mu_state_sat"
+	}
+	query, err := bind("read_term_from_atom(?, F, []), "+pred+"(F, State, Sat).", []interface{}{formula})
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	check := &StateCheck{Initial: []Verdict{}, Satisfying: []string{}, Violating: []string{}}
+	sat := make(map[string]bool)
+	err = e.solve(ctx, query, func(sols *prolog.Solutions) error {
+		var result struct {
+			State interface{}
+			Sat   interface{}
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		state := termToString(result.State)
+		sat[state] = termToString(result.Sat) == "true"
+		if sat[state] {
+			check.Satisfying = append(check.Satisfying, state)
+		} else {
+			check.Violating = append(check.Violating, state)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	err = e.extract(ctx, "initial(S).", func(sols *prolog.Solutions) error {
+		var result struct {
+			S interface{}
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		if state := termToString(result.S); !seen[state] {
+			seen[state] = true
+			check.Initial = append(check.Initial, Verdict{State: state, Satisfied: sat[state]})
+		}
+		return nil
+	})
+	return check, err
+}
+
+// Fingerprint hashes the solutions of each goal, so callers can tell when
+// the facts they depend on change. Goals that raise an error, such as those
+// over undefined predicates, count as having no solutions.
+func (e *Engine) Fingerprint(ctx context.Context, goals []string) (string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	h := sha256.New()
+	for _, goal := range goals {
+		fmt.Fprintf(h, "%s\n", goal)
+		sols, err := e.interpreter.QueryContext(e.limited(ctx), fmt.Sprintf("Goal = %s, call(Goal).", goal))
+		if err != nil {
+			return "", err
 		}
 		for sols.Next() {
 			var result struct {
-				Name interface{}
+				Goal prolog.TermString
 			}
 			if err := sols.Scan(&result); err == nil {
-				name := termToString(result.Name)
-				if name == "" || seen[name] {
-					continue
-				}
-				seen[name] = true
-				actors = append(actors, name)
+				fmt.Fprintf(h, "%s\n", result.Goal)
 			}
 		}
 		sols.Close()
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
 	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
 
-	return actors, nil
+// GetPropNames returns every state and prop named by prop/2, including
+// states no transition currently reaches
+func (e *Engine) GetPropNames(ctx context.Context) ([]string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var names []string
+	err := e.extract(ctx, "prop(State, Prop).", func(sols *prolog.Solutions) error {
+		var result struct {
+			State interface{}
+			Prop  interface{}
+		}
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		for _, v := range []interface{}{result.State, result.Prop} {
+			if name := termToString(v); name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// DefaultFaultProbability is the per-step probability the simulator uses for
+// fault declarations that do not give one
+const DefaultFaultProbability = 0.1
+
+// ChannelFault declares that a channel may lose, duplicate or reorder messages
+type ChannelFault struct {
+	Channel     string  `json:"channel"`
+	Kind        string  `json:"kind"`
+	Probability float64 `json:"probability"`
+}
+
+// CrashFault declares that an actor may crash and restart in Recovery
+type CrashFault struct {
+	Actor       string  `json:"actor"`
+	Recovery    string  `json:"recovery"`
+	Probability float64 `json:"probability"`
+}
+
+// Partition declares that messages between two groups of actors may be dropped
+type Partition struct {
+	A           []string `json:"a"`
+	B           []string `json:"b"`
+	Probability float64  `json:"probability"`
+}
+
+// Faults collects the fault model declared by a spec
+type Faults struct {
+	Channels   []ChannelFault `json:"channels"`
+	Crashes    []CrashFault   `json:"crashes"`
+	Partitions []Partition    `json:"partitions"`
+}
+
+// Empty reports whether no faults are declared
+func (f Faults) Empty() bool {
+	return len(f.Channels) == 0 && len(f.Crashes) == 0 && len(f.Partitions) == 0
+}
+
+// GetFaults extracts channel_fault, actor_may_crash and partition
+// declarations in both their /2 and /3 forms
+func (e *Engine) GetFaults(ctx context.Context) (Faults, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var faults Faults
+
+	for _, query := range []string{"channel_fault(A, B), P = default.", "channel_fault(A, B, P)."} {
+		decls, err := e.faultDecls(ctx, query)
+		if err != nil {
+			return Faults{}, err
+		}
+		for _, r := range decls {
+			faults.Channels = append(faults.Channels, ChannelFault{
+				Channel:     termToString(r.A),
+				Kind:        termToString(r.B),
+				Probability: r.probability(),
+			})
+		}
+	}
+	for _, query := range []string{"actor_may_crash(A, B), P = default.", "actor_may_crash(A, B, P)."} {
+		decls, err := e.faultDecls(ctx, query)
+		if err != nil {
+			return Faults{}, err
+		}
+		for _, r := range decls {
+			faults.Crashes = append(faults.Crashes, CrashFault{
+				Actor:       termToString(r.A),
+				Recovery:    termToString(r.B),
+				Probability: r.probability(),
+			})
+		}
+	}
+	for _, query := range []string{"partition(A, B), P = default.", "partition(A, B, P)."} {
+		decls, err := e.faultDecls(ctx, query)
+		if err != nil {
+			return Faults{}, err
+		}
+		for _, r := range decls {
+			faults.Partitions = append(faults.Partitions, Partition{
+				A:           termToAtoms(r.A),
+				B:           termToAtoms(r.B),
+				Probability: r.probability(),
+			})
+		}
+	}
+
+	return faults, nil
+}
+
+type faultDecl struct {
+	A interface{}
+	B interface{}
+	P interface{}
+}
+
+func (r faultDecl) probability() float64 {
+	if termToString(r.P) == "default" {
+		return DefaultFaultProbability
+	}
+	return termToFloat(r.P)
+}
+
+func (e *Engine) faultDecls(ctx context.Context, query string) ([]faultDecl, error) {
+	var decls []faultDecl
+	err := e.extract(ctx, query, func(sols *prolog.Solutions) error {
+		var result faultDecl
+		if err := sols.Scan(&result); err != nil {
+			return err
+		}
+		decls = append(decls, result)
+		return nil
+	})
+	return decls, err
+}
+
+// termToAtoms converts a list of atoms, or a single atom, to strings
+func termToAtoms(v interface{}) []string {
+	if list, ok := v.([]interface{}); ok {
+		atoms := make([]string, 0, len(list))
+		for _, item := range list {
+			atoms = append(atoms, termToString(item))
+		}
+		return atoms
+	}
+	if atom := termToString(v); atom != "" && atom != "[]" {
+		return []string{atom}
+	}
+	return nil
 }
 
 // PredicateInfo describes a predicate signature.
@@ -1061,7 +2327,7 @@ func (e *Engine) ListPredicates(ctx context.Context) ([]PredicateInfo, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	sols, err := e.interpreter.QueryContext(ctx, "current_predicate(Name/Arity).")
+	sols, err := e.interpreter.QueryContext(e.limited(ctx), "current_predicate(Name/Arity).")
 	if err != nil {
 		return parsePredicatesFromSource(e.specSource), nil
 	}
@@ -1230,9 +2496,16 @@ func (e *Engine) Reset() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	e.interpreter = prolog.New(nil, nil)
-	e.specSource = ""
-	return e.loadCore()
+	e.interpreter = e.newInterpreter()
+	e.specSource, e.specTrusted = "", false
+	e.params, e.snapshot = nil, nil
+	if err := e.loadCore(); err != nil {
+		return err
+	}
+	if e.version == "" {
+		return nil
+	}
+	return e.exec(":- assertz(turducken_version(?)).", e.version)
 }
 
 // AssertTurduckenVersion asserts the running server version.
@@ -1243,30 +2516,18 @@ func (e *Engine) AssertTurduckenVersion(version string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	atom := prologAtom(version)
-	query := fmt.Sprintf("assertz(turducken_version(%s)).", atom)
-	return e.interpreter.Exec(query)
+	e.version, e.snapshot = version, nil
+	return e.exec(":- assertz(turducken_version(?)).", version)
 }
 
-func prologAtom(value string) string {
-	if value == "" {
-		return "''"
-	}
-	for i, r := range value {
-		if (r >= 'a' && r <= 'z') || (i > 0 && ((r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_')) {
-			continue
-		}
-		if i == 0 {
-			break
-		}
-		goto needsQuote
-	}
-	if value[0] >= 'a' && value[0] <= 'z' {
-		return value
+// exec runs clauses and directives, binding args as Query does. Callers
+// must hold e.mu.
+func (e *Engine) exec(source string, args ...interface{}) error {
+	source, err := bind(source, args)
+	if err != nil {
+		return err
 	}
-needsQuote:
-	escaped := strings.ReplaceAll(value, "'", "''")
-	return "'" + escaped + "'"
+	return e.interpreter.ExecContext(e.limited(context.Background()), source)
 }
 
 // RawQuery returns raw string output from a query (for debugging)
@@ -1274,7 +2535,7 @@ func (e *Engine) RawQuery(ctx context.Context, query string) (string, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	sols, err := e.interpreter.QueryContext(ctx, query)
+	sols, err := e.interpreter.QueryContext(e.limited(ctx), query)
 	if err != nil {
 		return "", err
 	}
@@ -1291,12 +2552,18 @@ func (e *Engine) RawQuery(ctx context.Context, query string) (string, error) {
 	return strings.Join(results, "\n"), sols.Err()
 }
 
-// RawQueryBindings returns variable bindings for a query.
-func (e *Engine) RawQueryBindings(ctx context.Context, query string) ([]map[string]string, error) {
+// RawQueryBindings returns variable bindings for a query, binding args as
+// Query does.
+func (e *Engine) RawQueryBindings(ctx context.Context, query string, args ...interface{}) ([]map[string]string, error) {
+	query, err := bind(query, args)
+	if err != nil {
+		return nil, err
+	}
+
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	sols, err := e.interpreter.QueryContext(ctx, query)
+	sols, err := e.interpreter.QueryContext(e.limited(ctx), query)
 	if err != nil {
 		return nil, err
 	}
@@ -1320,3 +2587,29 @@ func (e *Engine) RawQueryBindings(ctx context.Context, query string) ([]map[stri
 	}
 	return bindings, nil
 }
+
+// RawQueryTerms returns variable bindings for a query in the structured
+// JSON term encoding (see JSONTerm), binding args as Query does.
+func (e *Engine) RawQueryTerms(ctx context.Context, query string, args ...interface{}) ([]map[string]JSONTerm, error) {
+	query, err := bind(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var bindings []map[string]JSONTerm
+	err = e.solve(ctx, query, func(sols *prolog.Solutions) error {
+		row := map[string]JSONTerm{}
+		if err := sols.Scan(&row); err != nil {
+			return err
+		}
+		bindings = append(bindings, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bindings, nil
+}
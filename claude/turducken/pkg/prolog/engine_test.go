@@ -2,6 +2,8 @@ package prolog
 
 import (
 	"context"
+	"math"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -175,6 +177,282 @@ func TestCTLCombinators(t *testing.T) {
 	}
 }
 
+func TestCheckStates(t *testing.T) {
+	e, _ := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Two actors, each with its own initial state; only the client can
+	// reach done
+	e.LoadSpec(`
+        initial(client_idle).
+        initial(server_idle).
+        transition(client_idle, go, client_done).
+        transition(server_idle, wait, server_idle).
+        prop(client_done, done).
+    `)
+
+	for _, check := range []struct {
+		query    string
+		expected bool
+	}{
+		{"check_ctl(ef(atom(done))).", true},
+		{"check_ctl_all(ef(atom(done))).", false},
+		{"check_ctl_all(not(atom(done))).", true},
+		{"check_mu(diamond(go, atom(done))).", true},
+		{"check_mu_all(diamond(go, atom(done))).", false},
+	} {
+		result, err := e.QueryOne(ctx, check.query)
+		if err != nil {
+			t.Fatalf("%s error: %v", check.query, err)
+		}
+		if result != check.expected {
+			t.Errorf("%s = %v, want %v", check.query, result, check.expected)
+		}
+	}
+
+	for _, mu := range []bool{false, true} {
+		check, err := e.CheckStates(ctx, "ef(atom(done))", mu)
+		if err != nil {
+			t.Fatalf("CheckStates error: %v", err)
+		}
+		want := []Verdict{{"client_idle", true}, {"server_idle", false}}
+		if !reflect.DeepEqual(check.Initial, want) {
+			t.Errorf("mu=%v: expected verdicts %v, got %v", mu, want, check.Initial)
+		}
+		if !reflect.DeepEqual(check.Satisfying, []string{"client_done", "client_idle"}) ||
+			!reflect.DeepEqual(check.Violating, []string{"server_idle"}) {
+			t.Errorf("mu=%v: unexpected satisfaction sets %v / %v", mu, check.Satisfying, check.Violating)
+		}
+		if !check.Satisfied() || check.SatisfiedAll() {
+			t.Errorf("mu=%v: expected some but not every initial state to satisfy", mu)
+		}
+	}
+
+	// Fixpoint variables survive binding, since the formula is read as one term
+	check, err := e.CheckStates(ctx, "mu(X, or(atom(done), diamond(any, X)))", true)
+	if err != nil {
+		t.Fatalf("CheckStates fixpoint error: %v", err)
+	}
+	if !reflect.DeepEqual(check.Satisfying, []string{"client_done", "client_idle"}) {
+		t.Errorf("fixpoint: unexpected satisfying states %v", check.Satisfying)
+	}
+
+	// Formula text is only ever checked, so goals spliced into it never run
+	for _, formula := range []string{
+		"atom(done)), assertz(injected(1)), ctl_state_sat(S, atom(done)",
+		"ef(atom(done)), assertz(injected(1))",
+		"ef(atom(done)). :- assertz(injected(1))",
+	} {
+		e.CheckStates(ctx, formula, false)
+		if injected, _ := e.QueryOne(ctx, "catch(injected(_), _, fail)."); injected {
+			t.Fatalf("formula %q ran an injected goal", formula)
+		}
+	}
+}
+
+func TestCTLWeakUntilAndRelease(t *testing.T) {
+	e, _ := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// s0 -> s1 -> s1 (loop), s0 -> s2 (deadlock)
+	e.LoadSpec(`
+        initial(s0).
+        transition(s0, a, s1).
+        transition(s0, b, s2).
+        transition(s1, loop, s1).
+        prop(s0, start).
+        prop(s1, p).
+        prop(s2, q).
+    `)
+
+	tests := []struct {
+		formula  string
+		expected bool
+	}{
+		{"iff(atom(p), ex(atom(p)))", false},
+		{"iff(atom(q), atom(p))", true},
+		{"ew(atom(start), atom(q))", true},
+		{"aw(not(atom(q)), atom(p))", false},
+		{"aw(atom(start), or(atom(p), atom(q)))", true},
+		{"er(atom(q), not(atom(p)))", true},
+		{"ar(atom(q), not(atom(p)))", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.formula, func(t *testing.T) {
+			for _, check := range []string{"check_ctl", "check_mu"} {
+				result, err := e.QueryOne(ctx, check+"("+tt.formula+").")
+				if err != nil {
+					t.Fatalf("%s error: %v", check, err)
+				}
+				if result != tt.expected {
+					t.Errorf("%s(%s) = %v, want %v", check, tt.formula, result, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestBoundedCTLOperators(t *testing.T) {
+	e, _ := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A vote commits after 2 steps, or times out and aborts after 3
+	e.LoadSpec(`
+        initial(idle).
+        transition(idle, request, voting).
+        transition(voting, yes, committed).
+        transition(voting, wait, waiting).
+        transition(waiting, timeout, aborted).
+        transition_duration(idle, request, voting, const(1)).
+        transition_duration(voting, yes, committed, uniform(1, 2)).
+        transition_duration(voting, wait, waiting, const(3)).
+        transition_duration(waiting, timeout, aborted, exp(0.5)).
+        prop(committed, decided).
+        prop(aborted, decided).
+        prop(committed, committed).
+        prop(waiting, waiting).
+    `)
+
+	tests := []struct {
+		formula  string
+		expected bool
+	}{
+		{"ef_le(2, atom(decided))", true},
+		{"ef_le(1, atom(decided))", false},
+		{"af_le(3, atom(decided))", true},
+		{"af_le(2, atom(decided))", false},
+		{"eg_le(2, not(atom(decided)))", true},
+		{"eg_le(3, not(atom(decided)))", false},
+		{"ag_le(1, not(atom(decided)))", true},
+		{"ag_le(2, not(atom(decided)))", false},
+		{"eu_le(2, not(atom(waiting)), atom(committed))", true},
+		{"au_le(3, true, atom(decided))", true},
+		{"ef_le(-1, atom(decided))", false},
+		{"ef_within(2, atom(committed))", true},
+		{"ef_within(1.5, atom(committed))", false},
+		{"ef_within(4, atom(waiting))", true},
+		{"af_within(4, or(atom(committed), atom(waiting)))", true},
+		{"af_within(3.5, or(atom(committed), atom(waiting)))", false},
+		{"af_within(100, atom(decided))", false}, // the timeout is unbounded
+		{"ag_within(1.5, not(atom(decided)))", true},
+		{"ag_within(2, not(atom(decided)))", false},
+		{"eu_within(2, not(atom(waiting)), atom(committed))", true},
+		{"au_within(4, not(atom(decided)), or(atom(committed), atom(waiting)))", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.formula, func(t *testing.T) {
+			result, err := e.QueryOne(ctx, "check_ctl("+tt.formula+").")
+			if err != nil {
+				t.Fatalf("QueryOne error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("check_ctl(%s) = %v, want %v", tt.formula, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMuCalculus(t *testing.T) {
+	e, _ := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The coordinator may resend prepare forever, or give up and stop
+	e.LoadSpec(`
+        initial(idle).
+        transition(idle, send_prepare, prepared).
+        transition(prepared, timeout, idle).
+        transition(prepared, commit, done).
+        transition(idle, give_up, stopped).
+        prop(done, finished).
+        prop(stopped, finished).
+    `)
+
+	tests := []struct {
+		name     string
+		formula  string
+		expected bool
+	}{
+		{"diamond label", "diamond(send_prepare, true)", true},
+		{"diamond wrong label", "diamond(commit, true)", false},
+		{"box label", "box(give_up, atom(finished))", true},
+		{"box any", "box(any, atom(finished))", false},
+		{"action list", "diamond([commit, give_up], atom(finished))", true},
+		{"action complement", "box(not(send_prepare), atom(finished))", true},
+		{"reachability", "mu(X, or(atom(finished), diamond(any, X)))", true},
+		{"infinitely often send_prepare", "nu(X, mu(Y, or(diamond(send_prepare, X), diamond(any, Y))))", true},
+		{"always eventually finished", "nu(X, and(mu(Y, or(atom(finished), box(any, Y))), box(any, X)))", false},
+		{"commit on every path", "mu(X, or(diamond(commit, true), and(box(any, X), diamond(any, true))))", false},
+		{"CTL translated", "ag(ef(atom(finished)))", true},
+		{"CTL mixed", "and(ef(atom(finished)), diamond(send_prepare, ex(atom(finished))))", true},
+		{"CTL af", "af(atom(finished))", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := e.QueryOne(ctx, "check_mu("+tt.formula+").")
+			if err != nil {
+				t.Fatalf("QueryOne error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("check_mu(%s) = %v, want %v", tt.formula, result, tt.expected)
+			}
+		})
+	}
+
+	// The translation agrees with check_ctl/1
+	for _, formula := range []string{"ef(atom(finished))", "af(atom(finished))", "eg(not(atom(finished)))",
+		"ag(not(atom(finished)))", "eu(not(atom(finished)), atom(finished))", "au(true, atom(finished))",
+		"ax(not(atom(finished)))"} {
+		ctl, err := e.QueryOne(ctx, "check_ctl("+formula+").")
+		if err != nil {
+			t.Fatalf("check_ctl error: %v", err)
+		}
+		mu, err := e.QueryOne(ctx, "check_mu("+formula+").")
+		if err != nil {
+			t.Fatalf("check_mu error: %v", err)
+		}
+		if ctl != mu {
+			t.Errorf("%s: check_ctl = %v but check_mu = %v", formula, ctl, mu)
+		}
+	}
+
+	if _, err := e.QueryOne(ctx, "check_mu(eventually(atom(finished)))."); err == nil {
+		t.Errorf("expected an unknown operator to be an error")
+	}
+}
+
+func TestGetTransitionTimes(t *testing.T) {
+	e, _ := New()
+	e.LoadSpec(`
+        param(timeout, 4).
+        transition(a, go, b).
+        transition(b, back, a).
+        transition(b, wait, b).
+        transition_duration(a, go, b, uniform(1, param(timeout))).
+        transition_duration(b, back, a, exp(2)).
+    `)
+
+	times, err := e.GetTransitionTimes(context.Background())
+	if err != nil {
+		t.Fatalf("GetTransitionTimes error: %v", err)
+	}
+	if len(times) != 2 {
+		t.Fatalf("expected 2 declared durations, got %+v", times)
+	}
+	if times[0].Min != 1 || times[0].Max != 4 {
+		t.Errorf("expected go to take 1 to 4, got %+v", times[0])
+	}
+	if times[1].Min != 0 || !math.IsInf(times[1].Max, 1) {
+		t.Errorf("expected back to be unbounded, got %+v", times[1])
+	}
+}
+
 func TestSequenceDiagram(t *testing.T) {
 	e, _ := New()
 	ctx := context.Background()
@@ -433,3 +711,126 @@ func TestActorStateMachines(t *testing.T) {
 	// This test serves as documentation of what needs to be implemented
 	t.Logf("Got %d transitions (actor_transition not yet implemented)", len(sm.Transitions))
 }
+
+func TestStateActorsAndDurations(t *testing.T) {
+	e, _ := New()
+	ctx := context.Background()
+
+	e.LoadSpec(`
+        actor_initial(oven, cold).
+        actor_transition(oven, cold, heat, hot).
+        actor_state(clerk, waiting, []).
+        transition_duration(cold, heat, hot, uniform(2, 4)).
+    `)
+
+	actors, err := e.GetStateActors(ctx)
+	if err != nil {
+		t.Fatalf("GetStateActors error: %v", err)
+	}
+	if actors["cold"] != "oven" || actors["hot"] != "oven" || actors["waiting"] != "clerk" {
+		t.Errorf("unexpected state actors %v", actors)
+	}
+
+	durations, err := e.GetTransitionDurations(ctx)
+	if err != nil {
+		t.Fatalf("GetTransitionDurations error: %v", err)
+	}
+	if len(durations) != 1 || durations[0].Dist != "uniform(2,4)" {
+		t.Errorf("unexpected durations %+v", durations)
+	}
+}
+
+func TestGetActorStateMachines(t *testing.T) {
+	e, _ := New()
+	ctx := context.Background()
+
+	// Facts are grouped by predicate; interleaving them across actors trips
+	// the interpreter's discontiguous check (see TestActorStateMachines).
+	if err := e.LoadSpec(`
+        actor_initial(engine, idle).
+        actor_initial(ui, waiting).
+        actor_state(ui, stuck, []).
+        actor_transition(engine, idle, start, running).
+        actor_transition(engine, running, stop, idle).
+        actor_transition(ui, waiting, click, processing).
+    `); err != nil {
+		t.Fatalf("LoadSpec error: %v", err)
+	}
+
+	machines, err := e.GetActorStateMachines(ctx)
+	if err != nil {
+		t.Fatalf("GetActorStateMachines error: %v", err)
+	}
+	if len(machines) != 2 || machines[0].Actor != "engine" || machines[1].Actor != "ui" {
+		t.Fatalf("expected engine and ui machines, got %+v", machines)
+	}
+	engine, ui := machines[0], machines[1]
+	if engine.Initial != "idle" || len(engine.States) != 2 || len(engine.Transitions) != 2 {
+		t.Errorf("unexpected engine machine %+v", engine)
+	}
+	if ui.Initial != "waiting" || len(ui.States) != 3 || len(ui.Transitions) != 1 {
+		t.Errorf("expected ui to include the declared stuck state, got %+v", ui)
+	}
+}
+
+func TestParamsOverridesAndClone(t *testing.T) {
+	e, _ := New()
+	ctx := context.Background()
+
+	if err := e.LoadSpec(`
+        param(p_buy, 0.25).
+        param(mean_wait, 4).
+        transition(waiting, buy, sold_out).
+        transition(waiting, leave, waiting).
+        transition_prob(waiting, buy, sold_out, param(p_buy)).
+        transition_prob(waiting, leave, waiting, 1 - param(p_buy)).
+        transition_duration(waiting, leave, waiting, exp(1 / param(mean_wait))).
+    `); err != nil {
+		t.Fatalf("LoadSpec error: %v", err)
+	}
+
+	params, err := e.GetParams(ctx)
+	if err != nil || len(params) != 2 || params[0].Name != "p_buy" || params[0].Default != 0.25 {
+		t.Fatalf("expected p_buy and mean_wait params, got %+v (%v)", params, err)
+	}
+
+	probOf := func(e *Engine, label string) float64 {
+		t.Helper()
+		probs, err := e.GetTransitionProbabilities(ctx)
+		if err != nil {
+			t.Fatalf("GetTransitionProbabilities error: %v", err)
+		}
+		for _, p := range probs {
+			if p.Label == label {
+				return p.Prob
+			}
+		}
+		t.Fatalf("no transition_prob for %s in %+v", label, probs)
+		return 0
+	}
+	if p := probOf(e, "leave"); p != 0.75 {
+		t.Errorf("expected leave probability 0.75, got %v", p)
+	}
+
+	c, err := e.Clone()
+	if err != nil {
+		t.Fatalf("Clone error: %v", err)
+	}
+	if err := c.SetParams(ctx, map[string]float64{"p_buy": 0.5, "mean_wait": 2}); err != nil {
+		t.Fatalf("SetParams error: %v", err)
+	}
+	if p := probOf(c, "buy"); p != 0.5 {
+		t.Errorf("expected overridden buy probability 0.5, got %v", p)
+	}
+	if p := probOf(e, "buy"); p != 0.25 {
+		t.Errorf("expected the original engine to keep its default, got %v", p)
+	}
+	durations, err := c.GetTransitionDurations(ctx)
+	if err != nil || len(durations) != 1 || durations[0].Dist != "exp(0.5)" {
+		t.Errorf("expected exp(0.5) after the override, got %+v (%v)", durations, err)
+	}
+
+	if err := c.SetParams(ctx, map[string]float64{"missing": 1}); err == nil {
+		t.Errorf("expected an error for an undeclared param")
+	}
+}
@@ -0,0 +1,98 @@
+package prolog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+// QueryInto runs a query and scans every solution into a T. Variables bind
+// to struct fields of the same name, or the name in a `prolog:"Var"` tag,
+// and may also be scanned into a map[string]T. Fields may be string,
+// the int and float types, Number, TermString, []T or interface{}.
+//
+//	type edge struct{ Label, To string }
+//	edges, err := prolog.QueryInto[edge](ctx, e, "transition(?, Label, To).", "idle")
+//
+// Arguments bind to ? placeholders, or to variables as Params, as in Query.
+func QueryInto[T any](ctx context.Context, e *Engine, query string, args ...interface{}) ([]T, error) {
+	query, err := bind(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var out []T
+	err = e.solve(ctx, query, func(sols *prolog.Solutions) error {
+		var v T
+		if err := sols.Scan(&v); err != nil {
+			return err
+		}
+		out = append(out, v)
+		return nil
+	})
+	return out, err
+}
+
+// Number scans an integer or a float binding, keeping fractions
+type Number float64
+
+// Scan implements ichiban/prolog's Scanner interface
+func (n *Number) Scan(vm *engine.VM, term engine.Term, env *engine.Env) error {
+	switch t := env.Resolve(term).(type) {
+	case engine.Integer:
+		*n = Number(t)
+	case engine.Float:
+		*n = Number(t)
+	default:
+		return fmt.Errorf("expected a number, got %T", t)
+	}
+	return nil
+}
+
+// TermString scans any binding as its quoted Prolog text
+type TermString = prolog.TermString
+
+// solve runs a query, calling fn with each solution in turn. Errors from
+// parsing, scanning or running the query are returned with the query.
+// Callers must hold e.mu.
+func (e *Engine) solve(ctx context.Context, query string, fn func(*prolog.Solutions) error) error {
+	sols, err := e.interpreter.QueryContext(e.limited(ctx), query)
+	if err != nil {
+		return fmt.Errorf("query %q: %w", query, err)
+	}
+	defer sols.Close()
+
+	for sols.Next() {
+		if err := fn(sols); err != nil {
+			return fmt.Errorf("query %q: %w", query, err)
+		}
+	}
+	if err := sols.Err(); err != nil {
+		return fmt.Errorf("query %q: %w", query, err)
+	}
+	return nil
+}
+
+// extract is solve for reading a spec's declarations, most of which are
+// optional: a predicate the spec never defines has no solutions rather
+// than raising an existence error
+func (e *Engine) extract(ctx context.Context, query string, fn func(*prolog.Solutions) error) error {
+	if err := e.solve(ctx, query, fn); err != nil && !undefinedProcedure(err) {
+		return err
+	}
+	return nil
+}
+
+// undefinedProcedure reports whether err is an existence error for a
+// procedure, which ichiban/prolog raises when calling an undefined predicate
+func undefinedProcedure(err error) bool {
+	var ex engine.Exception
+	return errors.As(err, &ex) && strings.HasPrefix(ex.Error(), "error(existence_error(procedure,")
+}
@@ -0,0 +1,160 @@
+package prolog
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQueryInto(t *testing.T) {
+	e, err := New(WithSpec(`
+        transition(idle, start, busy).
+        transition(busy, done, idle).
+        weight(idle, 2).
+        weight(busy, 0.5).
+    `))
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	ctx := context.Background()
+
+	type edge struct {
+		From, Label string
+		Target      string `prolog:"To"`
+	}
+	edges, err := QueryInto[edge](ctx, e, "transition(From, Label, To).")
+	if err != nil {
+		t.Fatalf("QueryInto error: %v", err)
+	}
+	want := []edge{{"idle", "start", "busy"}, {"busy", "done", "idle"}}
+	if !reflect.DeepEqual(edges, want) {
+		t.Errorf("expected %v, got %v", want, edges)
+	}
+
+	type weight struct {
+		S string
+		W Number
+		T TermString
+	}
+	weights, err := QueryInto[weight](ctx, e, "weight(S, W), T = w(S, W).")
+	if err != nil {
+		t.Fatalf("QueryInto error: %v", err)
+	}
+	if len(weights) != 2 || weights[0].W != 2 || weights[1].W != 0.5 || weights[1].T != "w(busy,0.5)" {
+		t.Errorf("expected integer and float weights, got %+v", weights)
+	}
+
+	if _, err := QueryInto[weight](ctx, e, "weight(S, W"); err == nil {
+		t.Error("expected a syntax error")
+	}
+	if _, err := QueryInto[weight](ctx, e, "undefined_thing(S, W)."); err == nil {
+		t.Error("expected an existence error")
+	}
+}
+
+func TestExtractionErrors(t *testing.T) {
+	ctx := context.Background()
+
+	// Undeclared predicates are just empty
+	e, _ := New(WithSpec("initial(idle)."))
+	slices, err := e.GetPieChart(ctx)
+	if err != nil || len(slices) != 0 {
+		t.Errorf("expected no slices and no error, got %v, %v", slices, err)
+	}
+
+	// A rule that fails at run time is reported
+	e, _ = New(WithSpec("pie_slice(broken, V) :- V is oops + 1."))
+	if _, err := e.GetPieChart(ctx); err == nil || !strings.Contains(err.Error(), "pie_slice") {
+		t.Errorf("expected the type error to be reported with its query, got %v", err)
+	}
+
+	// Fractional chart values survive extraction
+	e, _ = New(WithSpec("pie_slice(a, 2.5). pie_slice(b, 3)."))
+	slices, err = e.GetPieChart(ctx)
+	if err != nil {
+		t.Fatalf("GetPieChart error: %v", err)
+	}
+	if want := []PieSlice{{"a", 2.5}, {"b", 3}}; !reflect.DeepEqual(slices, want) {
+		t.Errorf("expected %v, got %v", want, slices)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	var out, logs bytes.Buffer
+	e, err := New(
+		WithOutput(&out),
+		WithLogger(log.New(&logs, "", 0)),
+		WithVersion("v1"),
+		WithSpec("transition(a, go, b). initial(a)."),
+	)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := QueryInto[struct{}](ctx, e, "write(hello)."); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	if out.String() != "hello" {
+		t.Errorf("expected output to be captured, got %q", out.String())
+	}
+
+	versions, err := QueryInto[struct{ V string }](ctx, e, "turducken_version(V).")
+	if err != nil || len(versions) != 1 || versions[0].V != "v1" {
+		t.Errorf("expected version v1, got %v, %v", versions, err)
+	}
+
+	if err := e.Reset(); err != nil {
+		t.Fatalf("Reset error: %v", err)
+	}
+	versions, err = QueryInto[struct{ V string }](ctx, e, "turducken_version(V).")
+	if err != nil || len(versions) != 1 {
+		t.Errorf("expected the version to survive Reset, got %v, %v", versions, err)
+	}
+	if err := e.LoadSpec("transition(a, go, b). initial(a)."); err != nil {
+		t.Fatalf("LoadSpec error: %v", err)
+	}
+
+	if _, err := e.GetStateMachine(ctx); err != nil {
+		t.Fatalf("GetStateMachine error: %v", err)
+	}
+	if !strings.Contains(logs.String(), "a --go--> b") {
+		t.Errorf("expected diagnostics in the logger, got %q", logs.String())
+	}
+
+	if _, err := New(WithSpec("broken(")); err == nil {
+		t.Error("expected a bad spec to fail New")
+	}
+}
+
+func TestFresh(t *testing.T) {
+	e, err := New(WithVersion("v1"), WithSandbox(Limits{}), WithSpec("initial(old)."))
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	ctx := context.Background()
+
+	next, err := e.Fresh()
+	if err != nil {
+		t.Fatalf("Fresh error: %v", err)
+	}
+	if ok, err := next.QueryOne(ctx, "turducken_version(v1), \\+ catch(initial(_), _, fail)."); err != nil || !ok {
+		t.Errorf("expected a fresh engine with the version and no spec, got %v, %v", ok, err)
+	}
+	if err := next.LoadSpec("initial(new)."); err != nil {
+		t.Fatalf("LoadSpec error: %v", err)
+	}
+
+	if ok, err := e.QueryOne(ctx, "initial(old), \\+ initial(new)."); err != nil || !ok {
+		t.Errorf("expected loading the fresh engine to leave e alone, got %v, %v", ok, err)
+	}
+	if _, err := next.QueryOne(ctx, "halt."); err == nil {
+		t.Error("expected the fresh engine to stay sandboxed")
+	}
+	if err := next.LoadTrustedSpec(":- set_prolog_flag(unknown, error)."); err != nil {
+		t.Errorf("expected trusted loads to work on the fresh engine, got %v", err)
+	}
+}
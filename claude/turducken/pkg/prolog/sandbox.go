@@ -0,0 +1,416 @@
+package prolog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+// Limits caps the work one query may do in a sandboxed engine. A zero
+// field is no limit.
+type Limits struct {
+	// Inferences caps resolution steps, so infinite loops stop early
+	Inferences int64
+	// TermSize caps the cells in a clause asserted at run time, the arity
+	// of a term built by functor/3, the characters in an atom and the
+	// elements of a list built by atom_concat/3, atom_codes/2, length/2 and
+	// the like, and the cells findall/3, bagof/3 and setof/3 collect
+	TermSize int
+}
+
+// LimitError reports a query stopped by one of the sandbox Limits
+type LimitError struct {
+	Limit string
+	Max   uint64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("resource limit exceeded: %s (max %d)", e.Limit, e.Max)
+}
+
+// WithSandbox restricts what specs and queries may do: filesystem, stream
+// and OS builtins such as consult/1, open/4, read/1 and halt/0 raise
+// permission errors, and every query runs within limits. LoadSpecFile and
+// LoadTrustedSpec still load with the full set of builtins and no limits.
+func WithSandbox(limits Limits) Option {
+	return func(o *options) { o.sandbox = &limits }
+}
+
+// sandbox is what an interpreter's sandbox wrappers consult. It belongs
+// to the interpreter rather than the Engine.
+type sandbox struct {
+	limits Limits
+	// trusted is set while LoadSpecFile or LoadTrustedSpec runs, lifting
+	// the sandbox
+	trusted bool
+}
+
+// sandboxed are the builtins a sandboxed engine denies untrusted code, by
+// name and arity. Wrappers defined in ichiban's bootstrap, such as open/3,
+// read/1 and halt/0, call one of these.
+var sandboxed = map[string][]int{
+	"consult":             {1},
+	"open":                {4},
+	"close":               {2},
+	"set_input":           {1},
+	"set_output":          {1},
+	"set_stream_position": {2},
+	"get_char":            {2},
+	"peek_char":           {2},
+	"get_byte":            {2},
+	"peek_byte":           {2},
+	"read_term":           {3},
+	"halt":                {1},
+	"op":                  {3},
+	"char_conversion":     {2},
+	"set_prolog_flag":     {2},
+}
+
+// newInterpreter creates an interpreter, wrapping builtins when sandboxed
+func (e *Engine) newInterpreter() *prolog.Interpreter {
+	i := prolog.New(nil, e.output)
+	i.Register3(engine.NewAtom("read_term_from_atom"), readTermFromAtom)
+	sb := e.sandbox
+	if sb == nil {
+		return i
+	}
+
+	i.FS = sandboxFS{sb}
+	for name, arities := range sandboxed {
+		name := engine.NewAtom(name)
+		for _, arity := range arities {
+			culprit := engine.NewAtom("/").Apply(name, engine.Integer(arity))
+			deny := func(env *engine.Env) *engine.Promise {
+				return engine.Error(engine.PermissionError(engine.NewAtom("execute"), engine.NewAtom("sandboxed_procedure"), culprit, env))
+			}
+			sb.wrap(i, name, arity, deny)
+		}
+	}
+
+	i.Register3(engine.NewAtom("functor"), func(vm *engine.VM, t, name, arity engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+		if err := sb.checkArity(arity, env); err != nil {
+			return engine.Error(err)
+		}
+		return engine.Functor(vm, t, name, arity, k, env)
+	})
+	for name, assert := range map[string]engine.Predicate1{"assertz": engine.Assertz, "asserta": engine.Asserta} {
+		assert := assert
+		i.Register1(engine.NewAtom(name), func(vm *engine.VM, t engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+			if max := sb.limits.TermSize; max > 0 && !sb.trusted && termSize(t, env, max) > max {
+				return engine.Error(&LimitError{Limit: "term size", Max: uint64(max)})
+			}
+			return assert(vm, t, k, env)
+		})
+	}
+	sb.limitSizes(i)
+	return i
+}
+
+// limitSizes wraps the builtins that build atoms and lists, so none can
+// build one past the term size limit. Each step of a doubling loop such
+// as atom_concat(A, A, B) is a single inference, so the inference limit
+// alone would let a query allocate gigabytes.
+func (sb *sandbox) limitSizes(i *prolog.Interpreter) {
+	for name, p := range map[string]engine.Predicate2{
+		"atom_chars":   engine.AtomChars,
+		"atom_codes":   engine.AtomCodes,
+		"number_chars": engine.NumberChars,
+		"number_codes": engine.NumberCodes,
+	} {
+		p := p
+		i.Register2(engine.NewAtom(name), func(vm *engine.VM, a, b engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+			if err := sb.checkSize(b, env); err != nil {
+				return engine.Error(err)
+			}
+			return p(vm, a, b, sb.sized(k, a), env)
+		})
+	}
+	i.Register3(engine.NewAtom("atom_concat"), func(vm *engine.VM, a, b, c engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+		return engine.AtomConcat(vm, a, b, c, sb.sized(k, c), env)
+	})
+	i.Register5(engine.NewAtom("sub_atom"), func(vm *engine.VM, atom, before, length, after, sub engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+		return engine.SubAtom(vm, atom, before, length, after, sub, sb.sized(k, sub), env)
+	})
+	i.Register2(engine.NewAtom("length"), func(vm *engine.VM, list, length engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+		if err := sb.checkArity(length, env); err != nil {
+			return engine.Error(err)
+		}
+		return engine.Length(vm, list, length, sb.sized(k, list), env)
+	})
+	for name, p := range map[string]engine.Predicate3{"findall": engine.FindAll, "bagof": engine.BagOf, "setof": engine.SetOf} {
+		p, existential := p, name != "findall"
+		i.Register3(engine.NewAtom(name), func(vm *engine.VM, template, goal, instances engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+			if max := sb.limits.TermSize; max > 0 && !sb.trusted {
+				goal = collecting(goal, template, &budget{left: max}, existential, env)
+			}
+			return p(vm, template, goal, instances, k, env)
+		})
+	}
+	i.Register2(engine.NewAtom("$sandbox_collect"), func(vm *engine.VM, t, template engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+		b, ok := env.Resolve(t).(*budget)
+		if !ok {
+			return engine.Error(engine.TypeError(engine.NewAtom("budget"), t, env))
+		}
+		b.left -= termSize(template, env, b.left)
+		if b.left < 0 {
+			return engine.Error(&LimitError{Limit: "term size", Max: uint64(sb.limits.TermSize)})
+		}
+		return k(env)
+	})
+}
+
+// sized continues with k once each of ts is within the term size limit
+func (sb *sandbox) sized(k engine.Cont, ts ...engine.Term) engine.Cont {
+	return func(env *engine.Env) *engine.Promise {
+		for _, t := range ts {
+			if err := sb.checkSize(t, env); err != nil {
+				return engine.Error(err)
+			}
+		}
+		return k(env)
+	}
+}
+
+// checkSize rejects an atom longer than the term size limit, or a term
+// with more cells
+func (sb *sandbox) checkSize(t engine.Term, env *engine.Env) error {
+	max := sb.limits.TermSize
+	if max <= 0 || sb.trusted {
+		return nil
+	}
+	size := 0
+	switch t := env.Resolve(t).(type) {
+	case engine.Atom:
+		size = utf8.RuneCountInString(t.String())
+	case engine.Compound:
+		size = termSize(t, env, max)
+	}
+	if size > max {
+		return &LimitError{Limit: "term size", Max: uint64(max)}
+	}
+	return nil
+}
+
+// budget is the cells a findall/3, bagof/3 or setof/3 call may still
+// collect. It rides along in the goal as an opaque term, so each call
+// has its own even when queries share the interpreter.
+type budget struct{ left int }
+
+func (b *budget) WriteTerm(w io.Writer, _ *engine.WriteOptions, _ *engine.Env) error {
+	_, err := io.WriteString(w, "'$budget'")
+	return err
+}
+
+func (b *budget) Compare(t engine.Term, _ *engine.Env) int {
+	if t == engine.Term(b) {
+		return 0
+	}
+	return 1
+}
+
+// collecting charges each solution of goal to b before it is collected.
+// For bagof/3 and setof/3 the charge goes inside any Var^ prefix, which
+// must stay outermost to mark variables as existential.
+func collecting(goal, template engine.Term, b *budget, existential bool, env *engine.Env) engine.Term {
+	goal = env.Resolve(goal)
+	if c, ok := goal.(engine.Compound); ok && existential && c.Functor() == engine.NewAtom("^") && c.Arity() == 2 {
+		return c.Functor().Apply(c.Arg(0), collecting(c.Arg(1), template, b, existential, env))
+	}
+	return engine.NewAtom(",").Apply(goal, engine.NewAtom("$sandbox_collect").Apply(b, template))
+}
+
+// readTermFromAtom parses an atom's text as one term, up to an optional
+// full stop, so Go can pass a term as a bound atom rather than splicing its
+// text into a query. The term is only read, never called. Options are
+// accepted for compatibility and ignored.
+func readTermFromAtom(vm *engine.VM, atom, term, _ engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+	var text string
+	switch a := env.Resolve(atom).(type) {
+	case engine.Variable:
+		return engine.Error(engine.InstantiationError(env))
+	case engine.Atom:
+		text = a.String()
+	default:
+		return engine.Error(engine.TypeError(engine.NewAtom("atom"), atom, env))
+	}
+	t, err := engine.NewParser(vm, strings.NewReader(strings.TrimSuffix(strings.TrimSpace(text), ".")+" .")).Term()
+	if err != nil {
+		return engine.Error(engine.SyntaxError(engine.NewAtom(err.Error()), env))
+	}
+	return engine.Unify(vm, term, t, k, env)
+}
+
+// trust lifts the sandbox until the returned func is called. Callers must
+// hold e.mu.
+func (e *Engine) trust() func() {
+	if e.sandbox == nil {
+		return func() {}
+	}
+	e.sandbox.trusted = true
+	return func() { e.sandbox.trusted = false }
+}
+
+// wrap replaces a builtin so that untrusted code gets deny instead
+func (sb *sandbox) wrap(i *prolog.Interpreter, name engine.Atom, arity int, deny func(*engine.Env) *engine.Promise) {
+	switch arity {
+	case 1:
+		p := builtin1[name.String()]
+		i.Register1(name, func(vm *engine.VM, a engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+			if !sb.trusted {
+				return deny(env)
+			}
+			return p(vm, a, k, env)
+		})
+	case 2:
+		p := builtin2[name.String()]
+		i.Register2(name, func(vm *engine.VM, a, b engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+			if !sb.trusted {
+				return deny(env)
+			}
+			return p(vm, a, b, k, env)
+		})
+	case 3:
+		p := builtin3[name.String()]
+		i.Register3(name, func(vm *engine.VM, a, b, c engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+			if !sb.trusted {
+				return deny(env)
+			}
+			return p(vm, a, b, c, k, env)
+		})
+	case 4:
+		p := builtin4[name.String()]
+		i.Register4(name, func(vm *engine.VM, a, b, c, d engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+			if !sb.trusted {
+				return deny(env)
+			}
+			return p(vm, a, b, c, d, k, env)
+		})
+	}
+}
+
+// The ichiban builtins behind the sandboxed names, for trusted callers
+var (
+	builtin1 = map[string]engine.Predicate1{
+		"consult":    engine.Consult,
+		"set_input":  engine.SetInput,
+		"set_output": engine.SetOutput,
+		"halt":       engine.Halt,
+	}
+	builtin2 = map[string]engine.Predicate2{
+		"close":               engine.Close,
+		"set_stream_position": engine.SetStreamPosition,
+		"get_char":            engine.GetChar,
+		"peek_char":           engine.PeekChar,
+		"get_byte":            engine.GetByte,
+		"peek_byte":           engine.PeekByte,
+		"char_conversion":     engine.CharConversion,
+		"set_prolog_flag":     engine.SetPrologFlag,
+	}
+	builtin3 = map[string]engine.Predicate3{
+		"read_term": engine.ReadTerm,
+		"op":        engine.Op,
+	}
+	builtin4 = map[string]engine.Predicate4{
+		"open": engine.Open,
+	}
+)
+
+// checkArity rejects an arity above the term size limit
+func (sb *sandbox) checkArity(n engine.Term, env *engine.Env) error {
+	max := sb.limits.TermSize
+	if max <= 0 || sb.trusted {
+		return nil
+	}
+	if size, ok := env.Resolve(n).(engine.Integer); ok && size > engine.Integer(max) {
+		return &LimitError{Limit: "term size", Max: uint64(max)}
+	}
+	return nil
+}
+
+// termSize counts the cells in t, stopping once it passes max
+func termSize(t engine.Term, env *engine.Env, max int) int {
+	size := 0
+	stack := []engine.Term{t}
+	for len(stack) > 0 && size <= max {
+		t, stack = env.Resolve(stack[len(stack)-1]), stack[:len(stack)-1]
+		size++
+		if c, ok := t.(engine.Compound); ok {
+			for i := 0; i < c.Arity(); i++ {
+				stack = append(stack, c.Arg(i))
+			}
+		}
+	}
+	return size
+}
+
+// sandboxFS opens the files ensure_loaded/1 and include/1 name, for
+// trusted loads only
+type sandboxFS struct{ sb *sandbox }
+
+func (s sandboxFS) Open(name string) (fs.File, error) {
+	if !s.sb.trusted {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return os.Open(name)
+}
+
+// limited returns ctx with the sandbox limits applied, when there are any
+func (e *Engine) limited(ctx context.Context) context.Context {
+	if e.sandbox == nil || e.sandbox.trusted {
+		return ctx
+	}
+	if e.sandbox.limits.Inferences <= 0 {
+		return ctx
+	}
+	return &limitContext{Context: ctx, limits: e.sandbox.limits, done: make(chan struct{})}
+}
+
+// limitContext counts resolution steps through Done, which ichiban/prolog
+// calls once per step, and ends the query when a limit is passed
+type limitContext struct {
+	context.Context
+	limits Limits
+	steps  atomic.Int64
+
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func (c *limitContext) Done() <-chan struct{} {
+	n := c.steps.Add(1)
+	if max := c.limits.Inferences; max > 0 && n > max {
+		c.exceed(&LimitError{Limit: "inferences", Max: uint64(max)})
+	}
+	select {
+	case <-c.done:
+		return c.done
+	default:
+		return c.Context.Done()
+	}
+}
+
+func (c *limitContext) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return c.Context.Err()
+	}
+}
+
+func (c *limitContext) exceed(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+}
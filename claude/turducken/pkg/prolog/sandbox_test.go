@@ -0,0 +1,148 @@
+package prolog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSandboxDeniesFileAndOSBuiltins(t *testing.T) {
+	e, err := New(WithSandbox(Limits{}))
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "secret.pl")
+	if err := os.WriteFile(path, []byte("secret(42).\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, goal := range []string{
+		fmt.Sprintf("consult(%s)", QuoteAtom(path)),
+		fmt.Sprintf("[%s]", QuoteAtom(path)),
+		fmt.Sprintf("open(%s, read, S)", QuoteAtom(path)),
+		"read(X)",
+		"halt",
+		"op(200, xfy, ===>)",
+		"set_prolog_flag(unknown, fail)",
+	} {
+		_, err := e.QueryOne(ctx, goal+".")
+		if err == nil || !strings.Contains(err.Error(), "sandboxed_procedure") {
+			t.Errorf("%s: expected a permission error, got %v", goal, err)
+		}
+	}
+
+	if err := e.LoadSpec(fmt.Sprintf(":- consult(%s).", QuoteAtom(path))); err == nil {
+		t.Error("expected a spec directive to be denied too")
+	}
+	if err := e.LoadSpec(fmt.Sprintf(":- ensure_loaded(%s).", QuoteAtom(path))); err == nil {
+		t.Error("expected ensure_loaded to be denied")
+	}
+
+	// Trusted loads keep every builtin
+	if err := e.LoadTrustedSpec(fmt.Sprintf(":- consult(%s).", QuoteAtom(path))); err != nil {
+		t.Fatalf("LoadTrustedSpec error: %v", err)
+	}
+	if ok, err := e.QueryOne(ctx, "secret(42)."); err != nil || !ok {
+		t.Errorf("expected the trusted consult to load, got %v, %v", ok, err)
+	}
+	if err := e.LoadSpecFile(path); err != nil {
+		t.Errorf("LoadSpecFile error: %v", err)
+	}
+}
+
+func TestSandboxLimits(t *testing.T) {
+	ctx := context.Background()
+
+	e, _ := New(WithSandbox(Limits{Inferences: 10000}), WithSpec("loop :- loop."))
+	_, err := e.QueryOne(ctx, "loop.")
+	var limit *LimitError
+	if !errors.As(err, &limit) || limit.Limit != "inferences" || limit.Max != 10000 {
+		t.Fatalf("expected the inference limit, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "resource limit exceeded: inferences (max 10000)") {
+		t.Errorf("expected the limit to be named, got %q", err)
+	}
+	if ok, err := e.QueryOne(ctx, "between(1, 100, X), X > 99."); err != nil || !ok {
+		t.Errorf("expected a small query to run, got %v, %v", ok, err)
+	}
+	if err := e.LoadSpec(":- repeat, fail."); err == nil || !strings.Contains(err.Error(), "inferences") {
+		t.Errorf("expected a looping directive to hit the limit, got %v", err)
+	}
+
+	// The limit applies to clones, but not to trusted loads
+	if err := e.LoadSpec("loop :- loop."); err != nil {
+		t.Fatalf("LoadSpec error: %v", err)
+	}
+	c, err := e.Clone()
+	if err != nil {
+		t.Fatalf("Clone error: %v", err)
+	}
+	if _, err := c.QueryOne(ctx, "loop."); !errors.As(err, &limit) {
+		t.Errorf("expected the clone to be limited, got %v", err)
+	}
+	if err := e.LoadTrustedSpec(":- between(1, 20000, X), X >= 20000."); err != nil {
+		t.Errorf("expected a trusted load to run unlimited, got %v", err)
+	}
+
+	e, _ = New(WithSandbox(Limits{TermSize: 100}))
+	if _, err := e.QueryOne(ctx, "length(L, 500), assertz(big(L))."); !errors.As(err, &limit) || limit.Limit != "term size" {
+		t.Errorf("expected a large assert to hit the term size limit, got %v", err)
+	}
+	if _, err := e.QueryOne(ctx, "functor(T, f, 1000000)."); !errors.As(err, &limit) {
+		t.Errorf("expected a wide functor/3 to hit the term size limit, got %v", err)
+	}
+	if ok, err := e.QueryOne(ctx, "assertz(small([a, b])), functor(T, f, 3)."); err != nil || !ok {
+		t.Errorf("expected small terms to pass, got %v, %v", ok, err)
+	}
+}
+
+func TestSandboxCapsBuiltAtomsAndLists(t *testing.T) {
+	ctx := context.Background()
+	e, err := New(WithSandbox(Limits{Inferences: 5_000_000, TermSize: 100_000}))
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	// Each doubling is one inference; unchecked, 24 of them allocate 256 MiB
+	var doubling strings.Builder
+	doubling.WriteString("A0 = a")
+	for i := 0; i < 32; i++ {
+		fmt.Fprintf(&doubling, ", atom_concat(A%d, A%d, A%d)", i, i, i+1)
+	}
+	var limit *LimitError
+	for _, goal := range []string{
+		doubling.String(),
+		"length(L, 200000)",
+		"length(L, 60000), atom_chars(A, L)",
+		"findall(0'a, between(1, 200000, _), Cs)",
+		"findall(L, (between(1, 1000, _), length(L, 500)), R)",
+		"bagof(L, N^(between(1, 1000, N), length(L, 500)), R)",
+		"setof(N-L, (between(1, 1000, N), length(L, 500)), R)",
+	} {
+		if _, err := e.QueryOne(ctx, goal+"."); !errors.As(err, &limit) || limit.Limit != "term size" {
+			t.Errorf("%s: expected the term size limit, got %v", goal, err)
+		}
+	}
+
+	for _, goal := range []string{
+		"atom_concat(ab, cd, abcd), atom_concat(X, cd, abcd), X == ab",
+		"sub_atom(abc, 1, 1, _, b), atom_chars(ab, [a, b]), atom_codes(A, [0'x]), A == x",
+		"length(L, 3), findall(X, member(X, [a, b]), [a, b])",
+		"bagof(X, Y^member(X-Y, [a-1, b-2]), [a, b])",
+		"findall(Y-L, bagof(X, member(X-Y, [a-1, b-1, c-2]), L), [1-[a, b], 2-[c]])",
+		"setof(X, member(X, [b, a, b]), [a, b])",
+	} {
+		if ok, err := e.QueryOne(ctx, goal+"."); err != nil || !ok {
+			t.Errorf("%s: expected small terms to pass, got %v, %v", goal, ok, err)
+		}
+	}
+
+	if err := e.LoadTrustedSpec(":- length(_, 200000), findall(x, between(1, 200000, _), _)."); err != nil {
+		t.Errorf("expected a trusted load to build large terms, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package prolog
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+)
+
+// Snapshot is an engine's spec, version, sandbox and param overrides at
+// one moment. It never changes, and each engine taken from it has its own
+// interpreter, so simulations and ad-hoc queries can assert and retract
+// facts in parallel without seeing each other or the engine it came from.
+//
+// Interpreters share no clauses, so every engine consults the core
+// predicates and the whole spec again: about 6ms for the bundled bread
+// company spec, most of it the core (see BenchmarkSnapshotLoad). A snapshot
+// keeps engines loaded ahead of time to hide that, replacing each one
+// handed out in the background, up to one per CPU. Requests that arrive
+// faster than engines load still pay the full cost.
+type Snapshot struct {
+	opts    []Option
+	source  string
+	trusted bool
+	params  map[string]float64
+
+	ready   chan *Engine
+	loading atomic.Int32
+}
+
+// Snapshot returns the engine's current state as a Snapshot. The same
+// snapshot is returned until the spec, version or params change, so the
+// engines it has loaded ahead of time carry over between calls. Facts
+// asserted by queries are not part of it.
+func (e *Engine) Snapshot() *Snapshot {
+	e.mu.RLock()
+	snap := e.snapshot
+	e.mu.RUnlock()
+	if snap != nil {
+		return snap
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.snapshot == nil {
+		e.snapshot = &Snapshot{
+			opts:    e.options(),
+			source:  e.specSource,
+			trusted: e.specTrusted,
+			params:  e.params,
+			ready:   make(chan *Engine, runtime.GOMAXPROCS(0)),
+		}
+	}
+	return e.snapshot
+}
+
+// Engine returns an engine with the snapshot loaded, for the caller alone
+func (s *Snapshot) Engine() (*Engine, error) {
+	defer s.refill()
+	select {
+	case e := <-s.ready:
+		return e, nil
+	default:
+		return s.load()
+	}
+}
+
+// Source is the spec the snapshot loads
+func (s *Snapshot) Source() string {
+	return s.source
+}
+
+// refill starts loading one engine in the background, unless enough are
+// already ready or loading
+func (s *Snapshot) refill() {
+	n := s.loading.Add(1)
+	if int(n)+len(s.ready) > cap(s.ready) {
+		s.loading.Add(-1)
+		return
+	}
+	go func() {
+		defer s.loading.Add(-1)
+		e, err := s.load()
+		if err != nil {
+			return
+		}
+		select {
+		case s.ready <- e:
+		default:
+		}
+	}()
+}
+
+func (s *Snapshot) load() (*Engine, error) {
+	e, err := New(s.opts...)
+	if err != nil {
+		return nil, err
+	}
+	load := e.LoadSpec
+	if s.trusted {
+		load = e.LoadTrustedSpec
+	}
+	if err := load(s.source); err != nil {
+		return nil, err
+	}
+	if len(s.params) > 0 {
+		if err := e.SetParams(context.Background(), s.params); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
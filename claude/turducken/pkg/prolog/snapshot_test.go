@@ -0,0 +1,118 @@
+package prolog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSnapshotEnginesShareNothing(t *testing.T) {
+	e, err := New(WithVersion("v1"), WithSpec("param(rate, 0.5).\n:- dynamic(seen/1)."))
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	ctx := context.Background()
+	if err := e.SetParams(ctx, map[string]float64{"rate": 0.9}); err != nil {
+		t.Fatalf("SetParams error: %v", err)
+	}
+
+	snap := e.Snapshot()
+	if e.Snapshot() != snap {
+		t.Error("expected the snapshot to be reused while nothing changes")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := snap.Engine()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if _, err := c.QueryOne(ctx, "assertz(seen(?)).", i); err != nil {
+				errs <- err
+				return
+			}
+			rows, err := c.RawQueryBindings(ctx, "seen(X).")
+			if err != nil || len(rows) != 1 || rows[0]["X"] != fmt.Sprint(i) {
+				errs <- fmt.Errorf("engine %d: expected only its own fact, got %v, %v", i, rows, err)
+				return
+			}
+			if ok, err := c.QueryOne(ctx, "turducken_version(v1), param_value(rate, 0.9)."); err != nil || !ok {
+				errs <- fmt.Errorf("engine %d: expected the version and params, got %v, %v", i, ok, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if ok, err := e.QueryOne(ctx, "seen(_)."); err != nil || ok {
+		t.Errorf("expected the snapshot's engine to be untouched, got %v, %v", ok, err)
+	}
+
+	if err := e.SetParams(ctx, nil); err != nil {
+		t.Fatalf("SetParams error: %v", err)
+	}
+	if e.Snapshot() == snap {
+		t.Error("expected a new snapshot once params change")
+	}
+	c, err := e.Clone()
+	if err != nil {
+		t.Fatalf("Clone error: %v", err)
+	}
+	if ok, err := c.QueryOne(ctx, "param_value(rate, 0.5)."); err != nil || !ok {
+		t.Errorf("expected the clone to drop the cleared override, got %v, %v", ok, err)
+	}
+}
+
+// BenchmarkSnapshotLoad is the cost of an engine a request waits for when
+// none are loaded ahead of time: the core predicates and the whole spec
+// are consulted again, since interpreters cannot share clauses.
+func BenchmarkSnapshotLoad(b *testing.B) {
+	e := benchmarkSpecEngine(b)
+	snap := e.Snapshot()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := snap.load(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSnapshotEngine is the cost seen by back-to-back requests, which
+// outpace the background loads once the ready engines run out
+func BenchmarkSnapshotEngine(b *testing.B) {
+	e := benchmarkSpecEngine(b)
+	snap := e.Snapshot()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := snap.Engine(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkSpecEngine(b *testing.B) *Engine {
+	b.Helper()
+	source, err := os.ReadFile(filepath.Join("..", "..", "specs", "bread_company.pl"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	e, err := New()
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := e.LoadTrustedSpec(string(source)); err != nil {
+		b.Fatal(err)
+	}
+	return e
+}
@@ -0,0 +1,295 @@
+package prolog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ichiban/prolog/engine"
+)
+
+// JSONTerm scans a binding into the structured JSON term encoding:
+//
+//	atom                 "idle"
+//	integer, float       42, 0.5 (floats always have a fraction or exponent)
+//	double-quoted text   {"string": "hello"}
+//	list                 ["a", 1, ...]
+//	compound             {"functor": "send", "args": ["ch", 1]}
+//	unbound variable     {"var": "_123"}
+//
+// The empty list is [] and a partial list such as [a|T] is the compound
+// '.'(a, T). DecodeTerm turns the encoding back into Prolog text.
+type JSONTerm json.RawMessage
+
+// Scan implements ichiban/prolog's Scanner interface
+func (t *JSONTerm) Scan(vm *engine.VM, term engine.Term, env *engine.Env) error {
+	v, err := encodeTerm(term, env)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	*t = data
+	return nil
+}
+
+// MarshalJSON writes the encoding as is
+func (t JSONTerm) MarshalJSON() ([]byte, error) {
+	if t == nil {
+		return []byte("null"), nil
+	}
+	return t, nil
+}
+
+// UnmarshalJSON keeps the encoding, checking that it decodes
+func (t *JSONTerm) UnmarshalJSON(data []byte) error {
+	if _, err := DecodeTerm(data); err != nil {
+		return err
+	}
+	*t = append((*t)[:0], data...)
+	return nil
+}
+
+// encodeTerm converts a term to the values json.Marshal writes for it
+func encodeTerm(term engine.Term, env *engine.Env) (interface{}, error) {
+	switch t := env.Resolve(term).(type) {
+	case engine.Variable:
+		return map[string]string{"var": fmt.Sprintf("_%d", t)}, nil
+	case engine.Atom:
+		if t == engine.NewAtom("[]") {
+			return []interface{}{}, nil
+		}
+		return t.String(), nil
+	case engine.Integer:
+		return json.Number(strconv.FormatInt(int64(t), 10)), nil
+	case engine.Float:
+		f := float64(t)
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, fmt.Errorf("cannot encode float %v", f)
+		}
+		return json.Number(formatFloat(f)), nil
+	case engine.Compound:
+		// Double-quoted text is a list of chars or codes that remembers its text
+		if s, ok := t.(fmt.Stringer); ok {
+			return map[string]string{"string": s.String()}, nil
+		}
+		if elems, ok := listElems(t, env); ok {
+			items := make([]interface{}, len(elems))
+			for i, elem := range elems {
+				v, err := encodeTerm(elem, env)
+				if err != nil {
+					return nil, err
+				}
+				items[i] = v
+			}
+			return items, nil
+		}
+		args := make([]interface{}, t.Arity())
+		for i := range args {
+			v, err := encodeTerm(t.Arg(i), env)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		return map[string]interface{}{"functor": t.Functor().String(), "args": args}, nil
+	default:
+		return nil, fmt.Errorf("cannot encode term %T", t)
+	}
+}
+
+// listElems returns the elements of a proper list
+func listElems(c engine.Compound, env *engine.Env) ([]engine.Term, bool) {
+	dot, empty := engine.NewAtom("."), engine.NewAtom("[]")
+	var elems []engine.Term
+	var t engine.Term = c
+	for {
+		switch cell := env.Resolve(t).(type) {
+		case engine.Atom:
+			return elems, cell == empty
+		case engine.Compound:
+			if cell.Functor() != dot || cell.Arity() != 2 {
+				return nil, false
+			}
+			elems = append(elems, cell.Arg(0))
+			t = cell.Arg(1)
+		default:
+			return nil, false
+		}
+	}
+}
+
+// DecodeTerm returns the Prolog text for a term in the JSON encoding
+// JSONTerm writes, quoting atoms and strings as needed. A variable
+// marker decodes to a fresh anonymous variable, and JSON true and false
+// to the atoms true and false.
+func DecodeTerm(data []byte) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", fmt.Errorf("decoding term: %w", err)
+	}
+	if dec.More() {
+		return "", fmt.Errorf("decoding term: trailing data")
+	}
+	var sb strings.Builder
+	if err := writeTerm(&sb, v); err != nil {
+		return "", fmt.Errorf("decoding term: %w", err)
+	}
+	return sb.String(), nil
+}
+
+func writeTerm(sb *strings.Builder, v interface{}) error {
+	switch t := v.(type) {
+	case string:
+		sb.WriteString(QuoteAtom(t))
+	case json.Number:
+		s := t.String()
+		if !strings.ContainsAny(s, ".eE") {
+			if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+				return fmt.Errorf("integer %s out of range", s)
+			}
+			sb.WriteString(s)
+			break
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("float %s out of range", s)
+		}
+		sb.WriteString(formatFloat(f))
+	case bool:
+		sb.WriteString(strconv.FormatBool(t))
+	case []interface{}:
+		sb.WriteString("[")
+		for i, elem := range t {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			if err := writeTerm(sb, elem); err != nil {
+				return err
+			}
+		}
+		sb.WriteString("]")
+	case map[string]interface{}:
+		return writeObject(sb, t)
+	case nil:
+		return fmt.Errorf("null is not a term")
+	default:
+		return fmt.Errorf("unexpected %T", t)
+	}
+	return nil
+}
+
+// writeObject writes a {"functor", "args"}, {"string"} or {"var"} object
+func writeObject(sb *strings.Builder, obj map[string]interface{}) error {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	switch strings.Join(keys, ",") {
+	case "string":
+		s, ok := obj["string"].(string)
+		if !ok {
+			return fmt.Errorf("string must be a JSON string")
+		}
+		sb.WriteString(quoteText(s, '"'))
+	case "var":
+		if _, ok := obj["var"].(string); !ok {
+			return fmt.Errorf("var must be a JSON string")
+		}
+		sb.WriteString("_")
+	case "args,functor":
+		functor, ok := obj["functor"].(string)
+		if !ok {
+			return fmt.Errorf("functor must be a JSON string")
+		}
+		args, ok := obj["args"].([]interface{})
+		if !ok {
+			return fmt.Errorf("args of %s must be an array", functor)
+		}
+		sb.WriteString(QuoteAtom(functor))
+		if len(args) == 0 {
+			break
+		}
+		sb.WriteString("(")
+		for i, arg := range args {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			if err := writeTerm(sb, arg); err != nil {
+				return err
+			}
+		}
+		sb.WriteString(")")
+	default:
+		return fmt.Errorf("object with keys %v is not a term", keys)
+	}
+	return nil
+}
+
+// QuoteAtom writes an atom so it reads back as the same atom: plain
+// lowercase identifiers and [] as they are, anything else single-quoted
+func QuoteAtom(name string) string {
+	if name == "[]" || isIdentifier(name) {
+		return name
+	}
+	return quoteText(name, '\'')
+}
+
+func isIdentifier(name string) bool {
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteText quotes s with q, escaping the quote, backslashes and control
+// characters
+func quoteText(s string, q rune) string {
+	var sb strings.Builder
+	sb.WriteRune(q)
+	for _, r := range s {
+		switch {
+		case r == q || r == '\\':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r < ' ' || r == 0x7f:
+			fmt.Fprintf(&sb, `\x%x\`, r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteRune(q)
+	return sb.String()
+}
+
+// formatFloat writes f so it reads back as a float: Prolog needs a
+// fraction before any exponent
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if strings.ContainsRune(s, '.') {
+		return s
+	}
+	if i := strings.IndexRune(s, 'e'); i >= 0 {
+		return s[:i] + ".0" + s[i:]
+	}
+	return s + ".0"
+}
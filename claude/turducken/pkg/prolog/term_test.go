@@ -0,0 +1,109 @@
+package prolog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestRawQueryTerms(t *testing.T) {
+	e, _ := New()
+	ctx := context.Background()
+
+	rows, err := e.RawQueryTerms(ctx, `A = idle, B = 'Hello World', I = 42, F = 2.0, S = "hi", L = [a, [1]], E = [], C = send(ch, f(x)), P = [a|T], V = _.`)
+	if err != nil {
+		t.Fatalf("RawQueryTerms error: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected one solution, got %d", len(rows))
+	}
+	want := map[string]string{
+		"A": `"idle"`,
+		"B": `"Hello World"`,
+		"I": `42`,
+		"F": `2.0`,
+		"S": `{"string":"hi"}`,
+		"L": `["a",[1]]`,
+		"E": `[]`,
+		"C": `{"args":["ch",{"args":["x"],"functor":"f"}],"functor":"send"}`,
+	}
+	for name, expected := range want {
+		if got := string(rows[0][name]); got != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, got)
+		}
+	}
+
+	var partial struct {
+		Functor string            `json:"functor"`
+		Args    []json.RawMessage `json:"args"`
+	}
+	if err := json.Unmarshal(rows[0]["P"], &partial); err != nil || partial.Functor != "." || len(partial.Args) != 2 {
+		t.Errorf("expected a partial list to be a '.' compound, got %s", rows[0]["P"])
+	}
+	var v struct {
+		Var string `json:"var"`
+	}
+	if err := json.Unmarshal(rows[0]["V"], &v); err != nil || v.Var == "" {
+		t.Errorf("expected a variable marker, got %s", rows[0]["V"])
+	}
+}
+
+func TestDecodeTermRoundTrip(t *testing.T) {
+	e, _ := New()
+	ctx := context.Background()
+
+	terms := []string{
+		`idle`,
+		`'Hello World'`,
+		`'it''s'`,
+		`'back\\slash'`,
+		`'[]'`,
+		`-7`,
+		`2.0`,
+		`1.0e30`,
+		`"a \"quoted\" string"`,
+		`[a, 'B', [1, 2.5], []]`,
+		`send('Ch', f(-1), "x")`,
+		`'-'(1)`,
+		`','(a, b)`,
+		`[a|b]`,
+	}
+	for _, term := range terms {
+		rows, err := e.RawQueryTerms(ctx, fmt.Sprintf("T = %s.", term))
+		if err != nil || len(rows) != 1 {
+			t.Errorf("%s: query error %v", term, err)
+			continue
+		}
+		text, err := DecodeTerm(rows[0]["T"])
+		if err != nil {
+			t.Errorf("%s: DecodeTerm error: %v", term, err)
+			continue
+		}
+		ok, err := e.QueryOne(ctx, fmt.Sprintf("%s == %s.", text, term))
+		if err != nil || !ok {
+			t.Errorf("%s: decoded %s from %s, which is not identical (%v)", term, text, rows[0]["T"], err)
+		}
+	}
+}
+
+func TestDecodeTermRejectsMalformed(t *testing.T) {
+	for _, data := range []string{
+		`null`,
+		`{"functor": "f"}`,
+		`{"functor": 1, "args": []}`,
+		`{"atom": "x"}`,
+		`{"string": 3}`,
+		`99999999999999999999`,
+		`"a" "b"`,
+		`[1,`,
+	} {
+		if text, err := DecodeTerm([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error, got %s", data, text)
+		}
+	}
+
+	if text, err := DecodeTerm([]byte(`{"var": "_12"}`)); err != nil || text != "_" {
+		t.Errorf("expected a fresh variable, got %q, %v", text, err)
+	}
+}
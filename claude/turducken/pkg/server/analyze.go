@@ -0,0 +1,361 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/rfielding/turducken/pkg/model"
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+// DeadlockFinding is a reachable global state where no actor can move,
+// with the shortest trace that reaches it
+type DeadlockFinding struct {
+	State    string              `json:"state"`
+	Locals   map[string]string   `json:"locals"`
+	Channels map[string][]string `json:"channels,omitempty"`
+	Trace    []model.TraceStep   `json:"trace"`
+}
+
+// LivelockFinding is a cycle of global states without progress: Trace is
+// the shortest way in, and Cycle goes around once from its entry state
+type LivelockFinding struct {
+	States []string          `json:"states"`
+	Entry  string            `json:"entry"`
+	Trace  []model.TraceStep `json:"trace"`
+	Cycle  []model.TraceStep `json:"cycle"`
+}
+
+// exploreModel builds the composed state space of engine's spec, with any
+// ?param=name=value overrides applied
+func (s *Server) exploreModel(ctx context.Context, engine *prolog.Engine, r *http.Request) (*model.LTS, error) {
+	params, err := parseParamOverrides(r.URL.Query()["param"])
+	if err != nil {
+		return nil, err
+	}
+	pe, err := paramEngine(ctx, engine, params)
+	if err != nil {
+		return nil, err
+	}
+	sys, err := model.Load(ctx, pe)
+	if err != nil {
+		return nil, err
+	}
+	return sys.Explore(ctx, model.DefaultMaxStates)
+}
+
+// describeState splits a global state into each actor's local state and
+// the messages waiting on non-empty channels
+func describeState(sys *model.System, st model.State) (map[string]string, map[string][]string) {
+	locals := make(map[string]string, len(sys.Actors))
+	for i, actor := range sys.Actors {
+		locals[actor] = st.Locals[i]
+	}
+	var chans map[string][]string
+	for i, queue := range st.Chans {
+		if len(queue) == 0 {
+			continue
+		}
+		if chans == nil {
+			chans = make(map[string][]string)
+		}
+		chans[sys.Channels[i]] = append([]string(nil), queue...)
+	}
+	return locals, chans
+}
+
+// handleAnalyzeDeadlock reports reachable global states where no actor can
+// move and the system has not finished, and cycles the system can repeat
+// forever without reaching an accepting or progress/1 state
+func (s *Server) handleAnalyzeDeadlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	lts, err := s.exploreModel(ctx, s.current(), r)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	deadlocks := make([]DeadlockFinding, 0)
+	for _, d := range lts.Deadlocks() {
+		st := lts.States[d.State]
+		locals, chans := describeState(lts.System, st)
+		deadlocks = append(deadlocks, DeadlockFinding{
+			State:    st.String(),
+			Locals:   locals,
+			Channels: chans,
+			Trace:    d.Trace,
+		})
+	}
+	livelocks := make([]LivelockFinding, 0)
+	for _, l := range lts.Livelocks() {
+		states := make([]string, len(l.States))
+		for i, idx := range l.States {
+			states[i] = lts.States[idx].String()
+		}
+		livelocks = append(livelocks, LivelockFinding{
+			States: states,
+			Entry:  lts.States[l.Entry].String(),
+			Trace:  l.Trace,
+			Cycle:  l.Cycle,
+		})
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"states":    len(lts.States),
+		"deadlocks": deadlocks,
+		"livelocks": livelocks,
+	})
+
+	s.incCounter("deadlock_analyses")
+}
+
+// StarvationFinding reports whether an actor can be kept from progress
+// forever. Progress lists the labels and states that count, and is empty
+// when any step of the actor does. A starved actor comes with a lasso:
+// Trace reaches the cycle, and Cycle repeats forever.
+type StarvationFinding struct {
+	Actor    string            `json:"actor"`
+	Starved  bool              `json:"starved"`
+	Progress []string          `json:"progress"`
+	States   []string          `json:"states,omitempty"`
+	Trace    []model.TraceStep `json:"trace,omitempty"`
+	Cycle    []model.TraceStep `json:"cycle,omitempty"`
+}
+
+// handleAnalyzeStarvation checks, for every actor, that it can always
+// eventually make progress under ?fairness=none, weak (default) or strong
+func (s *Server) handleAnalyzeStarvation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	fairness, err := model.ParseFairness(r.URL.Query().Get("fairness"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	lts, err := s.exploreModel(ctx, s.current(), r)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	actors := make([]StarvationFinding, 0, len(lts.System.Actors))
+	for i, actor := range lts.System.Actors {
+		finding := StarvationFinding{Actor: actor, Progress: lts.System.ProgressOf(i)}
+		if st := lts.Starvation(i, fairness); st != nil {
+			finding.Starved = true
+			finding.Trace = st.Trace
+			finding.Cycle = st.Cycle
+			for _, idx := range st.States {
+				finding.States = append(finding.States, lts.States[idx].String())
+			}
+		}
+		actors = append(actors, finding)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"states":   len(lts.States),
+		"fairness": fairness,
+		"actors":   actors,
+	})
+
+	s.incCounter("starvation_analyses")
+}
+
+// maxComponentStates caps the state names listed for each component
+const maxComponentStates = 50
+
+// stateSpaceGraph returns the graph of the requested model, and for the
+// composed model its explored state space
+func (s *Server) stateSpaceGraph(ctx context.Context, r *http.Request) (string, *model.Graph, *model.LTS, error) {
+	engine := s.current()
+	modelName, err := resolveModel(ctx, engine, r.URL.Query().Get("model"))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if modelName == modelComposed {
+		lts, err := s.exploreModel(ctx, engine, r)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		return modelName, lts.Graph(), lts, nil
+	}
+	sm, err := engine.GetStateMachine(ctx)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return modelName, model.TransitionGraph(sm, nil), nil, nil
+}
+
+// handleAnalyzeStateSpace reports the size and shape of the reachable state
+// space: counts, depth and diameter, branching, strongly connected and
+// bottom components, and declared states that are never reached
+func (s *Server) handleAnalyzeStateSpace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	modelName, g, lts, err := s.stateSpaceGraph(ctx, r)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ss := g.Analyze()
+	components := make([]map[string]interface{}, 0, len(ss.Components))
+	for _, c := range ss.Components {
+		names := make([]string, 0, len(c.States))
+		for _, i := range c.States {
+			if len(names) == maxComponentStates {
+				break
+			}
+			names = append(names, g.Nodes[i])
+		}
+		components = append(components, map[string]interface{}{
+			"id":     c.ID,
+			"size":   len(c.States),
+			"states": names,
+			"cyclic": c.Cyclic,
+			"bottom": c.Bottom,
+			"out":    c.Out,
+		})
+	}
+
+	unreachable := []string{}
+	if lts != nil {
+		unreachable = append(unreachable, lts.UnreachableLocals()...)
+	} else {
+		reach := g.Reachable()
+		for i, name := range g.Nodes {
+			if !reach[i] {
+				unreachable = append(unreachable, name)
+			}
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"model":         modelName,
+		"states":        ss.States,
+		"transitions":   ss.Transitions,
+		"terminal":      ss.Terminal,
+		"depth":         ss.Depth,
+		"diameter":      ss.Diameter,
+		"meanBranching": ss.MeanBranching,
+		"maxBranching":  ss.MaxBranching,
+		"sccs": map[string]interface{}{
+			"count":   len(ss.Components),
+			"cyclic":  ss.Cyclic,
+			"bottom":  ss.Bottom,
+			"largest": ss.Largest,
+		},
+		"components":  components,
+		"unreachable": unreachable,
+	})
+
+	s.incCounter("statespace_analyses")
+}
+
+// collapseStateMachine returns the transition/3 state machine with every
+// cyclic strongly connected component drawn as a single state named
+// scc_N. Transitions inside a component are dropped, and components maps
+// each collapsed state to its members.
+func collapseStateMachine(sm *prolog.StateMachine) map[string]interface{} {
+	g := model.TransitionGraph(sm, nil)
+	name := make([]string, len(g.Nodes))
+	copy(name, g.Nodes)
+	components := make(map[string][]string)
+	for _, scc := range model.Components(g.Succ, nil, nil) {
+		if len(scc) < 2 {
+			continue
+		}
+		sort.Ints(scc)
+		id := fmt.Sprintf("scc_%d", len(components)+1)
+		for _, i := range scc {
+			name[i] = id
+			components[id] = append(components[id], g.Nodes[i])
+		}
+	}
+
+	index := make(map[string]int, len(g.Nodes))
+	for i, n := range g.Nodes {
+		index[n] = i
+	}
+	dedup := func(states []string) []string {
+		seen := make(map[string]bool)
+		out := []string{}
+		for _, s := range states {
+			if n := name[index[s]]; !seen[n] {
+				seen[n] = true
+				out = append(out, n)
+			}
+		}
+		return out
+	}
+
+	transitions := []map[string]string{}
+	seen := make(map[string]bool)
+	for _, t := range sm.Transitions {
+		from, to := name[index[t.From]], name[index[t.To]]
+		key := transitionKey(from, t.Label, to)
+		if (from == to && components[from] != nil) || seen[key] {
+			continue
+		}
+		seen[key] = true
+		transitions = append(transitions, map[string]string{
+			"from":  from,
+			"label": t.Label,
+			"to":    to,
+		})
+	}
+
+	return map[string]interface{}{
+		"states":      dedup(g.Nodes),
+		"transitions": transitions,
+		"initial":     dedup(sm.Initial),
+		"accepting":   dedup(sm.Accepting),
+		"components":  components,
+	}
+}
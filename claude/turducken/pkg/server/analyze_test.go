@@ -0,0 +1,260 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+// handshakeSpec deadlocks when the client gives up before the server
+// replies, and otherwise finishes in accepting states
+const handshakeSpec = `
+        actor_initial(client, client_ready).
+        actor_initial(server, server_waiting).
+        actor_transition(client, client_ready, request, client_sent).
+        actor_transition(client, client_sent, got_reply, client_done).
+        actor_transition(client, client_sent, give_up, client_gone).
+        actor_transition(server, server_waiting, handle, server_replied).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        accepting(client_done).
+        accepting(client_gone).
+        accepting(server_replied).
+        channel(req, 1).
+        channel(resp, 1).
+        send(req, ping, client_ready, client_sent).
+        send(resp, pong, server_waiting, server_replied).
+        recv(req, ping, server_waiting, server_replied).
+        recv(resp, pong, client_sent, client_done).
+    `
+
+func TestAnalyzeDeadlockEndpoint(t *testing.T) {
+	engine := loadTestEngine(t, handshakeSpec)
+	s := newTestServer(engine)
+
+	rec := httptest.NewRecorder()
+	s.handleAnalyzeDeadlock(rec, httptest.NewRequest("GET", "/api/analyze/deadlock", nil))
+
+	var resp struct {
+		Success   bool              `json:"success"`
+		Error     string            `json:"error"`
+		States    int               `json:"states"`
+		Deadlocks []DeadlockFinding `json:"deadlocks"`
+		Livelocks []LivelockFinding `json:"livelocks"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !resp.Success || resp.States == 0 {
+		t.Fatalf("expected an explored state space, got %+v", resp)
+	}
+	if len(resp.Deadlocks) != 0 {
+		t.Errorf("expected every stop to be accepted, got %+v", resp.Deadlocks)
+	}
+	if len(resp.Livelocks) != 0 {
+		t.Errorf("expected no livelocks, got %+v", resp.Livelocks)
+	}
+}
+
+func TestAnalyzeDeadlockFindsStuckServer(t *testing.T) {
+	// The server waits for an ack nobody sends
+	engine := loadTestEngine(t, `
+        actor_initial(client, client_ready).
+        actor_initial(server, server_waiting).
+        actor_transition(client, client_ready, request, client_sent).
+        actor_transition(client, client_sent, give_up, client_gone).
+        actor_transition(server, server_waiting, handle, server_busy).
+        actor_transition(server, server_busy, reply, server_replied).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        accepting(client_gone).
+        accepting(server_replied).
+        channel(req, 1).
+        channel(resp, 1).
+        channel(ack, 1).
+        send(req, ping, client_ready, client_sent).
+        send(resp, pong, server_busy, server_replied).
+        recv(req, ping, server_waiting, server_busy).
+        recv(ack, done, server_busy, server_replied).
+    `)
+	s := newTestServer(engine)
+
+	rec := httptest.NewRecorder()
+	s.handleAnalyzeDeadlock(rec, httptest.NewRequest("GET", "/api/analyze/deadlock", nil))
+
+	var resp struct {
+		Success   bool              `json:"success"`
+		Deadlocks []DeadlockFinding `json:"deadlocks"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !resp.Success || len(resp.Deadlocks) == 0 {
+		t.Fatalf("expected the server to deadlock waiting for an ack, got %+v", resp)
+	}
+	d := resp.Deadlocks[0]
+	if d.Locals["server"] != "server_busy" || len(d.Trace) != 3 {
+		t.Errorf("expected a three-step trace to the busy server, got %+v", d)
+	}
+}
+
+func TestAnalyzeStarvationEndpoint(t *testing.T) {
+	// The server can keep polling forever instead of handling the request
+	engine := loadTestEngine(t, `
+        actor_initial(client, client_ready).
+        actor_initial(server, server_idle).
+        actor_transition(client, client_ready, request, client_sent).
+        actor_transition(client, client_sent, got_reply, client_ready).
+        actor_transition(server, server_idle, handle, server_idle).
+        actor_transition(server, server_idle, poll, server_polling).
+        actor_transition(server, server_polling, sleep, server_idle).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        progress(got_reply).
+        channel(req, 1).
+        channel(resp, 1).
+        send(req, ping, client_ready, client_sent).
+        send(resp, pong, server_idle, server_idle).
+        recv(req, ping, server_idle, server_idle).
+        recv(resp, pong, client_sent, client_ready).
+    `)
+	s := newTestServer(engine)
+
+	starved := func(fairness string) map[string]StarvationFinding {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleAnalyzeStarvation(rec, httptest.NewRequest("GET", "/api/analyze/starvation?fairness="+fairness, nil))
+		var resp struct {
+			Success bool                `json:"success"`
+			Error   string              `json:"error"`
+			Actors  []StarvationFinding `json:"actors"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if !resp.Success {
+			t.Fatalf("analysis failed: %s", resp.Error)
+		}
+		byActor := make(map[string]StarvationFinding)
+		for _, f := range resp.Actors {
+			byActor[f.Actor] = f
+		}
+		return byActor
+	}
+
+	weak := starved("weak")
+	client := weak["client"]
+	if !client.Starved || len(client.Cycle) == 0 || len(client.Progress) != 1 {
+		t.Errorf("expected the client to starve while the server polls, got %+v", client)
+	}
+	if weak["server"].Starved {
+		t.Errorf("expected the server to always make progress, got %+v", weak["server"])
+	}
+	if strong := starved("strong"); strong["client"].Starved {
+		t.Errorf("expected strong fairness to force the server to handle the request, got %+v", strong["client"])
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleAnalyzeStarvation(rec, httptest.NewRequest("GET", "/api/analyze/starvation?fairness=eventual", nil))
+	if rec.Code != 400 {
+		t.Errorf("expected 400 for an unknown fairness, got %d", rec.Code)
+	}
+}
+
+// retryLoopSpec loops between trying and backoff until it succeeds, and
+// has an orphan state nothing leads to
+const retryLoopSpec = `
+        initial(idle).
+        accepting(done).
+        transition(idle, start, trying).
+        transition(trying, fail, backoff).
+        transition(backoff, retry, trying).
+        transition(trying, ok, done).
+        transition(orphan, resume, idle).
+    `
+
+func TestAnalyzeStateSpaceEndpoint(t *testing.T) {
+	engine := loadTestEngine(t, retryLoopSpec)
+	s := newTestServer(engine)
+
+	rec := httptest.NewRecorder()
+	s.handleAnalyzeStateSpace(rec, httptest.NewRequest("GET", "/api/analyze/statespace", nil))
+
+	var resp struct {
+		Success     bool   `json:"success"`
+		Error       string `json:"error"`
+		Model       string `json:"model"`
+		States      int    `json:"states"`
+		Transitions int    `json:"transitions"`
+		Terminal    int    `json:"terminal"`
+		Diameter    *int   `json:"diameter"`
+		SCCs        struct {
+			Count  int `json:"count"`
+			Cyclic int `json:"cyclic"`
+			Bottom int `json:"bottom"`
+		} `json:"sccs"`
+		Components []struct {
+			Size   int      `json:"size"`
+			States []string `json:"states"`
+			Cyclic bool     `json:"cyclic"`
+		} `json:"components"`
+		Unreachable []string `json:"unreachable"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !resp.Success {
+		t.Fatalf("expected success, got %s", resp.Error)
+	}
+	if resp.Model != modelTransition || resp.States != 4 || resp.Transitions != 4 || resp.Terminal != 1 {
+		t.Errorf("unexpected counts: %+v", resp)
+	}
+	if resp.Diameter == nil {
+		t.Error("expected a diameter for a small state space")
+	}
+	if resp.SCCs.Count != 3 || resp.SCCs.Cyclic != 1 || resp.SCCs.Bottom != 1 {
+		t.Errorf("expected one retry loop and done at the bottom, got %+v", resp.SCCs)
+	}
+	if len(resp.Components) != 3 || resp.Components[1].Size != 2 || !resp.Components[1].Cyclic {
+		t.Errorf("expected the retry loop in the middle, got %+v", resp.Components)
+	}
+	if len(resp.Unreachable) != 1 || resp.Unreachable[0] != "orphan" {
+		t.Errorf("expected orphan unreachable, got %v", resp.Unreachable)
+	}
+}
+
+func TestVisualizeCollapsesComponents(t *testing.T) {
+	engine := loadTestEngine(t, retryLoopSpec)
+	s := newTestServer(engine)
+
+	rec := httptest.NewRecorder()
+	s.handleVisualize(rec, httptest.NewRequest("GET", "/api/visualize?type=statemachine&collapse=scc", nil))
+
+	var resp struct {
+		StateMachine struct {
+			States      []string            `json:"states"`
+			Transitions []map[string]string `json:"transitions"`
+			Components  map[string][]string `json:"components"`
+		} `json:"stateMachine"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	sm := resp.StateMachine
+	if members := sm.Components["scc_1"]; len(members) != 2 {
+		t.Fatalf("expected trying and backoff collapsed, got %+v", sm.Components)
+	}
+	for _, st := range sm.States {
+		if st == "trying" || st == "backoff" {
+			t.Errorf("expected %s to be collapsed", st)
+		}
+	}
+	for _, tr := range sm.Transitions {
+		if tr["label"] == "fail" || tr["label"] == "retry" {
+			t.Errorf("expected the loop's own transitions dropped, got %v", tr)
+		}
+	}
+	if len(sm.Transitions) != 3 {
+		t.Errorf("expected start, ok and resume between components, got %v", sm.Transitions)
+	}
+}
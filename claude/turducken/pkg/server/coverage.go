@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/rfielding/turducken/pkg/model"
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+// Coverage reports which declared states and transitions a trace exercised
+type Coverage struct {
+	States      CoverageCount             `json:"states"`
+	Transitions CoverageCount             `json:"transitions"`
+	Actors      map[string]*ActorCoverage `json:"actors"`
+}
+
+// CoverageCount is the number of covered items out of the declared total
+type CoverageCount struct {
+	Total   int     `json:"total"`
+	Covered int     `json:"covered"`
+	Percent float64 `json:"percent"`
+}
+
+// ActorCoverage is the coverage of one actor's state machine. Visit counts
+// are keyed by state name and by "from|label|to" for transitions; the
+// initial state counts as visited once.
+type ActorCoverage struct {
+	States               CoverageCount       `json:"states"`
+	Transitions          CoverageCount       `json:"transitions"`
+	UncoveredStates      []string            `json:"uncoveredStates"`
+	UncoveredTransitions []prolog.Transition `json:"uncoveredTransitions"`
+	StateVisits          map[string]int64    `json:"stateVisits"`
+	TransitionVisits     map[string]int64    `json:"transitionVisits"`
+}
+
+func (c *CoverageCount) add(covered bool) {
+	c.Total++
+	if covered {
+		c.Covered++
+	}
+	c.Percent = 100 * float64(c.Covered) / float64(c.Total)
+}
+
+// coverageMachines returns the state machines coverage is measured
+// against: the actor_state/3 and actor_transition/4 declarations, or for
+// plain transition/3 specs the transitions grouped by owning actor.
+func coverageMachines(ctx context.Context, engine *prolog.Engine) ([]prolog.ActorStateMachine, error) {
+	machines, err := engine.GetActorStateMachines(ctx)
+	if err != nil || len(machines) > 0 {
+		return machines, err
+	}
+
+	sm, err := engine.GetStateMachine(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stateActors, err := engine.GetStateActors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byActor := make(map[string]*prolog.ActorStateMachine)
+	seen := make(map[string]bool)
+	machine := func(state string) *prolog.ActorStateMachine {
+		actor := model.ActorOf(stateActors, state)
+		m, ok := byActor[actor]
+		if !ok {
+			m = &prolog.ActorStateMachine{Actor: actor, States: []string{}, Transitions: []prolog.Transition{}}
+			byActor[actor] = m
+		}
+		if !seen[state] {
+			seen[state] = true
+			m.States = append(m.States, state)
+		}
+		return m
+	}
+	for _, s := range sm.Initial {
+		if m := machine(s); m.Initial == "" {
+			m.Initial = s
+		}
+	}
+	for _, t := range sm.Transitions {
+		m := machine(t.From)
+		m.Transitions = append(m.Transitions, t)
+		machine(t.To)
+	}
+
+	for _, m := range byActor {
+		machines = append(machines, *m)
+	}
+	sort.Slice(machines, func(i, j int) bool { return machines[i].Actor < machines[j].Actor })
+	return machines, nil
+}
+
+// computeCoverage measures a trace against the declared state machines.
+// Transitions are matched by from, label and to, so the trace's actor
+// names need not agree with the declarations.
+func computeCoverage(machines []prolog.ActorStateMachine, trace []SimulationEvent) *Coverage {
+	stateVisits := make(map[string]int64)
+	transitionVisits := make(map[string]int64)
+	for _, m := range machines {
+		if m.Initial != "" {
+			stateVisits[m.Initial]++
+		}
+	}
+	for _, ev := range trace {
+		stateVisits[ev.To]++
+		transitionVisits[transitionKey(ev.From, ev.Label, ev.To)]++
+	}
+
+	cov := &Coverage{Actors: make(map[string]*ActorCoverage)}
+	for _, m := range machines {
+		ac := &ActorCoverage{
+			UncoveredStates:      []string{},
+			UncoveredTransitions: []prolog.Transition{},
+			StateVisits:          make(map[string]int64),
+			TransitionVisits:     make(map[string]int64),
+		}
+		states := append([]string(nil), m.States...)
+		sort.Strings(states)
+		for _, s := range states {
+			n := stateVisits[s]
+			ac.StateVisits[s] = n
+			ac.States.add(n > 0)
+			cov.States.add(n > 0)
+			if n == 0 {
+				ac.UncoveredStates = append(ac.UncoveredStates, s)
+			}
+		}
+		for _, t := range m.Transitions {
+			key := transitionKey(t.From, t.Label, t.To)
+			n := transitionVisits[key]
+			ac.TransitionVisits[key] = n
+			ac.Transitions.add(n > 0)
+			cov.Transitions.add(n > 0)
+			if n == 0 {
+				ac.UncoveredTransitions = append(ac.UncoveredTransitions, t)
+			}
+		}
+		cov.Actors[m.Actor] = ac
+	}
+	return cov
+}
+
+// heatmap flattens coverage visit counts for the statemachine overlay
+func (c *Coverage) heatmap() map[string]interface{} {
+	states := make(map[string]int64)
+	transitions := make(map[string]int64)
+	var max int64
+	for _, ac := range c.Actors {
+		for s, n := range ac.StateVisits {
+			states[s] = n
+			if n > max {
+				max = n
+			}
+		}
+		for k, n := range ac.TransitionVisits {
+			transitions[k] = n
+			if n > max {
+				max = n
+			}
+		}
+	}
+	return map[string]interface{}{
+		"states":      states,
+		"transitions": transitions,
+		"max":         max,
+	}
+}
+
+// simulationHeat returns visit counts from the cached simulation of
+// engine's spec, running one with default options if none is cached yet
+func (s *Server) simulationHeat(ctx context.Context, engine *prolog.Engine) (map[string]interface{}, error) {
+	result, err := s.cachedOrRunSimulation(engine)
+	if err != nil {
+		return nil, err
+	}
+
+	cov := result.Coverage
+	if cov == nil {
+		machines, err := coverageMachines(ctx, engine)
+		if err != nil {
+			return nil, err
+		}
+		cov = computeCoverage(machines, result.Timeline)
+	}
+	return cov.heatmap(), nil
+}
+
+// handleCoverage reports state and transition coverage. GET measures the
+// cached simulation; POST measures a trace of {from, label, to} steps,
+// such as one recorded from a test run.
+func (s *Server) handleCoverage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	var trace []SimulationEvent
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.RLock()
+		result := s.cachedSimulation
+		s.mu.RUnlock()
+		if result != nil {
+			trace = result.Timeline
+		}
+	case http.MethodPost:
+		var req struct {
+			Trace []SimulationEvent `json:"trace"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		trace = req.Trace
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	machines, err := coverageMachines(ctx, s.current())
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"coverage": computeCoverage(machines, trace),
+	})
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// branchSpec has a door whose locked branch can never be reached because
+// its guard always fails.
+const branchSpec = `
+        actor_initial(door, door_closed).
+        actor_state(door, door_closed, []).
+        actor_state(door, door_open, []).
+        actor_state(door, door_locked, []).
+        actor_transition(door, door_closed, open, door_open).
+        actor_transition(door, door_open, close, door_closed).
+        actor_transition(door, door_closed, lock, door_locked).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        transition_guard(door_closed, lock, door_locked, never).
+        never :- fail.
+    `
+
+func TestSimulationCoverageReportsUnexercisedStatesAndTransitions(t *testing.T) {
+	engine := loadTestEngine(t, branchSpec)
+	result := mustRunSimulation(t, engine, simulationOptions{Steps: 4})
+
+	if result.Coverage == nil {
+		t.Fatalf("expected coverage in the simulation result")
+	}
+	door := result.Coverage.Actors["door"]
+	if door == nil {
+		t.Fatalf("expected door coverage, got %+v", result.Coverage.Actors)
+	}
+	if door.States.Total != 3 || door.States.Covered != 2 {
+		t.Errorf("expected 2/3 states covered, got %+v", door.States)
+	}
+	if door.Transitions.Total != 3 || door.Transitions.Covered != 2 {
+		t.Errorf("expected 2/3 transitions covered, got %+v", door.Transitions)
+	}
+	if len(door.UncoveredStates) != 1 || door.UncoveredStates[0] != "door_locked" {
+		t.Errorf("expected door_locked uncovered, got %v", door.UncoveredStates)
+	}
+	if len(door.UncoveredTransitions) != 1 || door.UncoveredTransitions[0].Label != "lock" {
+		t.Errorf("expected lock uncovered, got %+v", door.UncoveredTransitions)
+	}
+	// closed initially plus twice more after close
+	if got := door.StateVisits["door_closed"]; got != 3 {
+		t.Errorf("expected door_closed visited 3 times, got %d", got)
+	}
+	if got := door.TransitionVisits[transitionKey("door_closed", "open", "door_open")]; got != 2 {
+		t.Errorf("expected open fired twice, got %d", got)
+	}
+}
+
+func TestCoverageEndpointMeasuresPostedTrace(t *testing.T) {
+	engine := loadTestEngine(t, branchSpec)
+	s := newTestServer(engine)
+
+	body := `{"trace":[{"from":"door_closed","label":"lock","to":"door_locked"}]}`
+	rec := httptest.NewRecorder()
+	s.handleCoverage(rec, httptest.NewRequest("POST", "/api/coverage", strings.NewReader(body)))
+
+	var resp struct {
+		Success  bool      `json:"success"`
+		Coverage *Coverage `json:"coverage"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !resp.Success || resp.Coverage == nil {
+		t.Fatalf("expected coverage, got %+v", resp)
+	}
+	if resp.Coverage.States.Covered != 2 || resp.Coverage.Transitions.Covered != 1 {
+		t.Errorf("expected 2 states and 1 transition covered, got %+v %+v",
+			resp.Coverage.States, resp.Coverage.Transitions)
+	}
+}
+
+func TestVisualizeStateMachineHeat(t *testing.T) {
+	engine := loadTestEngine(t, branchSpec)
+	s := newTestServer(engine)
+
+	rec := httptest.NewRecorder()
+	s.handleVisualize(rec, httptest.NewRequest("GET", "/api/visualize?type=statemachine&heat=simulation", nil))
+
+	var resp struct {
+		StateMachine struct {
+			Heat struct {
+				States      map[string]int64 `json:"states"`
+				Transitions map[string]int64 `json:"transitions"`
+				Max         int64            `json:"max"`
+			} `json:"heat"`
+		} `json:"stateMachine"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	heat := resp.StateMachine.Heat
+	if heat.Max == 0 || heat.States["door_open"] == 0 {
+		t.Errorf("expected visit counts, got %+v", heat)
+	}
+	if n, ok := heat.States["door_locked"]; !ok || n != 0 {
+		t.Errorf("expected door_locked with zero visits, got %d (present %v)", n, ok)
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// distribution is a parsed Prolog distribution term such as const(5),
+// uniform(2,4), exp(0.3) or normal(10,2).
+type distribution struct {
+	Kind   string
+	Params []float64
+}
+
+var distributionArity = map[string]int{
+	"const":   1,
+	"uniform": 2,
+	"exp":     1,
+	"normal":  2,
+}
+
+func parseDistribution(term string) (distribution, error) {
+	term = strings.TrimSpace(term)
+	open := strings.Index(term, "(")
+	if open <= 0 || !strings.HasSuffix(term, ")") {
+		// A bare number is shorthand for const(N)
+		if v, err := strconv.ParseFloat(term, 64); err == nil {
+			return distribution{Kind: "const", Params: []float64{v}}, nil
+		}
+		return distribution{}, fmt.Errorf("invalid distribution %q", term)
+	}
+
+	kind := strings.TrimSpace(term[:open])
+	arity, ok := distributionArity[kind]
+	if !ok {
+		return distribution{}, fmt.Errorf("unknown distribution %q", kind)
+	}
+
+	args := strings.Split(term[open+1:len(term)-1], ",")
+	if len(args) != arity {
+		return distribution{}, fmt.Errorf("%s/%d expects %d arguments in %q", kind, arity, arity, term)
+	}
+	params := make([]float64, len(args))
+	for i, arg := range args {
+		v, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+		if err != nil {
+			return distribution{}, fmt.Errorf("invalid %s argument %q: %w", kind, strings.TrimSpace(arg), err)
+		}
+		params[i] = v
+	}
+
+	switch kind {
+	case "uniform":
+		if params[0] > params[1] {
+			return distribution{}, fmt.Errorf("uniform low must not exceed high in %q", term)
+		}
+	case "exp":
+		if params[0] <= 0 {
+			return distribution{}, fmt.Errorf("exp rate must be positive in %q", term)
+		}
+	case "normal":
+		if params[1] < 0 {
+			return distribution{}, fmt.Errorf("normal standard deviation must be non-negative in %q", term)
+		}
+	}
+
+	return distribution{Kind: kind, Params: params}, nil
+}
+
+// parseDuration parses a distribution of transition durations, which
+// unlike random variables must not reach below zero. A normal duration
+// needs a positive mean; its tail below zero is truncated when sampled.
+func parseDuration(term string) (distribution, error) {
+	d, err := parseDistribution(term)
+	if err != nil {
+		return distribution{}, err
+	}
+	switch {
+	case d.Kind == "const" && d.Params[0] < 0:
+		return distribution{}, fmt.Errorf("const duration must be non-negative in %q", term)
+	case d.Kind == "uniform" && d.Params[0] < 0:
+		return distribution{}, fmt.Errorf("uniform duration low must be non-negative in %q", term)
+	case d.Kind == "normal" && d.Params[0] <= 0:
+		return distribution{}, fmt.Errorf("normal duration mean must be positive in %q", term)
+	}
+	return d, nil
+}
+
+// sample draws a value from the distribution
+func (d distribution) sample(rng *rand.Rand) float64 {
+	switch d.Kind {
+	case "const":
+		return d.Params[0]
+	case "uniform":
+		return d.Params[0] + rng.Float64()*(d.Params[1]-d.Params[0])
+	case "exp":
+		return rng.ExpFloat64() / d.Params[0]
+	case "normal":
+		return d.Params[0] + rng.NormFloat64()*d.Params[1]
+	}
+	return 0
+}
+
+// sampleDuration draws a duration, truncating negative normal draws to zero
+func (d distribution) sampleDuration(rng *rand.Rand) float64 {
+	return math.Max(0, d.sample(rng))
+}
+
+func (d distribution) String() string {
+	parts := make([]string, len(d.Params))
+	for i, p := range d.Params {
+		parts[i] = formatFloat(p)
+	}
+	return fmt.Sprintf("%s(%s)", d.Kind, strings.Join(parts, ","))
+}
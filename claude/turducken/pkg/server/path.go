@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rfielding/turducken/pkg/model"
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+// maxPaths caps how many paths one /api/path request may ask for
+const maxPaths = 100
+
+// pathRequest is a parsed /api/path query
+type pathRequest struct {
+	model   string
+	from    string
+	to      string
+	formula string
+	avoid   []string
+	via     []string
+	k       int
+}
+
+func parsePathRequest(r *http.Request) (pathRequest, error) {
+	query := r.URL.Query()
+	req := pathRequest{
+		model:   query.Get("model"),
+		from:    query.Get("from"),
+		to:      query.Get("to"),
+		formula: query.Get("formula"),
+		avoid:   query["avoid"],
+		via:     query["via"],
+		k:       1,
+	}
+	if (req.to == "") == (req.formula == "") {
+		return req, fmt.Errorf("give exactly one of to (a state or prop) or formula")
+	}
+	if k := query.Get("k"); k != "" {
+		v, err := strconv.Atoi(k)
+		if err != nil || v < 1 || v > maxPaths {
+			return req, fmt.Errorf("k must be between 1 and %d", maxPaths)
+		}
+		req.k = v
+	}
+	return req, nil
+}
+
+// pathGraph builds the graph a path request searches, and marks the nodes
+// that satisfy its target formula when it has one
+func pathGraph(ctx context.Context, engine *prolog.Engine, req pathRequest) (string, *model.Graph, []bool, error) {
+	modelName, err := resolveModel(ctx, engine, req.model)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	sys, err := model.Load(ctx, engine)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	var f *model.Formula
+	if req.formula != "" {
+		if f, err = parseProperty(sys, req.formula, false); err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	if modelName == modelComposed {
+		lts, err := sys.Explore(ctx, model.DefaultMaxStates)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		var sat []bool
+		if f != nil {
+			if sat, err = lts.Check(f); err != nil {
+				return "", nil, nil, err
+			}
+		}
+		return modelName, lts.Graph(), sat, nil
+	}
+
+	sm, err := engine.GetStateMachine(ctx)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	props, err := engine.GetStateProps(ctx, sm.States)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	g := model.TransitionGraph(sm, props)
+	var sat []bool
+	if f != nil {
+		check, err := engine.CheckStates(ctx, f.String(), false)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		satisfying := make(map[string]bool, len(check.Satisfying))
+		for _, state := range check.Satisfying {
+			satisfying[state] = true
+		}
+		sat = make([]bool, len(g.Nodes))
+		for i, name := range g.Nodes {
+			sat[i] = satisfying[name]
+		}
+	}
+	return modelName, g, sat, nil
+}
+
+// handlePath returns the shortest labelled paths from ?from= (a state or
+// prop; the initial states by default) to ?to= (a state or prop) or to a
+// state satisfying ?formula=. Repeated ?avoid= props are never entered,
+// repeated ?via= labels must all fire, and ?k= asks for the k shortest
+// loopless paths.
+func (s *Server) handlePath(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	req, err := parsePathRequest(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	modelName, g, sat, err := pathGraph(ctx, s.current(), req)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	q := model.PathQuery{
+		Sources: g.Initial,
+		Target:  make([]bool, len(g.Nodes)),
+		Via:     req.via,
+		K:       req.k,
+	}
+	if req.from != "" {
+		q.Sources = nil
+	}
+	if len(req.avoid) > 0 {
+		q.Avoid = make([]bool, len(g.Nodes))
+	}
+	for i := range g.Nodes {
+		if req.from != "" && g.Holds(i, req.from) {
+			q.Sources = append(q.Sources, i)
+		}
+		if sat != nil {
+			q.Target[i] = sat[i]
+		} else {
+			q.Target[i] = g.Holds(i, req.to)
+		}
+		for _, atom := range req.avoid {
+			if g.Holds(i, atom) {
+				q.Avoid[i] = true
+			}
+		}
+	}
+
+	paths, err := g.Paths(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	results := make([]map[string]interface{}, 0, len(paths))
+	for _, p := range paths {
+		results = append(results, map[string]interface{}{
+			"length": len(p),
+			"steps":  p,
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"model":   modelName,
+		"found":   len(paths) > 0,
+		"paths":   results,
+	})
+
+	s.incCounter("path_queries")
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rfielding/turducken/pkg/model"
+)
+
+func decodePaths(t *testing.T, s *Server, url string) (bool, string, [][]model.TraceStep) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.handlePath(rec, httptest.NewRequest("GET", url, nil))
+	var resp struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+		Model   string `json:"model"`
+		Paths   []struct {
+			Length int               `json:"length"`
+			Steps  []model.TraceStep `json:"steps"`
+		} `json:"paths"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	var paths [][]model.TraceStep
+	for _, p := range resp.Paths {
+		paths = append(paths, p.Steps)
+	}
+	if !resp.Success {
+		return false, resp.Error, nil
+	}
+	return true, resp.Model, paths
+}
+
+func TestPathEndpointTransitionModel(t *testing.T) {
+	engine := loadTestEngine(t, `
+        initial(coord_init).
+        prop(coord_aborted, aborted).
+        transition(coord_init, prepare, coord_waiting).
+        transition(coord_waiting, all_yes, coord_committed).
+        transition(coord_waiting, any_no, coord_aborted).
+        transition(coord_waiting, timeout, coord_aborted).
+    `)
+	s := newTestServer(engine)
+
+	ok, modelName, paths := decodePaths(t, s, "/api/path?from=coord_init&to=coord_aborted&k=3")
+	if !ok || modelName != modelTransition || len(paths) != 2 {
+		t.Fatalf("expected two paths over transition/3, got %v %s %v", ok, modelName, paths)
+	}
+	if paths[0][1].Label != "any_no" || paths[1][1].Label != "timeout" {
+		t.Errorf("expected any_no then timeout, got %+v", paths)
+	}
+
+	_, _, paths = decodePaths(t, s, "/api/path?to=coord_aborted&via=timeout")
+	if len(paths) != 1 || paths[0][1].Label != "timeout" {
+		t.Errorf("expected the timeout path, got %+v", paths)
+	}
+
+	_, _, paths = decodePaths(t, s, "/api/path?formula=ex(atom(aborted))")
+	if len(paths) != 1 || len(paths[0]) != 1 || paths[0][0].To != "coord_waiting" {
+		t.Errorf("expected a path to the state that can abort next, got %+v", paths)
+	}
+
+	_, _, paths = decodePaths(t, s, "/api/path?to=aborted&avoid=coord_waiting")
+	if len(paths) != 0 {
+		t.Errorf("expected no path around coord_waiting, got %+v", paths)
+	}
+
+	if ok, errMsg, _ := decodePaths(t, s, "/api/path?from=coord_init"); ok || errMsg == "" {
+		t.Errorf("expected an error without a target")
+	}
+
+	// Only a parsed formula reaches ctl_sat/2, so text closing the term
+	// early is rejected rather than run
+	injected := url.QueryEscape("atom(aborted)), assertz(injected(1)), (true")
+	if ok, _, _ := decodePaths(t, s, "/api/path?formula="+injected); ok {
+		t.Errorf("expected a formula with trailing goals to be rejected")
+	}
+	if found, err := engine.QueryOne(context.Background(), "catch(injected(_), _, fail)."); err != nil || found {
+		t.Errorf("expected the trailing goals never to run, got %v %v", found, err)
+	}
+}
+
+func TestPathEndpointComposedModel(t *testing.T) {
+	engine := loadTestEngine(t, handshakeSpec)
+	s := newTestServer(engine)
+
+	ok, modelName, paths := decodePaths(t, s, "/api/path?model=composed&to=client_done")
+	if !ok || modelName != modelComposed || len(paths) != 1 {
+		t.Fatalf("expected one composed path, got %v %s %+v", ok, modelName, paths)
+	}
+	want := []string{"request", "handle", "got_reply"}
+	for i, st := range paths[0] {
+		if st.Label != want[i] {
+			t.Errorf("expected labels %v, got %+v", want, paths[0])
+			break
+		}
+	}
+}
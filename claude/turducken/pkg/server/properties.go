@@ -0,0 +1,280 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+// propertyTimeout bounds each property check unless ?timeout= overrides it
+const propertyTimeout = 10 * time.Second
+
+// propertyDeps are the goals whose solutions property checks read: the
+// transition/3 model, the actors, channels and faults the composed model is
+// built from, and the timings of the _within operators. Cached verdicts
+// stand until one of them changes, so editing docs or charts keeps them.
+var propertyDeps = []string{
+	"transition(_, _, _)",
+	"initial(_)",
+	"state(_, _)",
+	"prop(_, _)",
+	"accepting(_)",
+	"progress(_)",
+	"actor(_)",
+	"actor(_, _)",
+	"actor_state(_, _, _)",
+	"actor_initial(_, _)",
+	"actor_transition(_, _, _, _)",
+	"channel(_, _)",
+	"send(_, _, _, _)",
+	"recv(_, _, _, _)",
+	"channel_fault(_, _)",
+	"channel_fault(_, _, _)",
+	"actor_may_crash(_, _)",
+	"actor_may_crash(_, _, _)",
+	"partition(_, _)",
+	"partition(_, _, _)",
+	"transition_duration(_, _, _, _)",
+	"param(_, _)",
+}
+
+// PropertyResult is the verdict for one property/3 declaration
+type PropertyResult struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Formula     string `json:"formula"`
+	Notation    string `json:"notation,omitempty"`
+	Satisfied   *bool  `json:"satisfied,omitempty"`
+	Error       string `json:"error,omitempty"`
+	// Cached is set when the verdict was reused from an earlier check
+	Cached bool `json:"cached,omitempty"`
+}
+
+// propertyVerdict is the cached part of a PropertyResult
+type propertyVerdict struct {
+	notation  string
+	satisfied *bool
+	err       string
+}
+
+// propertyCache holds verdicts by formula for one fingerprint of the
+// propertyDeps solutions, dropping them all when the fingerprint changes
+type propertyCache struct {
+	mu          sync.Mutex
+	fingerprint string
+	verdicts    map[string]propertyVerdict
+}
+
+func (c *propertyCache) get(fingerprint, formula string) (propertyVerdict, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if fingerprint == "" || fingerprint != c.fingerprint {
+		return propertyVerdict{}, false
+	}
+	v, ok := c.verdicts[formula]
+	return v, ok
+}
+
+func (c *propertyCache) put(fingerprint, formula string, v propertyVerdict) {
+	if fingerprint == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if fingerprint != c.fingerprint || c.verdicts == nil {
+		c.fingerprint = fingerprint
+		c.verdicts = make(map[string]propertyVerdict)
+	}
+	c.verdicts[formula] = v
+}
+
+// verifyProperties checks properties of engine's spec concurrently, each
+// under its own timeout, reusing cached verdicts. done is called as each check finishes,
+// never concurrently, with the number finished so far.
+func (s *Server) verifyProperties(ctx context.Context, engine *prolog.Engine, properties []prolog.Property, timeout time.Duration, done func(i, finished int, r PropertyResult)) []PropertyResult {
+	fingerprint, err := engine.Fingerprint(ctx, propertyDeps)
+	if err != nil {
+		log.Printf("Error fingerprinting spec, not caching properties: %v", err)
+		fingerprint = ""
+	}
+
+	results := make([]PropertyResult, len(properties))
+	var mu sync.Mutex
+	finished := 0
+	report := func(i int, r PropertyResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[i] = r
+		finished++
+		if done != nil {
+			done(i, finished, r)
+		}
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(properties) {
+		workers = len(properties)
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				report(i, s.verifyProperty(ctx, engine, properties[i], fingerprint, timeout))
+			}
+		}()
+	}
+	for i := range properties {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// verifyProperty checks one property, or returns its cached verdict.
+// Verdicts cut short by a timeout or cancellation are not cached.
+func (s *Server) verifyProperty(ctx context.Context, engine *prolog.Engine, prop prolog.Property, fingerprint string, timeout time.Duration) PropertyResult {
+	result := PropertyResult{
+		Name:        prop.Name,
+		Description: prop.Description,
+		Formula:     prop.Formula,
+	}
+	if v, ok := s.properties.get(fingerprint, prop.Formula); ok {
+		result.Notation, result.Satisfied, result.Error = v.notation, v.satisfied, v.err
+		result.Cached = true
+		s.incCounter("property_cache_hits")
+		return result
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	check, err := checkProperty(checkCtx, engine, prop.Formula, "")
+	s.incCounter("property_checks")
+	if err != nil {
+		result.Error = err.Error()
+		if errors.Is(checkCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			result.Error = fmt.Sprintf("timed out after %s", timeout)
+		}
+		if checkCtx.Err() != nil {
+			return result
+		}
+	} else {
+		// A declared property is a claim about the system, so it must
+		// hold from every initial state
+		result.Satisfied = &check.SatisfiedAll
+		result.Notation = check.Formula.Notation()
+	}
+	s.properties.put(fingerprint, prop.Formula, propertyVerdict{
+		notation:  result.Notation,
+		satisfied: result.Satisfied,
+		err:       result.Error,
+	})
+	return result
+}
+
+// parsePropertyTimeout reads the per-property ?timeout= duration
+func parsePropertyTimeout(r *http.Request) (time.Duration, error) {
+	param := r.URL.Query().Get("timeout")
+	if param == "" {
+		return propertyTimeout, nil
+	}
+	timeout, err := time.ParseDuration(param)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("timeout must be a positive duration such as 5s")
+	}
+	return timeout, nil
+}
+
+// handleProperties returns named properties from the spec with check results
+func (s *Server) handleProperties(w http.ResponseWriter, r *http.Request) {
+	timeout, err := parsePropertyTimeout(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	engine := s.current()
+	properties, err := engine.GetProperties(r.Context())
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"properties": s.verifyProperties(r.Context(), engine, properties, timeout, nil),
+	})
+}
+
+// handlePropertiesStream checks the properties over Server-Sent Events: a
+// "start" event with the count, a "result" event as each check finishes,
+// in whatever order they finish, and a final "done" event with them all.
+func (s *Server) handlePropertiesStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	timeout, err := parsePropertyTimeout(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	writeEvent := func(event string, data interface{}) {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			log.Printf("property stream encode error: %v", err)
+			return
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+		flusher.Flush()
+	}
+
+	engine := s.current()
+	properties, err := engine.GetProperties(r.Context())
+	if err != nil {
+		writeEvent("error", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	writeEvent("start", map[string]interface{}{"total": len(properties)})
+
+	results := s.verifyProperties(r.Context(), engine, properties, timeout, func(i, finished int, result PropertyResult) {
+		writeEvent("result", map[string]interface{}{
+			"index":    i,
+			"finished": finished,
+			"total":    len(properties),
+			"property": result,
+		})
+	})
+	if r.Context().Err() != nil {
+		return
+	}
+	writeEvent("done", map[string]interface{}{"properties": results})
+	s.incCounter("property_streams")
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var propertySpec = strings.Replace(requestSpec, "prop(server_done, handled).", `prop(server_done, handled).
+        prop(client_sent, sent).`, 1) + `
+        property(reachable, 'Each actor can finish', 'EF (handled | sent)').
+        property(always, 'Everything is handled', 'AG handled').
+        property(typo, 'Bad formula', 'EF (handled').
+    `
+
+func getProperties(t *testing.T, s *Server, url string) []PropertyResult {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.handleProperties(rec, httptest.NewRequest("GET", url, nil))
+	var resp struct {
+		Success    bool             `json:"success"`
+		Properties []PropertyResult `json:"properties"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !resp.Success || len(resp.Properties) != 3 {
+		t.Fatalf("expected three properties, got %+v", resp)
+	}
+	return resp.Properties
+}
+
+func TestPropertiesCachedUntilDependenciesChange(t *testing.T) {
+	engine := loadTestEngine(t, propertySpec)
+	s := newTestServer(engine)
+
+	first := getProperties(t, s, "/api/properties")
+	if first[0].Satisfied == nil || !*first[0].Satisfied || first[1].Satisfied == nil || *first[1].Satisfied {
+		t.Errorf("unexpected verdicts %+v", first)
+	}
+	if first[2].Error == "" {
+		t.Errorf("expected the malformed formula to report an error, got %+v", first[2])
+	}
+	for _, p := range first {
+		if p.Cached {
+			t.Errorf("expected %s to be checked on the first request", p.Name)
+		}
+	}
+
+	for _, p := range getProperties(t, s, "/api/properties") {
+		if !p.Cached {
+			t.Errorf("expected %s to be cached", p.Name)
+		}
+	}
+
+	// Only the server can reach handled, so a property claiming it does
+	// not hold even though some initial state satisfies it
+	partialEngine := loadTestEngine(t, strings.Replace(propertySpec, "EF (handled | sent)", "EF handled", 1))
+	partial := getProperties(t, newTestServer(partialEngine), "/api/properties")
+	if partial[0].Satisfied == nil || *partial[0].Satisfied {
+		t.Errorf("expected a property holding from only some initial states to fail, got %+v", partial[0])
+	}
+
+	// Docs aren't read by the checker, so they leave the verdicts cached
+	if err := engine.Reset(); err != nil {
+		t.Fatalf("Reset error: %v", err)
+	}
+	if err := engine.LoadSpec(propertySpec + "doc(overview, 'A request handler')."); err != nil {
+		t.Fatalf("LoadSpec error: %v", err)
+	}
+	if p := getProperties(t, s, "/api/properties"); !p[0].Cached {
+		t.Errorf("expected a doc change to keep the cache, got %+v", p[0])
+	}
+
+	// A new transition may change any verdict
+	if err := engine.Reset(); err != nil {
+		t.Fatalf("Reset error: %v", err)
+	}
+	spec := strings.Replace(propertySpec, "actor_transition(server, server_waiting, handle, server_done).",
+		"actor_transition(server, server_waiting, handle, server_done).\n        actor_transition(server, server_done, reset, server_waiting).", 1)
+	if err := engine.LoadSpec(spec); err != nil {
+		t.Fatalf("LoadSpec error: %v", err)
+	}
+	if p := getProperties(t, s, "/api/properties"); p[0].Cached {
+		t.Errorf("expected a transition change to invalidate the cache, got %+v", p[0])
+	}
+	if s.counters["property_cache_hits"] == 0 || s.counters["property_checks"] == 0 {
+		t.Errorf("expected checks and cache hits to be counted, got %v", s.counters)
+	}
+}
+
+func TestPropertyTimeoutsAreNotCached(t *testing.T) {
+	engine := loadTestEngine(t, propertySpec)
+	s := newTestServer(engine)
+
+	for _, p := range getProperties(t, s, "/api/properties?timeout=1ns")[:2] {
+		if p.Error != "timed out after 1ns" {
+			t.Errorf("expected %s to time out, got %+v", p.Name, p)
+		}
+	}
+	for _, p := range getProperties(t, s, "/api/properties")[:2] {
+		if p.Cached || p.Satisfied == nil {
+			t.Errorf("expected %s to be checked again, got %+v", p.Name, p)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleProperties(rec, httptest.NewRequest("GET", "/api/properties?timeout=soon", nil))
+	if rec.Code != 400 {
+		t.Errorf("expected a bad timeout to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestPropertiesStream(t *testing.T) {
+	engine := loadTestEngine(t, propertySpec)
+	s := newTestServer(engine)
+
+	rec := httptest.NewRecorder()
+	s.handlePropertiesStream(rec, httptest.NewRequest("GET", "/api/properties/stream", nil))
+	if got := rec.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %q", got)
+	}
+
+	var events []string
+	seen := make(map[int]bool)
+	var done struct {
+		Properties []PropertyResult `json:"properties"`
+	}
+	scanner := bufio.NewScanner(rec.Body)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+			events = append(events, event)
+		case strings.HasPrefix(line, "data: ") && event == "result":
+			var result struct {
+				Index    int `json:"index"`
+				Finished int `json:"finished"`
+			}
+			json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &result)
+			if result.Finished != len(seen)+1 {
+				t.Errorf("expected finished to count up, got %d after %d", result.Finished, len(seen))
+			}
+			seen[result.Index] = true
+		case strings.HasPrefix(line, "data: ") && event == "done":
+			json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &done)
+		}
+	}
+
+	if len(events) != 5 || events[0] != "start" || events[4] != "done" {
+		t.Fatalf("expected start, three results and done, got %v", events)
+	}
+	if len(seen) != 3 || len(done.Properties) != 3 || done.Properties[0].Name != "reachable" {
+		t.Errorf("expected every property reported once, got %v and %+v", seen, done.Properties)
+	}
+}
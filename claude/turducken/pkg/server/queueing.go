@@ -0,0 +1,187 @@
+package server
+
+import "sort"
+
+// ChannelMetrics reports how messages queued on a channel during a run.
+// Occupancy counts delivered messages waiting to be received. Blocking
+// events are counted once each time an idle actor finds a transition held
+// up by the channel: a send with no room, or a receive whose message is
+// not at the head.
+type ChannelMetrics struct {
+	Capacity     int   `json:"capacity"`
+	Delivered    int64 `json:"delivered"`
+	Received     int64 `json:"received"`
+	MaxOccupancy int   `json:"maxOccupancy"`
+	// MeanOccupancy is weighted by simulated time, or averaged per step
+	// when no transition takes time
+	MeanOccupancy float64 `json:"meanOccupancy"`
+	BlockedSends  int64   `json:"blockedSends"`
+	BlockedRecvs  int64   `json:"blockedRecvs"`
+	// MeanWait is the mean time from delivery to receipt; MeanWaitSteps
+	// counts completed transitions instead
+	MeanWait      float64      `json:"meanWait"`
+	MeanWaitSteps float64      `json:"meanWaitSteps"`
+	Series        []QueuePoint `json:"series"`
+
+	length    int
+	since     float64
+	area      float64
+	stepArea  float64
+	wait      float64
+	waitSteps float64
+}
+
+// QueuePoint is a channel's queue length after it changed
+type QueuePoint struct {
+	Step   int     `json:"step"`
+	Time   float64 `json:"time"`
+	Length int     `json:"length"`
+}
+
+// arrival is when a queued message was delivered
+type arrival struct {
+	time float64
+	step int
+}
+
+// blockKey identifies a transition held up by a channel
+type blockKey struct {
+	actor string
+	from  string
+	label string
+	ch    int
+	send  bool
+}
+
+func (sim *simulator) initChannels() {
+	sim.arrivals = make([][]arrival, len(sim.sys.Channels))
+	for i, name := range sim.sys.Channels {
+		sim.result.Channels[name] = &ChannelMetrics{
+			Capacity: sim.sys.Capacity[i],
+			Series:   []QueuePoint{{Step: 0, Time: 0, Length: 0}},
+		}
+	}
+}
+
+// queueChanged records a channel's new queue length
+func (sim *simulator) queueChanged(ch int) {
+	m := sim.result.Channels[sim.sys.Channels[ch]]
+	m.area += float64(m.length) * (sim.clock - m.since)
+	m.since = sim.clock
+	m.length = len(sim.global.Chans[ch])
+	if m.length > m.MaxOccupancy {
+		m.MaxOccupancy = m.length
+	}
+	m.Series = append(m.Series, QueuePoint{Step: int(sim.result.Total), Time: sim.clock, Length: m.length})
+}
+
+// arrive records a message delivered at position pos of a channel's queue
+func (sim *simulator) arrive(ch, pos int) {
+	a := arrival{time: sim.clock, step: int(sim.result.Total)}
+	queue := sim.arrivals[ch]
+	sim.arrivals[ch] = append(queue[:pos:pos], append([]arrival{a}, queue[pos:]...)...)
+	sim.result.Channels[sim.sys.Channels[ch]].Delivered++
+	sim.queueChanged(ch)
+}
+
+// receive takes the message at the head of a channel
+func (sim *simulator) receive(ch int) {
+	sim.global.Chans[ch] = sim.global.Chans[ch][1:]
+	m := sim.result.Channels[sim.sys.Channels[ch]]
+	if len(sim.arrivals[ch]) > 0 {
+		a := sim.arrivals[ch][0]
+		sim.arrivals[ch] = sim.arrivals[ch][1:]
+		m.wait += sim.clock - a.time
+		m.waitSteps += float64(int(sim.result.Total) - a.step)
+	}
+	m.Received++
+	sim.queueChanged(ch)
+}
+
+// sampleQueues adds each channel's length after a completed transition to
+// the per-step occupancy average
+func (sim *simulator) sampleQueues() {
+	for _, m := range sim.result.Channels {
+		m.stepArea += float64(m.length)
+	}
+}
+
+// noteBlocking counts transitions of idle actors that have become held up
+// by a channel since the last time the scheduler looked
+func (sim *simulator) noteBlocking() {
+	if !sim.composed {
+		return
+	}
+	blocked := make(map[blockKey]bool)
+	for i, actor := range sim.sys.Actors {
+		if sim.busy[actor] != nil {
+			continue
+		}
+		for _, st := range sim.sys.Steps(sim.global.Locals[i]) {
+			recvs, sends := sim.sys.Blocking(sim.global, st, sim.pending)
+			for _, ch := range recvs {
+				blocked[blockKey{actor, st.From, st.Label, ch, false}] = true
+			}
+			for _, ch := range sends {
+				blocked[blockKey{actor, st.From, st.Label, ch, true}] = true
+			}
+		}
+	}
+	for k := range blocked {
+		if sim.blocked[k] {
+			continue
+		}
+		m := sim.result.Channels[sim.sys.Channels[k.ch]]
+		if k.send {
+			m.BlockedSends++
+		} else {
+			m.BlockedRecvs++
+		}
+	}
+	sim.blocked = blocked
+}
+
+// channelSnapshot copies a channel's metrics, closing the occupancy and
+// wait averages at the current clock
+func (sim *simulator) channelSnapshot(m *ChannelMetrics) *ChannelMetrics {
+	c := *m
+	c.Series = append([]QueuePoint(nil), m.Series...)
+	area := m.area + float64(m.length)*(sim.clock-m.since)
+	switch {
+	case sim.clock > 0:
+		c.MeanOccupancy = area / sim.clock
+	case sim.result.Total > 0:
+		c.MeanOccupancy = m.stepArea / float64(sim.result.Total)
+	}
+	if m.Received > 0 {
+		c.MeanWait = m.wait / float64(m.Received)
+		c.MeanWaitSteps = m.waitSteps / float64(m.Received)
+	}
+	return &c
+}
+
+// channelSeries returns each channel's queue length by step as line chart
+// series named queue(Channel)
+func channelSeries(result *SimulationResult) []map[string]interface{} {
+	names := make([]string, 0, len(result.Channels))
+	for name := range result.Channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	series := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		points := make([]map[string]float64, 0, len(result.Channels[name].Series))
+		for _, p := range result.Channels[name].Series {
+			points = append(points, map[string]float64{
+				"x": float64(p.Step),
+				"y": float64(p.Length),
+			})
+		}
+		series = append(series, map[string]interface{}{
+			"name":   "queue(" + name + ")",
+			"points": points,
+		})
+	}
+	return series
+}
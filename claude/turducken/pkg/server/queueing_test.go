@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+// pipelineSpec has a producer that outpaces its consumer on a two-slot
+// channel, so items pile up until the producer blocks
+const pipelineSpec = `
+        actor_initial(producer, producer_ready).
+        actor_initial(consumer, consumer_waiting).
+        actor_transition(producer, producer_ready, produce, producer_ready).
+        actor_transition(consumer, consumer_waiting, consume, consumer_waiting).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        channel(items, 2).
+        send(items, item, producer_ready, producer_ready).
+        recv(items, item, consumer_waiting, consumer_waiting).
+        transition_duration(producer_ready, produce, producer_ready, const(1)).
+        transition_duration(consumer_waiting, consume, consumer_waiting, const(3)).
+    `
+
+func TestSimulationChannelMetrics(t *testing.T) {
+	engine := loadTestEngine(t, pipelineSpec)
+	result := mustRunSimulation(t, engine, simulationOptions{Steps: 20, Model: modelComposed})
+
+	m := result.Channels["items"]
+	if m == nil {
+		t.Fatalf("expected metrics for items, got %+v", result.Channels)
+	}
+	if m.Capacity != 2 || m.MaxOccupancy != 2 {
+		t.Errorf("expected the two-slot channel to fill, got %+v", m)
+	}
+	if m.BlockedSends == 0 {
+		t.Errorf("expected the producer to block on a full channel")
+	}
+	if m.BlockedRecvs != 1 {
+		t.Errorf("expected the consumer to block once on the empty channel, got %d", m.BlockedRecvs)
+	}
+	if m.Delivered < m.Received || m.Received == 0 {
+		t.Errorf("expected deliveries to cover receipts, got %+v", m)
+	}
+	if m.MeanWait <= 0 || m.MeanOccupancy <= 0 || m.MeanOccupancy > 2 {
+		t.Errorf("expected positive wait and occupancy within capacity, got %+v", m)
+	}
+	if len(m.Series) < 2 || m.Series[0].Length != 0 {
+		t.Errorf("expected a queue length series starting empty, got %+v", m.Series)
+	}
+	for _, p := range m.Series {
+		if p.Length > m.Capacity {
+			t.Errorf("queue length %d exceeds capacity at step %d", p.Length, p.Step)
+		}
+	}
+}
+
+func TestVisualizeLineFromSimulationChannels(t *testing.T) {
+	engine := loadTestEngine(t, pipelineSpec)
+	s := newTestServer(engine)
+	if err := s.runAndCacheSimulationWith(simulationOptions{Steps: 1000, Seed: 1, Model: modelComposed}); err != nil {
+		t.Fatalf("simulation error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleVisualize(rec, httptest.NewRequest("GET", "/api/visualize?type=line&source=simulation", nil))
+
+	var resp struct {
+		Line struct {
+			Series []struct {
+				Name   string               `json:"name"`
+				Points []map[string]float64 `json:"points"`
+			} `json:"series"`
+		} `json:"line"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(resp.Line.Series) != 1 || resp.Line.Series[0].Name != "queue(items)" || len(resp.Line.Series[0].Points) < 2 {
+		t.Errorf("expected a queue(items) series, got %+v", resp.Line.Series)
+	}
+}
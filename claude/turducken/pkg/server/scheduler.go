@@ -0,0 +1,204 @@
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/rfielding/turducken/pkg/model"
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+// candidate is an enabled transition on an idle actor, with the draws
+// its guards were evaluated against
+type candidate struct {
+	actor string
+	t     prolog.Transition
+	step  *model.Step
+	draws map[string]float64
+}
+
+func (c candidate) key() string {
+	return c.actor + "|" + transitionKey(c.t.From, c.t.Label, c.t.To)
+}
+
+// scheduler decides which enabled transition the simulator starts next.
+// pick is called with a non-empty candidate list on every scheduling
+// decision, so stateful policies can track enablement over time.
+type scheduler interface {
+	name() string
+	pick(rng *rand.Rand, candidates []candidate) candidate
+}
+
+const defaultSchedulerPolicy = "uniform"
+
+// schedulerPolicies lists the selectable scheduling policies by name
+var schedulerPolicies = map[string]func(priorities map[string]float64) scheduler{
+	"uniform": func(map[string]float64) scheduler { return uniformScheduler{} },
+	"actor":   func(map[string]float64) scheduler { return actorScheduler{} },
+	"round_robin": func(map[string]float64) scheduler {
+		return &roundRobinScheduler{}
+	},
+	"priority": func(priorities map[string]float64) scheduler {
+		return priorityScheduler{priorities: priorities}
+	},
+	"weak_fair": func(map[string]float64) scheduler {
+		return &fairScheduler{strong: false, enabled: make(map[string]int)}
+	},
+	"strong_fair": func(map[string]float64) scheduler {
+		return &fairScheduler{strong: true, enabled: make(map[string]int)}
+	},
+}
+
+func newScheduler(policy string, priorities map[string]float64) (scheduler, error) {
+	if policy == "" {
+		policy = defaultSchedulerPolicy
+	}
+	factory, ok := schedulerPolicies[policy]
+	if !ok {
+		return nil, fmt.Errorf("unknown scheduler %q (expected one of %s)", policy, strings.Join(schedulerPolicyNames(), ", "))
+	}
+	return factory(priorities), nil
+}
+
+func schedulerPolicyNames() []string {
+	names := make([]string, 0, len(schedulerPolicies))
+	for name := range schedulerPolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// uniformScheduler picks uniformly among all enabled transitions, so actors
+// with more outgoing transitions are scheduled more often.
+type uniformScheduler struct{}
+
+func (uniformScheduler) name() string { return "uniform" }
+
+func (uniformScheduler) pick(rng *rand.Rand, candidates []candidate) candidate {
+	return candidates[rng.Intn(len(candidates))]
+}
+
+// actorScheduler picks uniformly among actors with an enabled transition,
+// then uniformly among that actor's transitions.
+type actorScheduler struct{}
+
+func (actorScheduler) name() string { return "actor" }
+
+func (actorScheduler) pick(rng *rand.Rand, candidates []candidate) candidate {
+	actors, byActor := groupByActor(candidates)
+	own := byActor[actors[rng.Intn(len(actors))]]
+	return own[rng.Intn(len(own))]
+}
+
+// roundRobinScheduler cycles through actors in name order, skipping actors
+// with nothing enabled, and picks uniformly among the chosen actor's transitions.
+type roundRobinScheduler struct {
+	last string
+}
+
+func (*roundRobinScheduler) name() string { return "round_robin" }
+
+func (s *roundRobinScheduler) pick(rng *rand.Rand, candidates []candidate) candidate {
+	actors, byActor := groupByActor(candidates)
+	next := actors[0]
+	for _, actor := range actors {
+		if actor > s.last {
+			next = actor
+			break
+		}
+	}
+	s.last = next
+	own := byActor[next]
+	return own[rng.Intn(len(own))]
+}
+
+// priorityScheduler picks uniformly among the enabled transitions with the
+// highest transition_priority/4 (undeclared transitions have priority 0).
+type priorityScheduler struct {
+	priorities map[string]float64
+}
+
+func (priorityScheduler) name() string { return "priority" }
+
+func (s priorityScheduler) pick(rng *rand.Rand, candidates []candidate) candidate {
+	var best []candidate
+	bestPriority := 0.0
+	for _, c := range candidates {
+		p := s.priorities[transitionKey(c.t.From, c.t.Label, c.t.To)]
+		switch {
+		case len(best) == 0 || p > bestPriority:
+			best = []candidate{c}
+			bestPriority = p
+		case p == bestPriority:
+			best = append(best, c)
+		}
+	}
+	return best[rng.Intn(len(best))]
+}
+
+// fairScheduler favours the transitions that have waited longest. Under weak
+// fairness it picks the transition continuously enabled for the most
+// decisions; under strong fairness it picks the one enabled at the most
+// decisions since it last fired, even if it was disabled in between.
+type fairScheduler struct {
+	strong  bool
+	enabled map[string]int
+}
+
+func (s *fairScheduler) name() string {
+	if s.strong {
+		return "strong_fair"
+	}
+	return "weak_fair"
+}
+
+func (s *fairScheduler) pick(rng *rand.Rand, candidates []candidate) candidate {
+	current := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		key := c.key()
+		current[key] = true
+		s.enabled[key]++
+	}
+	if !s.strong {
+		// Weak fairness only credits continuous enablement
+		for key := range s.enabled {
+			if !current[key] {
+				delete(s.enabled, key)
+			}
+		}
+	}
+
+	var best []candidate
+	bestWait := 0
+	for _, c := range candidates {
+		wait := s.enabled[c.key()]
+		switch {
+		case wait > bestWait:
+			best = []candidate{c}
+			bestWait = wait
+		case wait == bestWait:
+			best = append(best, c)
+		}
+	}
+	chosen := best[rng.Intn(len(best))]
+	delete(s.enabled, chosen.key())
+	return chosen
+}
+
+// groupByActor returns the actors with candidates in name order, and the
+// candidates of each actor.
+func groupByActor(candidates []candidate) ([]string, map[string][]candidate) {
+	byActor := make(map[string][]candidate)
+	var actors []string
+	for _, c := range candidates {
+		if _, ok := byActor[c.actor]; !ok {
+			actors = append(actors, c.actor)
+		}
+		byActor[c.actor] = append(byActor[c.actor], c)
+	}
+	sort.Strings(actors)
+	return actors, byActor
+}
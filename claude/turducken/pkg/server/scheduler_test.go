@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+const twoLoopSpec = `
+        actor_initial(left, left_s).
+        actor_initial(right, right_s).
+        actor_transition(left, left_s, ping, left_s).
+        actor_transition(right, right_s, pong, right_s).
+        actor_transition(right, right_s, pang, right_s).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+`
+
+func TestRoundRobinSchedulerAlternatesActors(t *testing.T) {
+	engine := loadTestEngine(t, twoLoopSpec)
+
+	result := mustRunSimulation(t, engine, simulationOptions{Steps: 6, Scheduler: "round_robin"})
+	if result.Scheduler != "round_robin" {
+		t.Errorf("expected scheduler round_robin, got %q", result.Scheduler)
+	}
+	for i, ev := range result.Timeline {
+		want := "left"
+		if i%2 == 1 {
+			want = "right"
+		}
+		if ev.Actor != want {
+			t.Fatalf("step %d: expected %s, got %s", i, want, ev.Actor)
+		}
+	}
+}
+
+func TestPrioritySchedulerPrefersHighestPriority(t *testing.T) {
+	engine := loadTestEngine(t, twoLoopSpec+`
+        transition_priority(right_s, pang, right_s, 5).
+        transition_priority(left_s, ping, left_s, 1).
+    `)
+
+	result := mustRunSimulation(t, engine, simulationOptions{Steps: 5, Scheduler: "priority"})
+	if result.ByType["pang"] != 5 {
+		t.Errorf("expected only pang to fire, got %v", result.ByType)
+	}
+}
+
+func TestDuplicateTransitionPriorityRejected(t *testing.T) {
+	engine := loadTestEngine(t, twoLoopSpec+`
+        transition_priority(right_s, pang, right_s, 5).
+        transition_priority(right_s, pang, right_s, 1).
+    `)
+	if err := validateSpec(context.Background(), engine); err == nil {
+		t.Errorf("expected a duplicate transition_priority to be rejected")
+	}
+}
+
+func TestWeakFairSchedulerServesEveryTransition(t *testing.T) {
+	engine := loadTestEngine(t, twoLoopSpec)
+
+	result := mustRunSimulation(t, engine, simulationOptions{Steps: 30, Scheduler: "weak_fair"})
+	for _, label := range []string{"ping", "pong", "pang"} {
+		if result.ByType[label] != 10 {
+			t.Errorf("expected %s to fire 10 times under weak fairness, got %v", label, result.ByType)
+			break
+		}
+	}
+}
+
+func TestStrongFairSchedulerCountsIntermittentEnablement(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	a := candidate{actor: "x", t: prolog.Transition{From: "s", Label: "a", To: "s"}}
+	b := candidate{actor: "x", t: prolog.Transition{From: "s", Label: "b", To: "s"}}
+
+	// b was enabled twice before being disabled for one decision
+	strong := &fairScheduler{strong: true, enabled: map[string]int{b.key(): 2}}
+	strong.pick(rng, []candidate{a})
+	if got := strong.pick(rng, []candidate{a, b}); got.t.Label != "b" {
+		t.Errorf("expected strong fairness to keep b's credit, picked %s", got.t.Label)
+	}
+
+	weak := &fairScheduler{strong: false, enabled: map[string]int{b.key(): 2}}
+	weak.pick(rng, []candidate{a})
+	if weak.enabled[b.key()] != 0 {
+		t.Errorf("expected weak fairness to drop b's credit once disabled")
+	}
+}
+
+func TestUnknownScheduler(t *testing.T) {
+	engine := loadTestEngine(t, twoLoopSpec)
+
+	if _, err := runSimulation(context.Background(), engine, simulationOptions{Steps: 1, Scheduler: "lottery", Seed: 1}); err == nil {
+		t.Errorf("expected unknown scheduler to be rejected")
+	}
+}
@@ -1,14 +1,15 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"math"
-	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -16,9 +17,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rfielding/turducken/pkg/llm"
+	"github.com/rfielding/turducken/pkg/model"
 	"github.com/rfielding/turducken/pkg/prolog"
 )
 
@@ -27,7 +30,10 @@ var staticFiles embed.FS
 
 // Server is the main HTTP server for turducken
 type Server struct {
-	engine   *prolog.Engine
+	// live is the engine of the current spec. It is replaced, never
+	// reloaded in place, so a request that loads it once sees one spec
+	// throughout.
+	live     atomic.Pointer[prolog.Engine]
 	llm      *llm.Client
 	specFile string
 	version  string
@@ -40,6 +46,13 @@ type Server struct {
 
 	// Cached simulation result - computed once when spec loads
 	cachedSimulation *SimulationResult
+
+	// Property verdicts, kept while the predicates they read are unchanged
+	properties propertyCache
+
+	// Streaming simulation runs, tracked by id for pause/resume
+	runs      map[string]*simulationRun
+	nextRunID int64
 }
 
 type TimePoint struct {
@@ -94,9 +107,18 @@ func (s *Server) getTimeSeries() []TimePoint {
 	return result
 }
 
-// New creates a new server instance
+// sandboxLimits bound each query against specs submitted over HTTP. The
+// bundled specs stay well inside them: their largest query takes about a
+// quarter of a million inferences.
+var sandboxLimits = prolog.Limits{
+	Inferences: 5_000_000,
+	TermSize:   100_000,
+}
+
+// New creates a new server instance. The spec file is trusted; specs posted
+// to /api/spec and queries posted to /api/query run sandboxed.
 func New(specFile string, version string) (*Server, error) {
-	engine, err := prolog.New()
+	engine, err := prolog.New(prolog.WithLogger(log.Default()), prolog.WithSandbox(sandboxLimits))
 	if err != nil {
 		return nil, fmt.Errorf("creating prolog engine: %w", err)
 	}
@@ -106,13 +128,13 @@ func New(specFile string, version string) (*Server, error) {
 	}
 
 	s := &Server{
-		engine:     engine,
 		llm:        llm.New(),
 		specFile:   specFile,
 		version:    version,
 		counters:   make(map[string]int64),
 		timeSeries: []TimePoint{},
 	}
+	s.live.Store(engine)
 
 	if err := engine.AssertTurduckenVersion(version); err != nil {
 		return nil, fmt.Errorf("asserting version: %w", err)
@@ -123,10 +145,10 @@ func New(specFile string, version string) (*Server, error) {
 		if err != nil {
 			return nil, fmt.Errorf("reading spec file: %w", err)
 		}
-		if err := engine.LoadSpec(string(content)); err != nil {
+		if err := engine.LoadTrustedSpec(string(content)); err != nil {
 			return nil, fmt.Errorf("loading spec: %w", err)
 		}
-		if err := validateTransitionProbabilities(context.Background(), engine); err != nil {
+		if err := validateSpec(context.Background(), engine); err != nil {
 			return nil, err
 		}
 		s.runAndCacheSimulation(1000)
@@ -148,6 +170,7 @@ func (s *Server) ListenAndServe(addr string) error {
 	mux.HandleFunc("/api/reset", s.handleReset)
 	mux.HandleFunc("/api/provider", s.handleProvider)
 	mux.HandleFunc("/api/properties", s.handleProperties)
+	mux.HandleFunc("/api/properties/stream", s.handlePropertiesStream)
 	mux.HandleFunc("/api/docs", s.handleDocs)
 	mux.HandleFunc("/api/actors", s.handleActors)
 	mux.HandleFunc("/api/predicates", s.handlePredicates)
@@ -156,6 +179,14 @@ func (s *Server) ListenAndServe(addr string) error {
 	mux.HandleFunc("/api/metrics", s.handleMetrics)
 	mux.HandleFunc("/api/openapi", s.handleOpenAPI)
 	mux.HandleFunc("/api/simulate", s.handleSimulate) // Add this line
+	mux.HandleFunc("/api/simulate/stream", s.handleSimulateStream)
+	mux.HandleFunc("/api/simulate/control", s.handleSimulateControl)
+	mux.HandleFunc("/api/coverage", s.handleCoverage)
+	mux.HandleFunc("/api/sweep", s.handleSweep)
+	mux.HandleFunc("/api/analyze/deadlock", s.handleAnalyzeDeadlock)
+	mux.HandleFunc("/api/analyze/starvation", s.handleAnalyzeStarvation)
+	mux.HandleFunc("/api/analyze/statespace", s.handleAnalyzeStateSpace)
+	mux.HandleFunc("/api/path", s.handlePath)
 
 	// Static files (embedded)
 	mux.HandleFunc("/", s.handleStatic)
@@ -164,6 +195,52 @@ func (s *Server) ListenAndServe(addr string) error {
 	return http.ListenAndServe(addr, mux)
 }
 
+// specLoadError is a spec that failed to load, as opposed to one that
+// loaded but failed validation
+type specLoadError struct{ err error }
+
+func (e *specLoadError) Error() string { return e.err.Error() }
+func (e *specLoadError) Unwrap() error { return e.err }
+
+// stageSpec loads a spec into a fresh engine with load, then validates and
+// simulates it there. The live engine is untouched until the result is
+// passed to publishSpec. A failed simulation is logged, not returned, and
+// gives a nil result.
+func (s *Server) stageSpec(load func(*prolog.Engine) error) (*prolog.Engine, *SimulationResult, error) {
+	next, err := s.current().Fresh()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := load(next); err != nil {
+		return nil, nil, &specLoadError{err}
+	}
+	if err := validateSpec(context.Background(), next); err != nil {
+		return nil, nil, err
+	}
+
+	result, err := runSimulation(context.Background(), next, simulationOptions{Steps: 1000, Seed: newSeed()})
+	if err != nil {
+		log.Printf("simulation error: %v", err)
+		return next, nil, nil
+	}
+	return next, &result, nil
+}
+
+// publishSpec swaps a staged engine in for the live one. Requests already
+// holding the old engine finish against the old spec; streaming runs of it
+// are cancelled.
+func (s *Server) publishSpec(next *prolog.Engine, sim *SimulationResult) {
+	s.cancelRuns()
+	s.live.Store(next)
+	s.cacheSimulation(sim)
+}
+
+// current returns the live engine. Handlers load it once and use that
+// engine for the whole request.
+func (s *Server) current() *prolog.Engine {
+	return s.live.Load()
+}
+
 // handleSpec handles GET/POST for the Prolog specification
 func (s *Server) handleSpec(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -171,7 +248,7 @@ func (s *Server) handleSpec(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		json.NewEncoder(w).Encode(map[string]string{
-			"source": s.engine.GetSource(),
+			"source": s.current().GetSource(),
 			"file":   s.specFile,
 		})
 
@@ -190,48 +267,15 @@ func (s *Server) handleSpec(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		prevSource := s.engine.GetSource()
-		restorePrev := func() {
-			if prevSource == "" {
-				return
-			}
-			_ = s.engine.Reset()
-			_ = s.engine.AssertTurduckenVersion(s.version)
-			_ = s.engine.LoadSpec(prevSource)
-			s.runAndCacheSimulation(1000)
-		}
-
-		// Reset and reload
-		if err := s.engine.Reset(); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		if err := s.engine.AssertTurduckenVersion(s.version); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		if err := s.engine.LoadSpec(req.Source); err != nil {
-			fixedSource, fixed := autoFixSpec(req.Source)
-			if fixed {
-				if err := s.engine.Reset(); err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				if err := s.engine.AssertTurduckenVersion(s.version); err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				if err := s.engine.LoadSpec(fixedSource); err == nil {
-					if err := validateTransitionProbabilities(context.Background(), s.engine); err != nil {
-						restorePrev()
-						json.NewEncoder(w).Encode(map[string]interface{}{
-							"success": false,
-							"error":   err.Error(),
-							"source":  req.Source,
-						})
-						return
-					}
-					s.runAndCacheSimulation(1000)
+		// The spec is loaded and checked in a fresh engine, so a bad one
+		// leaves the current spec in place
+		next, sim, err := s.stageSpec(func(e *prolog.Engine) error { return e.LoadSpec(req.Source) })
+		var loadErr *specLoadError
+		if errors.As(err, &loadErr) {
+			if fixedSource, fixed := autoFixSpec(req.Source); fixed {
+				next, sim, err = s.stageSpec(func(e *prolog.Engine) error { return e.LoadSpec(fixedSource) })
+				if err == nil {
+					s.publishSpec(next, sim)
 					json.NewEncoder(w).Encode(map[string]interface{}{
 						"success": true,
 						"fixed":   true,
@@ -239,19 +283,26 @@ func (s *Server) handleSpec(w http.ResponseWriter, r *http.Request) {
 					})
 					return
 				}
+				var fixErr *specLoadError
+				if !errors.As(err, &fixErr) {
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"success": false,
+						"error":   err.Error(),
+						"source":  req.Source,
+					})
+					return
+				}
 			}
 
 			json.NewEncoder(w).Encode(map[string]interface{}{
 				"success":    false,
-				"error":      err.Error(),
+				"error":      loadErr.Error(),
 				"source":     req.Source,
 				"canAutoFix": true,
 			})
 			return
 		}
-
-		if err := validateTransitionProbabilities(context.Background(), s.engine); err != nil {
-			restorePrev()
+		if err != nil {
 			json.NewEncoder(w).Encode(map[string]interface{}{
 				"success": false,
 				"error":   err.Error(),
@@ -260,8 +311,7 @@ func (s *Server) handleSpec(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Run simulation immediately and cache the result
-		s.runAndCacheSimulation(1000)
+		s.publishSpec(next, sim)
 
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": true,
@@ -318,17 +368,48 @@ func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	var req struct {
-		Query string `json:"query"`
+		Query  string          `json:"query"`
+		Params json.RawMessage `json:"params"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	args, err := queryArgs(req.Params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	bindings, err := s.engine.RawQueryBindings(ctx, req.Query)
+	// Each query runs on its own engine, so facts it asserts or retracts
+	// are never seen by other requests
+	engine, err := s.current().Clone()
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	var bindings interface{}
+	solved := false
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "text":
+		var rows []map[string]string
+		rows, err = engine.RawQueryBindings(ctx, req.Query, args...)
+		bindings, solved = rows, len(rows) > 0
+	case "terms":
+		var rows []map[string]prolog.JSONTerm
+		rows, err = engine.RawQueryTerms(ctx, req.Query, args...)
+		bindings, solved = rows, len(rows) > 0
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q, expected text or terms", format), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -338,7 +419,7 @@ func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
 	}
 
 	result := "false"
-	if len(bindings) > 0 {
+	if solved {
 		result = "true"
 	}
 
@@ -351,6 +432,39 @@ func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
 	s.incCounter("queries")
 }
 
+// queryArgs reads a query's params: an object of JSON terms binds variables
+// by name, an array binds ? placeholders in order
+func queryArgs(raw json.RawMessage) ([]interface{}, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	switch raw[0] {
+	case '{':
+		var named map[string]prolog.JSONTerm
+		if err := json.Unmarshal(raw, &named); err != nil {
+			return nil, fmt.Errorf("params: %w", err)
+		}
+		params := make(prolog.Params, len(named))
+		for name, term := range named {
+			params[name] = term
+		}
+		return []interface{}{params}, nil
+	case '[':
+	default:
+		return nil, fmt.Errorf("params must be an object or array of terms")
+	}
+	var positional []prolog.JSONTerm
+	if err := json.Unmarshal(raw, &positional); err != nil {
+		return nil, fmt.Errorf("params: %w", err)
+	}
+	args := make([]interface{}, len(positional))
+	for i, term := range positional {
+		args[i] = term
+	}
+	return args, nil
+}
+
 // handleVisualize generates visualization data from the current spec
 func (s *Server) handleVisualize(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -358,8 +472,6 @@ func (s *Server) handleVisualize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-
 	visType := r.URL.Query().Get("type")
 	if visType == "" {
 		visType = "all"
@@ -367,20 +479,70 @@ func (s *Server) handleVisualize(w http.ResponseWriter, r *http.Request) {
 
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
+	engine := s.current()
+
+	axis := r.URL.Query().Get("axis")
+	if axis != "" && axis != timelineAxisTime && axis != timelineAxisSteps {
+		http.Error(w, "axis must be time or steps", http.StatusBadRequest)
+		return
+	}
+	var highlight *checkResult
+	if formula := r.URL.Query().Get("formula"); formula != "" && (visType == "statemachine" || visType == "all") {
+		result, err := highlightFormula(ctx, engine, formula)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		highlight = &result
+	}
+	if visType == "timeline" && r.URL.Query().Get("format") == "svg" {
+		tl, err := s.extractTimeline(ctx, engine, axis)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		io.WriteString(w, tl.SVG())
+		s.incCounter("visualizations")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 
 	result := make(map[string]interface{})
 
 	if visType == "statemachine" || visType == "all" {
-		sm, err := s.extractStateMachine(ctx)
+		extract := s.extractStateMachine
+		if r.URL.Query().Get("collapse") == "scc" {
+			extract = s.extractCollapsedStateMachine
+		}
+		sm, err := extract(ctx, engine)
 		if err != nil {
 			log.Printf("Error extracting state machine: %v", err)
 		} else {
+			if r.URL.Query().Get("heat") == "simulation" {
+				if heat, err := s.simulationHeat(ctx, engine); err != nil {
+					log.Printf("Error computing simulation heat: %v", err)
+				} else {
+					sm["heat"] = heat
+				}
+			}
+			if highlight != nil {
+				sm["formula"] = map[string]interface{}{
+					"formula":    highlight.Formula.String(),
+					"notation":   highlight.Formula.Notation(),
+					"satisfied":  highlight.Satisfied,
+					"initial":    highlight.Check.Initial,
+					"satisfying": highlight.Check.Satisfying,
+					"violating":  highlight.Check.Violating,
+				}
+			}
 			result["stateMachine"] = sm
 		}
 	}
 
 	if visType == "sequence" || visType == "all" {
-		seq, err := s.extractSequence(ctx)
+		seq, err := s.extractSequence(ctx, engine)
 		if err != nil {
 			log.Printf("Error extracting sequence: %v", err)
 		} else {
@@ -389,7 +551,7 @@ func (s *Server) handleVisualize(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if visType == "pie" || visType == "all" {
-		pie, err := s.extractPie(ctx)
+		pie, err := s.extractPie(ctx, engine)
 		if err != nil {
 			log.Printf("Error extracting pie: %v", err)
 		} else {
@@ -397,8 +559,16 @@ func (s *Server) handleVisualize(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if visType == "line" || visType == "all" {
-		line, err := s.extractLine(ctx)
+	if visType == "line" && r.URL.Query().Get("source") == "simulation" {
+		if sim, err := s.cachedOrRunSimulation(engine); err != nil {
+			log.Printf("Error extracting simulation line: %v", err)
+		} else {
+			result["line"] = map[string]interface{}{
+				"series": channelSeries(sim),
+			}
+		}
+	} else if visType == "line" || visType == "all" {
+		line, err := s.extractLine(ctx, engine)
 		if err != nil {
 			log.Printf("Error extracting line: %v", err)
 		} else {
@@ -406,13 +576,28 @@ func (s *Server) handleVisualize(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if visType == "timeline" || visType == "all" {
+		tl, err := s.extractTimeline(ctx, engine, axis)
+		if err != nil {
+			log.Printf("Error extracting timeline: %v", err)
+		} else {
+			result["timeline"] = map[string]interface{}{
+				"axis":     tl.Axis,
+				"end":      tl.End,
+				"lanes":    tl.Lanes,
+				"messages": tl.Messages,
+				"mermaid":  tl.Mermaid(),
+			}
+		}
+	}
+
 	json.NewEncoder(w).Encode(result)
 
 	s.incCounter("visualizations")
 }
 
-func (s *Server) extractStateMachine(ctx context.Context) (map[string]interface{}, error) {
-	sm, err := s.engine.GetStateMachine(ctx)
+func (s *Server) extractStateMachine(ctx context.Context, engine *prolog.Engine) (map[string]interface{}, error) {
+	sm, err := engine.GetStateMachine(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -435,8 +620,18 @@ func (s *Server) extractStateMachine(ctx context.Context) (map[string]interface{
 	}, nil
 }
 
-func (s *Server) extractSequence(ctx context.Context) (map[string]interface{}, error) {
-	seq, err := s.engine.GetSequenceDiagram(ctx)
+// extractCollapsedStateMachine returns the state machine with its cycles
+// collapsed into single states
+func (s *Server) extractCollapsedStateMachine(ctx context.Context, engine *prolog.Engine) (map[string]interface{}, error) {
+	sm, err := engine.GetStateMachine(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return collapseStateMachine(sm), nil
+}
+
+func (s *Server) extractSequence(ctx context.Context, engine *prolog.Engine) (map[string]interface{}, error) {
+	seq, err := engine.GetSequenceDiagram(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -458,8 +653,8 @@ func (s *Server) extractSequence(ctx context.Context) (map[string]interface{}, e
 	}, nil
 }
 
-func (s *Server) extractPie(ctx context.Context) (map[string]interface{}, error) {
-	slices, err := s.engine.GetPieChart(ctx)
+func (s *Server) extractPie(ctx context.Context, engine *prolog.Engine) (map[string]interface{}, error) {
+	slices, err := engine.GetPieChart(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -478,8 +673,8 @@ func (s *Server) extractPie(ctx context.Context) (map[string]interface{}, error)
 	}, nil
 }
 
-func (s *Server) extractLine(ctx context.Context) (map[string]interface{}, error) {
-	points, err := s.engine.GetLineChart(ctx)
+func (s *Server) extractLine(ctx context.Context, engine *prolog.Engine) (map[string]interface{}, error) {
+	points, err := engine.GetLineChart(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -515,10 +710,30 @@ type ActorStateMachine struct {
 	Initial     string              `json:"initial"`
 }
 
-// TODO: Implement when engine supports variable binding extraction
-func (s *Server) extractActorStateMachines(ctx context.Context) ([]ActorStateMachine, error) {
-	// Requires engine.GetActorStateMachines() to be implemented
-	return nil, nil
+func (s *Server) extractActorStateMachines(ctx context.Context, engine *prolog.Engine) ([]ActorStateMachine, error) {
+	machines, err := coverageMachines(ctx, engine)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]ActorStateMachine, len(machines))
+	for i, m := range machines {
+		transitions := make([]map[string]string, len(m.Transitions))
+		for j, t := range m.Transitions {
+			transitions[j] = map[string]string{
+				"from":  t.From,
+				"label": t.Label,
+				"to":    t.To,
+			}
+		}
+		out[i] = ActorStateMachine{
+			Actor:       m.Actor,
+			States:      m.States,
+			Transitions: transitions,
+			Initial:     m.Initial,
+		}
+	}
+	return out, nil
 }
 
 // handleChat handles LLM chat requests
@@ -540,7 +755,7 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Build prompt with current spec context
-	currentSpec := s.engine.GetSource()
+	currentSpec := s.current().GetSource()
 	prompt := s.llm.BuildPrompt(req.Message, currentSpec, req.Context)
 
 	// Get LLM response
@@ -575,20 +790,40 @@ func (s *Server) handleCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	var req struct {
-		Property string `json:"property"`
+		Property string             `json:"property"`
+		Model    string             `json:"model"`
+		Logic    string             `json:"logic"`
+		Params   map[string]float64 `json:"params"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if logic := r.URL.Query().Get("logic"); logic != "" {
+		req.Logic = logic
+	}
+	if req.Logic == "" {
+		req.Logic = logicCTL
+	}
+	if req.Logic != logicCTL && req.Logic != logicMu {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("unknown logic %q (expected %s or %s)", req.Logic, logicCTL, logicMu),
+		})
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	// Build CTL check query
-	query := fmt.Sprintf("check_ctl(%s).", req.Property)
-
-	satisfied, err := s.engine.QueryOne(ctx, query)
+	engine, err := paramEngine(ctx, s.current(), req.Params)
+	var result checkResult
+	if err == nil && req.Logic == logicMu {
+		result, err = checkMu(ctx, engine, req.Property, req.Model)
+	} else if err == nil {
+		result, err = checkProperty(ctx, engine, req.Property, req.Model)
+	}
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -597,14 +832,155 @@ func (s *Server) handleCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":   true,
-		"satisfied": satisfied,
-	})
+	response := map[string]interface{}{
+		"success":       true,
+		"satisfied":     result.Satisfied,
+		"satisfied_all": result.SatisfiedAll,
+		"model":         result.Model,
+		"logic":         req.Logic,
+		"formula":       result.Formula.String(),
+		"notation":      result.Formula.Notation(),
+		"initial":       result.Check.Initial,
+		"satisfying":    result.Check.Satisfying,
+		"violating":     result.Check.Violating,
+	}
+	if result.Model == modelComposed {
+		response["states"] = result.States
+	}
+	json.NewEncoder(w).Encode(response)
 
 	s.incCounter("ctl_checks")
 }
 
+// Models a CTL property can be checked against
+const (
+	// modelTransition runs check_ctl/1 over transition/3
+	modelTransition = "transition"
+	// modelComposed composes actors and channels, applying the fault model
+	modelComposed = "composed"
+)
+
+// Logics a property can be written in
+const (
+	// logicCTL checks CTL formulas, including the bounded operators
+	logicCTL = "ctl"
+	// logicMu checks modal mu-calculus formulas with check_mu/1, which also
+	// translates any CTL operators they contain
+	logicMu = "mu"
+)
+
+type checkResult struct {
+	// Satisfied holds when some initial state satisfies the formula, and
+	// SatisfiedAll when every one does
+	Satisfied    bool
+	SatisfiedAll bool
+	Model        string
+	States       int
+	Formula      *model.Formula
+	// Check holds the verdict at each initial state and the states that
+	// satisfy and violate the formula
+	Check *prolog.StateCheck
+}
+
+// newCheckResult summarizes a state check
+func newCheckResult(check *prolog.StateCheck, modelName string, f *model.Formula) checkResult {
+	return checkResult{
+		Satisfied:    check.Satisfied(),
+		SatisfiedAll: check.SatisfiedAll(),
+		Model:        modelName,
+		Formula:      f,
+		Check:        check,
+	}
+}
+
+// parseProperty parses a formula and checks its atoms against the spec, so
+// only a validated, re-rendered term ever reaches the Prolog checker
+func parseProperty(sys *model.System, formula string, allowModal bool) (*model.Formula, error) {
+	f, err := model.ParseFormula(formula)
+	if err != nil {
+		return nil, err
+	}
+	if !allowModal && f.Modal() {
+		return nil, fmt.Errorf("mu-calculus operators need logic=%s", logicMu)
+	}
+	if err := sys.Validate(f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// checkProperty checks a CTL formula against the requested model. When no
+// model is requested, the composed model is used if the spec declares
+// faults, so fault declarations apply without further configuration.
+func checkProperty(ctx context.Context, engine *prolog.Engine, formula, modelName string) (checkResult, error) {
+	modelName, err := resolveModel(ctx, engine, modelName)
+	if err != nil {
+		return checkResult{}, err
+	}
+	sys, err := model.Load(ctx, engine)
+	if err != nil {
+		return checkResult{}, err
+	}
+	f, err := parseProperty(sys, formula, false)
+	if err != nil {
+		return checkResult{}, err
+	}
+
+	switch modelName {
+	case modelTransition:
+		check, err := engine.CheckStates(ctx, f.String(), false)
+		if err != nil {
+			return checkResult{}, err
+		}
+		return newCheckResult(check, modelName, f), nil
+	default:
+		lts, err := sys.Explore(ctx, model.DefaultMaxStates)
+		if err != nil {
+			return checkResult{}, err
+		}
+		sat, err := lts.Check(f)
+		if err != nil {
+			return checkResult{}, err
+		}
+		// The composed model starts from a single global state
+		check := &prolog.StateCheck{
+			Initial:    []prolog.Verdict{{State: lts.States[0].String(), Satisfied: sat[0]}},
+			Satisfying: []string{},
+			Violating:  []string{},
+		}
+		for i, state := range lts.States {
+			if sat[i] {
+				check.Satisfying = append(check.Satisfying, state.String())
+			} else {
+				check.Violating = append(check.Violating, state.String())
+			}
+		}
+		result := newCheckResult(check, modelName, f)
+		result.States = len(lts.States)
+		return result, nil
+	}
+}
+
+// resolveModel returns the requested model, or when none is requested the
+// composed model if the spec declares faults and transition/3 otherwise
+func resolveModel(ctx context.Context, engine *prolog.Engine, modelName string) (string, error) {
+	switch modelName {
+	case modelTransition, modelComposed:
+		return modelName, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown model %q (expected %s or %s)", modelName, modelTransition, modelComposed)
+	}
+	faults, err := engine.GetFaults(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !faults.Empty() {
+		return modelComposed, nil
+	}
+	return modelTransition, nil
+}
+
 // handleReset resets the Prolog engine
 func (s *Server) handleReset(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -614,28 +990,30 @@ func (s *Server) handleReset(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
-	if err := s.engine.Reset(); err != nil {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		})
-		return
+	// Reload the spec file if one was provided, into a fresh engine as
+	// handleSpec does, so a spec file that no longer loads or validates
+	// leaves the current spec in place
+	load := func(*prolog.Engine) error { return nil }
+	if s.specFile != "" {
+		content, err := os.ReadFile(s.specFile)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		load = func(e *prolog.Engine) error { return e.LoadTrustedSpec(string(content)) }
 	}
-	if err := s.engine.AssertTurduckenVersion(s.version); err != nil {
+	next, sim, err := s.stageSpec(load)
+	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
 			"error":   err.Error(),
 		})
 		return
 	}
-
-	// Reload spec file if one was provided
-	if s.specFile != "" {
-		content, err := os.ReadFile(s.specFile)
-		if err == nil {
-			s.engine.LoadSpec(string(content))
-		}
-	}
+	s.publishSpec(next, sim)
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -684,53 +1062,43 @@ func (s *Server) handleProvider(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleProperties returns named properties from the spec with check results
-func (s *Server) handleProperties(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-	defer cancel()
-
-	properties, err := s.engine.GetProperties(ctx)
+// checkMu checks a mu-calculus formula over transition/3, the labelled
+// structure its action modalities refer to
+func checkMu(ctx context.Context, engine *prolog.Engine, formula, modelName string) (checkResult, error) {
+	if modelName != "" && modelName != modelTransition {
+		return checkResult{}, fmt.Errorf("mu-calculus formulas are checked over the %s model", modelTransition)
+	}
+	sys, err := model.Load(ctx, engine)
 	if err != nil {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		})
-		return
+		return checkResult{}, err
 	}
-
-	// Check each property and include results
-	type PropertyResult struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Formula     string `json:"formula"`
-		Satisfied   *bool  `json:"satisfied,omitempty"`
-		Error       string `json:"error,omitempty"`
+	f, err := parseProperty(sys, formula, true)
+	if err != nil {
+		return checkResult{}, err
 	}
-
-	results := make([]PropertyResult, len(properties))
-	for i, prop := range properties {
-		results[i] = PropertyResult{
-			Name:        prop.Name,
-			Description: prop.Description,
-			Formula:     prop.Formula,
-		}
-
-		// Try to check the property
-		query := fmt.Sprintf("check_ctl(%s).", prop.Formula)
-		satisfied, err := s.engine.QueryOne(ctx, query)
-		if err != nil {
-			results[i].Error = err.Error()
-		} else {
-			results[i].Satisfied = &satisfied
-		}
+	check, err := engine.CheckStates(ctx, f.String(), true)
+	if err != nil {
+		return checkResult{}, err
 	}
+	return newCheckResult(check, modelTransition, f), nil
+}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":    true,
-		"properties": results,
-	})
+// highlightFormula checks a CTL or mu-calculus formula at every state of
+// transition/3, the states the statemachine view draws
+func highlightFormula(ctx context.Context, engine *prolog.Engine, formula string) (checkResult, error) {
+	sys, err := model.Load(ctx, engine)
+	if err != nil {
+		return checkResult{}, err
+	}
+	f, err := parseProperty(sys, formula, true)
+	if err != nil {
+		return checkResult{}, err
+	}
+	check, err := engine.CheckStates(ctx, f.String(), f.Modal())
+	if err != nil {
+		return checkResult{}, err
+	}
+	return newCheckResult(check, modelTransition, f), nil
 }
 
 // handleDocs returns documentation from the spec
@@ -740,7 +1108,7 @@ func (s *Server) handleDocs(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	docs, err := s.engine.GetDocs(ctx)
+	docs, err := s.current().GetDocs(ctx)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -762,7 +1130,7 @@ func (s *Server) handleActors(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	actors, err := s.engine.GetActors(ctx)
+	actors, err := s.current().GetActors(ctx)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -803,9 +1171,10 @@ func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	// Query API info from spec
+	// Query API info from spec, all from one engine
+	engine := s.current()
 	info := make(map[string]string)
-	infoResults, _ := s.engine.Query(ctx, "api_info(Key, Value).")
+	infoResults, _ := engine.Query(ctx, "api_info(Key, Value).")
 	for _, row := range infoResults {
 		key := row["Key"]
 		val := row["Value"]
@@ -822,7 +1191,7 @@ func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
 		OperationID string
 	}
 	var endpoints []Endpoint
-	epResults, _ := s.engine.Query(ctx, "api_endpoint(Method, Path, Desc, OpID).")
+	epResults, _ := engine.Query(ctx, "api_endpoint(Method, Path, Desc, OpID).")
 	for _, row := range epResults {
 		endpoints = append(endpoints, Endpoint{
 			Method:      row["Method"],
@@ -840,7 +1209,7 @@ func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
 		Description string
 	}
 	requestFields := make(map[string][]Field)
-	reqResults, _ := s.engine.Query(ctx, "api_request(OpID, Name, Type, Req, Desc).")
+	reqResults, _ := engine.Query(ctx, "api_request(OpID, Name, Type, Req, Desc).")
 	for _, row := range reqResults {
 		opID := row["OpID"]
 		reqBool := row["Req"] == "true"
@@ -854,7 +1223,7 @@ func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
 
 	// Query response fields
 	responseFields := make(map[string][]Field)
-	respResults, _ := s.engine.Query(ctx, "api_response(OpID, Name, Type, Desc).")
+	respResults, _ := engine.Query(ctx, "api_response(OpID, Name, Type, Desc).")
 	for _, row := range respResults {
 		opID := row["OpID"]
 		responseFields[opID] = append(responseFields[opID], Field{
@@ -936,7 +1305,7 @@ func (s *Server) handlePredicates(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	preds, err := s.engine.ListPredicates(ctx)
+	preds, err := s.current().ListPredicates(ctx)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -1042,178 +1411,43 @@ func extractPrologCode(response string) string {
 	return strings.TrimSpace(response[start : start+end])
 }
 
-type SimulationResult struct {
-	ByType   map[string]int64  `json:"byType"`
-	BySrc    map[string]int64  `json:"bySrc"`
-	ByDst    map[string]int64  `json:"byDst"`
-	Timeline []SimulationEvent `json:"timeline"`
-	Total    int64             `json:"total"`
-	Steps    int               `json:"steps"`
-}
-
-type SimulationEvent struct {
-	Step  int    `json:"step"`
-	Label string `json:"label"`
-	From  string `json:"from"`
-	To    string `json:"to"`
-}
-
-// runAndCacheSimulation runs the simulation and stores the result
-func (s *Server) runAndCacheSimulation(steps int) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	result := SimulationResult{
-		ByType:   make(map[string]int64),
-		BySrc:    make(map[string]int64),
-		ByDst:    make(map[string]int64),
-		Timeline: make([]SimulationEvent, 0),
-	}
-
-	ctx := context.Background()
-	sm, err := s.engine.GetStateMachine(ctx)
-	if err != nil || len(sm.Initial) == 0 || len(sm.Transitions) == 0 {
-		s.cachedSimulation = &result
-		return
-	}
-
-	probData, err := buildTransitionProbData(s.engine.GetSource(), sm)
-	if err != nil {
-		log.Printf("transition_prob validation error: %v", err)
-	}
-
-	// Build transition map for quick lookup
-	transitionMap := make(map[string][]prolog.Transition)
-	for _, t := range sm.Transitions {
-		transitionMap[t.From] = append(transitionMap[t.From], t)
-	}
-
-	// Extract actor from state name (e.g., "proposer_idle" -> "proposer")
-	extractActor := func(state string) string {
-		if idx := strings.Index(state, "_"); idx > 0 {
-			return state[:idx]
-		}
-		return state
+// validateSpec checks the simulation annotations of a freshly loaded spec
+func validateSpec(ctx context.Context, engine *prolog.Engine) error {
+	if err := validateTransitionProbabilities(ctx, engine); err != nil {
+		return err
 	}
-
-	// Run simulation - walk the state machine
-	currentStates := make(map[string]string)
-	for _, init := range sm.Initial {
-		actor := extractActor(init)
-		currentStates[actor] = init
-	}
-
-	for step := 0; step < steps; step++ {
-		dice := rand.Float64()
-		s.setDiceValue(ctx, dice)
-
-		// Collect all possible transitions from current states
-		var possibleTransitions []prolog.Transition
-		for _, state := range currentStates {
-			for _, t := range transitionMap[state] {
-				if s.transitionAllowed(ctx, state, t, dice, probData) {
-					possibleTransitions = append(possibleTransitions, t)
-				}
-			}
-		}
-
-		if len(possibleTransitions) == 0 {
-			s.clearDiceValue(ctx)
-			break
-		}
-
-		// Pick a random transition
-		t := possibleTransitions[rand.Intn(len(possibleTransitions))]
-
-		// Update state
-		actor := extractActor(t.From)
-		currentStates[actor] = t.To
-
-		// Record metrics
-		result.ByType[t.Label]++
-		result.BySrc[extractActor(t.From)]++
-		result.ByDst[extractActor(t.To)]++
-		result.Total++
-
-		result.Timeline = append(result.Timeline, SimulationEvent{
-			Step:  step,
-			Label: t.Label,
-			From:  t.From,
-			To:    t.To,
-		})
-		s.clearDiceValue(ctx)
+	if err := validateTransitionDurations(ctx, engine); err != nil {
+		return err
 	}
-
-	result.Steps = steps
-
-	s.cachedSimulation = &result
-}
-
-func (s *Server) transitionAllowed(ctx context.Context, state string, t prolog.Transition, dice float64, probData *transitionProbData) bool {
-	if !s.stateGuardSatisfied(ctx, state) {
-		return false
+	if err := validateTransitionPriorities(ctx, engine); err != nil {
+		return err
 	}
-	if !s.transitionGuardSatisfied(ctx, t) {
-		return false
+	if err := validateRandomVars(ctx, engine); err != nil {
+		return err
 	}
-	if probData != nil && probData.byFrom[t.From] {
-		key := transitionKey(t.From, t.Label, t.To)
-		rng, ok := probData.byTransition[key]
-		if !ok {
-			return false
-		}
-		if dice < rng.Low || dice >= rng.High {
-			return false
-		}
-	}
-	return true
-}
-
-func (s *Server) stateGuardSatisfied(ctx context.Context, state string) bool {
-	stateAtom := prologAtom(state)
-	hasGuard, err := s.engine.QueryOne(ctx, fmt.Sprintf("state_guard(%s, _).", stateAtom))
+	sys, err := model.Load(ctx, engine)
 	if err != nil {
-		log.Printf("state_guard lookup error: %v", err)
-		return true
+		return err
 	}
-	if !hasGuard {
-		return true
+	if err := validateProperties(ctx, engine, sys); err != nil {
+		return err
 	}
-	ok, err := s.engine.QueryOne(ctx, fmt.Sprintf("state_guard(%s, Guard), call(Guard).", stateAtom))
-	if err != nil {
-		log.Printf("state_guard eval error: %v", err)
-		return false
-	}
-	return ok
+	return validateAccumulators(ctx, engine)
 }
 
-func (s *Server) transitionGuardSatisfied(ctx context.Context, t prolog.Transition) bool {
-	fromAtom := prologAtom(t.From)
-	labelAtom := prologAtom(t.Label)
-	toAtom := prologAtom(t.To)
-	hasGuard, err := s.engine.QueryOne(ctx, fmt.Sprintf("transition_guard(%s, %s, %s, _).", fromAtom, labelAtom, toAtom))
+// validateProperties parses every property/3 formula and checks its atoms,
+// so typos are reported at load time rather than checking as false
+func validateProperties(ctx context.Context, engine *prolog.Engine, sys *model.System) error {
+	properties, err := engine.GetProperties(ctx)
 	if err != nil {
-		log.Printf("transition_guard lookup error: %v", err)
-		return true
-	}
-	if !hasGuard {
-		return true
+		return fmt.Errorf("property validation: %w", err)
 	}
-	ok, err := s.engine.QueryOne(ctx, fmt.Sprintf("transition_guard(%s, %s, %s, Guard), call(Guard).", fromAtom, labelAtom, toAtom))
-	if err != nil {
-		log.Printf("transition_guard eval error: %v", err)
-		return false
+	for _, prop := range properties {
+		if _, err := parseProperty(sys, prop.Formula, false); err != nil {
+			return fmt.Errorf("property %s: %w", prop.Name, err)
+		}
 	}
-	return ok
-}
-
-func (s *Server) setDiceValue(ctx context.Context, value float64) {
-	_, _ = s.engine.QueryOne(ctx, "retractall(dice0_value(_)).")
-	_, _ = s.engine.QueryOne(ctx, fmt.Sprintf("assertz(dice0_value(%s)).", formatFloat(value)))
-}
-
-func (s *Server) clearDiceValue(ctx context.Context) {
-	_, _ = s.engine.QueryOne(ctx, "retractall(dice0_value(_)).")
+	return nil
 }
 
 func validateTransitionProbabilities(ctx context.Context, engine *prolog.Engine) error {
@@ -1221,22 +1455,17 @@ func validateTransitionProbabilities(ctx context.Context, engine *prolog.Engine)
 	if err != nil {
 		return fmt.Errorf("transition_prob validation: %w", err)
 	}
-	_, err = buildTransitionProbData(engine.GetSource(), sm)
+	probs, err := engine.GetTransitionProbabilities(ctx)
+	if err != nil {
+		return fmt.Errorf("transition_prob validation: %w", err)
+	}
+	_, err = buildTransitionProbData(probs, sm)
 	return err
 }
 
-type probEntry struct {
-	from  string
-	label string
-	to    string
-	prob  float64
-}
-
-func buildTransitionProbData(source string, sm *prolog.StateMachine) (*transitionProbData, error) {
-	entries, err := parseTransitionProbabilities(source)
-	if err != nil {
-		return nil, err
-	}
+// buildTransitionProbData checks evaluated transition_prob/4 entries and
+// turns them into dice ranges per source state
+func buildTransitionProbData(entries []prolog.TransitionProb, sm *prolog.StateMachine) (*transitionProbData, error) {
 	if len(entries) == 0 {
 		return nil, nil
 	}
@@ -1257,24 +1486,30 @@ func buildTransitionProbData(source string, sm *prolog.StateMachine) (*transitio
 	totals := make(map[string]float64)
 
 	for _, entry := range entries {
-		key := transitionKey(entry.from, entry.label, entry.to)
+		if math.IsNaN(entry.Prob) {
+			return nil, fmt.Errorf("transition_prob for %s is not a number: %s", transitionKey(entry.From, entry.Label, entry.To), entry.Expr)
+		}
+		if entry.Prob < 0.0 || entry.Prob > 1.0 {
+			return nil, fmt.Errorf("transition_prob out of range for %s (%f)", entry.From, entry.Prob)
+		}
+		key := transitionKey(entry.From, entry.Label, entry.To)
 		if _, exists := ranges[key]; exists {
 			return nil, fmt.Errorf("transition_prob duplicate for %s", key)
 		}
 		if sm != nil && !transitionSet[key] {
 			return nil, fmt.Errorf("transition_prob references missing transition %s", key)
 		}
-		stateAcc := acc[entry.from]
+		stateAcc := acc[entry.From]
 		if stateAcc == nil {
 			stateAcc = &probRange{}
-			acc[entry.from] = stateAcc
+			acc[entry.From] = stateAcc
 		}
 		low := stateAcc.High
-		high := low + entry.prob
+		high := low + entry.Prob
 		stateAcc.High = high
-		totals[entry.from] += entry.prob
+		totals[entry.From] += entry.Prob
 		ranges[key] = probRange{Low: low, High: high}
-		byFrom[entry.from] = true
+		byFrom[entry.From] = true
 	}
 
 	const tol = 1e-6
@@ -1304,83 +1539,32 @@ func buildTransitionProbData(source string, sm *prolog.StateMachine) (*transitio
 	}, nil
 }
 
-func parseTransitionProbabilities(source string) ([]probEntry, error) {
-	re := regexp.MustCompile(`transition_prob\(\s*([^,]+)\s*,\s*([^,]+)\s*,\s*([^,]+)\s*,\s*([^)]+)\)\s*\.`)
-	matches := re.FindAllStringSubmatch(source, -1)
-	if len(matches) == 0 {
-		return nil, nil
-	}
-	entries := make([]probEntry, 0, len(matches))
-	for _, match := range matches {
-		if len(match) < 5 {
-			continue
-		}
-		from := cleanPrologAtom(match[1])
-		label := cleanPrologAtom(match[2])
-		to := cleanPrologAtom(match[3])
-		value := strings.TrimSpace(match[4])
-		prob, err := strconv.ParseFloat(value, 64)
-		if err != nil {
-			return nil, fmt.Errorf("transition_prob parse error for %s: %w", value, err)
-		}
-		if prob < 0.0 || prob > 1.0 {
-			return nil, fmt.Errorf("transition_prob out of range for %s (%f)", from, prob)
-		}
-		entries = append(entries, probEntry{
-			from:  from,
-			label: label,
-			to:    to,
-			prob:  prob,
-		})
-	}
-	return entries, nil
-}
-
-func cleanPrologAtom(value string) string {
-	trimmed := strings.TrimSpace(value)
-	if len(trimmed) >= 2 && trimmed[0] == '\'' && trimmed[len(trimmed)-1] == '\'' {
-		inner := trimmed[1 : len(trimmed)-1]
-		return strings.ReplaceAll(inner, "''", "'")
-	}
-	return trimmed
-}
-
 func transitionKey(from, label, to string) string {
 	return from + "|" + label + "|" + to
 }
 
-func prologAtom(value string) string {
-	if value == "" {
-		return "''"
-	}
-	for i, r := range value {
-		if (r >= 'a' && r <= 'z') || (i > 0 && ((r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_')) {
-			continue
-		}
-		if i == 0 {
-			break
-		}
-		goto needsQuote
-	}
-	if value[0] >= 'a' && value[0] <= 'z' {
-		return value
-	}
-needsQuote:
-	escaped := strings.ReplaceAll(value, "'", "''")
-	return "'" + escaped + "'"
-}
-
 func formatFloat(value float64) string {
 	return strconv.FormatFloat(value, 'f', -1, 64)
 }
 
-// handleSimulate returns the cached simulation result
+// handleSimulate returns the cached simulation result, re-running the
+// simulation first when steps, scheduler or seed are given
 func (s *Server) handleSimulate(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	if stepsParam := r.URL.Query().Get("steps"); stepsParam != "" {
-		if steps, err := strconv.Atoi(stepsParam); err == nil && steps > 0 {
-			s.runAndCacheSimulation(steps)
+	query := r.URL.Query()
+	if query.Get("steps") != "" || query.Get("scheduler") != "" || query.Get("seed") != "" || query.Get("param") != "" {
+		opts, err := parseSimulationOptions(r, 1000)
+		if err == nil {
+			err = s.runAndCacheSimulationWith(opts)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
 		}
 	}
 
@@ -1401,3 +1585,201 @@ func (s *Server) handleSimulate(w http.ResponseWriter, r *http.Request) {
 
 	json.NewEncoder(w).Encode(result)
 }
+
+// handleSimulateStream runs a simulation and streams it over Server-Sent
+// Events: a "start" event with the run id, a "step" event per transition, a
+// "snapshot" of the aggregates every interval steps, and a final "done"
+// (or "cancelled") event carrying the full result.
+func (s *Server) handleSimulateStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	opts, err := parseSimulationOptions(r, 1000)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := newScheduler(opts.Scheduler, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	steps := opts.Steps
+	interval := 25
+	if intervalParam := r.URL.Query().Get("interval"); intervalParam != "" {
+		if v, err := strconv.Atoi(intervalParam); err == nil && v > 0 {
+			interval = v
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	run := s.registerRun(cancel)
+	defer s.unregisterRun(run.id)
+
+	writeEvent := func(event string, data interface{}) {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			log.Printf("simulation stream encode error: %v", err)
+			return
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+		flusher.Flush()
+	}
+
+	writeEvent("start", map[string]interface{}{
+		"id":        run.id,
+		"steps":     steps,
+		"interval":  interval,
+		"scheduler": opts.Scheduler,
+		"seed":      opts.Seed,
+		"params":    opts.Params,
+	})
+
+	engine, err := s.current().Clone()
+	if err != nil {
+		writeEvent("error", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	sim, err := newSimulator(ctx, engine, opts)
+	if err != nil {
+		writeEvent("error", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if sim == nil {
+		result := newSimulationResult()
+		result.Steps = steps
+		result.Seed = opts.Seed
+		result.Scheduler = opts.Scheduler
+		result.Params = opts.Params
+		writeEvent("done", result)
+		return
+	}
+
+	for i := 0; i < steps; i++ {
+		if run.paused() {
+			writeEvent("paused", map[string]interface{}{"id": run.id, "step": i})
+			if err := run.wait(ctx); err != nil {
+				break
+			}
+			writeEvent("resumed", map[string]interface{}{"id": run.id, "step": i})
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		ev, ok, err := sim.step()
+		if err != nil {
+			writeEvent("error", map[string]interface{}{"error": err.Error()})
+			return
+		}
+		if !ok {
+			break
+		}
+		writeEvent("step", ev)
+		if (i+1)%interval == 0 {
+			writeEvent("snapshot", sim.snapshot(steps, false))
+		}
+	}
+
+	result := sim.finish(steps)
+	if ctx.Err() != nil {
+		if r.Context().Err() == nil {
+			writeEvent("cancelled", result)
+		}
+		return
+	}
+	s.cacheSimulation(&result)
+	writeEvent("done", result)
+	s.incCounter("simulation_streams")
+}
+
+// parseSimulationOptions reads steps, scheduler, seed, model and repeated
+// param=name=value query parameters. Without a seed, a fresh one is chosen
+// and reported in the result.
+func parseSimulationOptions(r *http.Request, defaultSteps int) (simulationOptions, error) {
+	opts := simulationOptions{
+		Steps:     defaultSteps,
+		Scheduler: r.URL.Query().Get("scheduler"),
+		Seed:      newSeed(),
+		Model:     r.URL.Query().Get("model"),
+	}
+	if seedParam := r.URL.Query().Get("seed"); seedParam != "" {
+		if v, err := strconv.ParseInt(seedParam, 10, 64); err == nil {
+			opts.Seed = v
+		}
+	}
+	if opts.Scheduler == "" {
+		opts.Scheduler = defaultSchedulerPolicy
+	}
+	if stepsParam := r.URL.Query().Get("steps"); stepsParam != "" {
+		if v, err := strconv.Atoi(stepsParam); err == nil && v > 0 {
+			opts.Steps = v
+		}
+	}
+	params, err := parseParamOverrides(r.URL.Query()["param"])
+	if err != nil {
+		return opts, err
+	}
+	opts.Params = params
+	return opts, nil
+}
+
+// handleSimulateControl pauses, resumes or cancels a streaming simulation
+func (s *Server) handleSimulateControl(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		ID     string `json:"id"`
+		Action string `json:"action"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	run := s.lookupRun(req.ID)
+	if run == nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("no running simulation %q", req.ID),
+		})
+		return
+	}
+
+	switch req.Action {
+	case "pause":
+		run.pause()
+	case "resume":
+		run.unpause()
+	case "cancel":
+		run.cancel()
+	default:
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("unknown action %q", req.Action),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"id":      run.id,
+		"action":  req.Action,
+	})
+}
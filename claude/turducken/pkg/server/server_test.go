@@ -1,6 +1,18 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/rfielding/turducken/pkg/prolog"
@@ -21,7 +33,7 @@ func TestSimulationStateGuardBlocksTransitions(t *testing.T) {
 		t.Fatalf("LoadSpec error: %v", err)
 	}
 
-	s := &Server{engine: engine}
+	s := newTestServer(engine)
 	s.runAndCacheSimulation(5)
 
 	if s.cachedSimulation == nil {
@@ -47,7 +59,7 @@ func TestSimulationTransitionGuardAllowsTransition(t *testing.T) {
 		t.Fatalf("LoadSpec error: %v", err)
 	}
 
-	s := &Server{engine: engine}
+	s := newTestServer(engine)
 	s.runAndCacheSimulation(1)
 
 	if s.cachedSimulation == nil {
@@ -57,3 +69,519 @@ func TestSimulationTransitionGuardAllowsTransition(t *testing.T) {
 		t.Errorf("expected 1 transition, got %d", s.cachedSimulation.Total)
 	}
 }
+
+const requestSpec = `
+        actor_initial(client, client_ready).
+        actor_initial(server, server_waiting).
+        actor_transition(client, client_ready, request, client_sent).
+        actor_transition(server, server_waiting, handle, server_done).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        prop(server_done, handled).
+        channel(req, 1).
+        send(req, ping, client_ready, client_sent).
+        recv(req, ping, server_waiting, server_done).
+    `
+
+func TestCheckPropertyAppliesFaultsAutomatically(t *testing.T) {
+	ctx := context.Background()
+
+	engine := loadTestEngine(t, requestSpec)
+	result, err := checkProperty(ctx, engine, "af(atom(handled))", "")
+	if err != nil {
+		t.Fatalf("checkProperty error: %v", err)
+	}
+	if result.Model != modelTransition {
+		t.Errorf("expected check_ctl/1 without faults, got %s", result.Model)
+	}
+	result, err = checkProperty(ctx, engine, "af(atom(handled))", modelComposed)
+	if err != nil || !result.Satisfied {
+		t.Errorf("expected composed model to handle the request, got %+v %v", result, err)
+	}
+
+	lossy := loadTestEngine(t, requestSpec+"channel_fault(req, lose).")
+	result, err = checkProperty(ctx, lossy, "af(atom(handled))", "")
+	if err != nil {
+		t.Fatalf("checkProperty error: %v", err)
+	}
+	if result.Model != modelComposed || result.Satisfied {
+		t.Errorf("expected message loss to break af(atom(handled)), got %+v", result)
+	}
+
+	if _, err := checkProperty(ctx, engine, "af(atom(handled))", "bogus"); err == nil {
+		t.Errorf("expected unknown model to be rejected")
+	}
+}
+
+func TestCheckPropertyTimeBounds(t *testing.T) {
+	ctx := context.Background()
+	engine := loadTestEngine(t, requestSpec+`
+        transition_duration(client_ready, request, client_sent, const(2)).
+        transition_duration(server_waiting, handle, server_done, uniform(1, 3)).
+    `)
+
+	tests := []struct {
+		formula string
+		want    bool
+	}{
+		{"af_le(2, atom(handled))", true},
+		{"af_le(1, atom(handled))", false},
+		{"ef_within(3, atom(handled))", true},
+		{"ef_within(2.5, atom(handled))", false},
+		{"af_within(5, atom(handled))", true},
+		{"af_within(4, atom(handled))", false},
+	}
+	for _, tt := range tests {
+		result, err := checkProperty(ctx, engine, tt.formula, modelComposed)
+		if err != nil {
+			t.Fatalf("checkProperty(%s) error: %v", tt.formula, err)
+		}
+		if result.Satisfied != tt.want {
+			t.Errorf("checkProperty(%s) = %v, want %v", tt.formula, result.Satisfied, tt.want)
+		}
+	}
+
+	if _, err := checkProperty(ctx, engine, "ef_le(1.5, atom(handled))", modelComposed); err == nil {
+		t.Errorf("expected a fractional step bound to be rejected")
+	}
+}
+
+func TestCheckMuLogic(t *testing.T) {
+	engine := loadTestEngine(t, requestSpec+"channel_fault(req, lose).")
+	s := newTestServer(engine)
+
+	check := func(url, body string) (int, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		s.handleCheck(rec, httptest.NewRequest("POST", url, bytes.NewBufferString(body)))
+		var resp map[string]interface{}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		return rec.Code, resp
+	}
+
+	// Faults would select the composed model for CTL, but mu-calculus
+	// modalities refer to transition/3 labels
+	_, resp := check("/api/check?logic=mu", `{"property": "diamond(handle, atom(handled))"}`)
+	if resp["satisfied"] != true || resp["model"] != modelTransition || resp["logic"] != logicMu {
+		t.Errorf("expected handle to lead to handled, got %+v", resp)
+	}
+	_, resp = check("/api/check?logic=mu", `{"property": "and(diamond(request, true), box(request, atom(handled)))"}`)
+	if resp["satisfied"] != false {
+		t.Errorf("expected request not to lead to handled, got %+v", resp)
+	}
+	_, resp = check("/api/check", `{"property": "mu(X, or(atom(handled), diamond(any, X)))", "logic": "mu"}`)
+	if resp["satisfied"] != true {
+		t.Errorf("expected handled to be reachable, got %+v", resp)
+	}
+	_, resp = check("/api/check?logic=mu", `{"property": "ef(atom(handled))"}`)
+	if resp["satisfied"] != true {
+		t.Errorf("expected CTL to be translated, got %+v", resp)
+	}
+
+	_, resp = check("/api/check?logic=mu", `{"property": "ex(atom(handled))", "model": "composed"}`)
+	if resp["success"] != false {
+		t.Errorf("expected the composed model to be rejected, got %+v", resp)
+	}
+	if code, _ := check("/api/check?logic=ltl", `{"property": "ex(atom(handled))"}`); code != 400 {
+		t.Errorf("expected an unknown logic to be a bad request, got %d", code)
+	}
+
+	// check_mu/1 only ever sees the parsed formula re-rendered, so text
+	// closing the term early is rejected rather than run
+	_, resp = check("/api/check?logic=mu", `{"property": "diamond(handle, atom(handled))), assertz(injected(1)), (true"}`)
+	if resp["success"] != false {
+		t.Errorf("expected a formula with trailing goals to be rejected, got %+v", resp)
+	}
+	if found, err := engine.QueryOne(context.Background(), "catch(injected(_), _, fail)."); err != nil || found {
+		t.Errorf("expected the trailing goals never to run, got %v %v", found, err)
+	}
+}
+
+func TestCheckParsesNotationAndRejectsTypos(t *testing.T) {
+	spec := strings.Replace(requestSpec, "prop(server_done, handled).", `prop(server_done, handled).
+        prop(client_ready, ready).
+        prop(server_waiting, ready).
+        prop(client_sent, sent).`, 1)
+	engine := loadTestEngine(t, spec)
+	s := newTestServer(engine)
+
+	check := func(body string) (int, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		s.handleCheck(rec, httptest.NewRequest("POST", "/api/check", bytes.NewBufferString(body)))
+		var resp map[string]interface{}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		return rec.Code, resp
+	}
+
+	_, resp := check(`{"property": "EF handled & !sent"}`)
+	if resp["formula"] != "and(ef(atom(handled)), not(atom(sent)))" ||
+		resp["notation"] != "EF handled & !sent" {
+		t.Errorf("expected the notation to be parsed, got %+v", resp)
+	}
+	_, resp = check(`{"property": "A[ready W sent | handled]"}`)
+	if resp["satisfied"] != true {
+		t.Errorf("expected each actor to wait until it moves, got %+v", resp)
+	}
+
+	_, resp = check(`{"property": "ef(atom(handeld))"}`)
+	if resp["success"] != false || !strings.Contains(fmt.Sprint(resp["error"]), "handled") {
+		t.Errorf("expected the typo to be rejected with a suggestion, got %+v", resp)
+	}
+
+	engine = loadTestEngine(t, requestSpec+"property(p, 'typo', 'AG !comitted').")
+	if err := validateSpec(context.Background(), engine); err == nil || !strings.Contains(err.Error(), "property p") {
+		t.Errorf("expected property/3 validation to fail, got %v", err)
+	}
+}
+
+func TestCheckReportsEachInitialState(t *testing.T) {
+	engine := loadTestEngine(t, requestSpec)
+	s := newTestServer(engine)
+
+	rec := httptest.NewRecorder()
+	s.handleCheck(rec, httptest.NewRequest("POST", "/api/check", bytes.NewBufferString(`{"property": "EF handled"}`)))
+	var resp struct {
+		Satisfied    bool             `json:"satisfied"`
+		SatisfiedAll bool             `json:"satisfied_all"`
+		Initial      []prolog.Verdict `json:"initial"`
+		Satisfying   []string         `json:"satisfying"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	// Only the server's machine reaches handled
+	want := []prolog.Verdict{{State: "client_ready", Satisfied: false}, {State: "server_waiting", Satisfied: true}}
+	if !resp.Satisfied || resp.SatisfiedAll || !reflect.DeepEqual(resp.Initial, want) {
+		t.Errorf("expected only server_waiting to satisfy, got %+v", resp)
+	}
+	if !reflect.DeepEqual(resp.Satisfying, []string{"server_done", "server_waiting"}) {
+		t.Errorf("expected the server's states to satisfy, got %v", resp.Satisfying)
+	}
+}
+
+func TestVisualizeHighlightsFormula(t *testing.T) {
+	engine := loadTestEngine(t, requestSpec)
+	s := newTestServer(engine)
+
+	rec := httptest.NewRecorder()
+	s.handleVisualize(rec, httptest.NewRequest("GET", "/api/visualize?type=statemachine&formula="+url.QueryEscape("diamond(handle, atom(handled))"), nil))
+	var resp struct {
+		StateMachine struct {
+			Formula struct {
+				Satisfying []string `json:"satisfying"`
+				Violating  []string `json:"violating"`
+			} `json:"formula"`
+		} `json:"stateMachine"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	f := resp.StateMachine.Formula
+	if !reflect.DeepEqual(f.Satisfying, []string{"server_waiting"}) || len(f.Violating) != 3 {
+		t.Errorf("expected only server_waiting to handle into handled, got %+v", f)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleVisualize(rec, httptest.NewRequest("GET", "/api/visualize?type=statemachine&formula=EF+handeld", nil))
+	if rec.Code != 400 {
+		t.Errorf("expected an unknown atom to be a bad request, got %d", rec.Code)
+	}
+}
+
+func TestQueryTermsFormat(t *testing.T) {
+	engine := loadTestEngine(t, requestSpec)
+	s := newTestServer(engine)
+
+	query := func(url string) (int, string) {
+		rec := httptest.NewRecorder()
+		body := bytes.NewBufferString(`{"query": "actor_transition(server, From, Label, To), T = t(From, [Label])."}`)
+		s.handleQuery(rec, httptest.NewRequest("POST", url, body))
+		return rec.Code, rec.Body.String()
+	}
+
+	_, text := query("/api/query")
+	if !strings.Contains(text, `"T":"t(server_waiting,[handle])"`) {
+		t.Errorf("expected text bindings by default, got %s", text)
+	}
+	_, terms := query("/api/query?format=terms")
+	if !strings.Contains(terms, `"T":{"args":["server_waiting",["handle"]],"functor":"t"}`) ||
+		!strings.Contains(terms, `"From":"server_waiting"`) {
+		t.Errorf("expected structured bindings, got %s", terms)
+	}
+	if code, _ := query("/api/query?format=xml"); code != 400 {
+		t.Errorf("expected an unknown format to be rejected, got %d", code)
+	}
+}
+
+func TestQueryParams(t *testing.T) {
+	engine := loadTestEngine(t, requestSpec)
+	s := newTestServer(engine)
+
+	query := func(body string) (int, string) {
+		rec := httptest.NewRecorder()
+		s.handleQuery(rec, httptest.NewRequest("POST", "/api/query", bytes.NewBufferString(body)))
+		return rec.Code, rec.Body.String()
+	}
+
+	_, named := query(`{"query": "actor_transition(Actor, From, L, To).", "params": {"Actor": "server"}}`)
+	if !strings.Contains(named, `"L":"handle"`) || strings.Contains(named, `"Actor"`) || strings.Contains(named, "send") {
+		t.Errorf("expected Actor bound by name, got %s", named)
+	}
+	_, positional := query(`{"query": "actor_transition(?, ?, L, To).", "params": ["client", "client_ready"]}`)
+	if !strings.Contains(positional, `"To":"client_sent"`) {
+		t.Errorf("expected placeholders bound in order, got %s", positional)
+	}
+	_, quoted := query(`{"query": "X = ?.", "params": [{"functor": "f", "args": ["It's", {"string": "a"}]}]}`)
+	if !strings.Contains(quoted, `"X":"f('It\\'s',[a])"`) {
+		t.Errorf("expected the structured term to be quoted, got %s", quoted)
+	}
+
+	for _, body := range []string{
+		`{"query": "X = ?.", "params": "oops"}`,
+		`{"query": "X = ?.", "params": [{"atom": "x"}]}`,
+		`{"query": "X = ?.", "params": {"X": null}}`,
+	} {
+		if code, resp := query(body); code != 400 {
+			t.Errorf("%s: expected 400, got %d %s", body, code, resp)
+		}
+	}
+	if _, resp := query(`{"query": "X = ?.", "params": [1, 2]}`); !strings.Contains(resp, `"success":false`) {
+		t.Errorf("expected extra params to fail the query, got %s", resp)
+	}
+}
+
+func TestSpecAndQuerySandboxed(t *testing.T) {
+	engine, err := prolog.New(prolog.WithSandbox(sandboxLimits))
+	if err != nil {
+		t.Fatalf("prolog.New error: %v", err)
+	}
+	if err := engine.LoadTrustedSpec(requestSpec); err != nil {
+		t.Fatalf("LoadTrustedSpec error: %v", err)
+	}
+	s := newTestServer(engine)
+
+	post := func(handler http.HandlerFunc, url, body string) map[string]interface{} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("POST", url, bytes.NewBufferString(body)))
+		var resp map[string]interface{}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: decode error: %v", body, err)
+		}
+		return resp
+	}
+
+	resp := post(s.handleQuery, "/api/query", `{"query": "open('/etc/passwd', read, S)."}`)
+	if resp["success"] != false || !strings.Contains(fmt.Sprint(resp["error"]), "sandboxed_procedure") {
+		t.Errorf("expected file access to be denied, got %+v", resp)
+	}
+	resp = post(s.handleQuery, "/api/query", `{"query": "repeat, fail."}`)
+	if resp["success"] != false || !strings.Contains(fmt.Sprint(resp["error"]), "resource limit exceeded") {
+		t.Errorf("expected a resource limit, got %+v", resp)
+	}
+
+	spec, _ := json.Marshal(map[string]string{"source": requestSpec + "\n:- halt."})
+	resp = post(s.handleSpec, "/api/spec", string(spec))
+	if resp["success"] != false || !strings.Contains(fmt.Sprint(resp["error"]), "sandboxed_procedure") {
+		t.Errorf("expected a posted spec calling halt to be rejected, got %+v", resp)
+	}
+}
+
+func TestSpecReloadIsTransactional(t *testing.T) {
+	engine := loadTestEngine(t, requestSpec)
+	s := newTestServer(engine)
+	ctx := context.Background()
+
+	post := func(source string) map[string]interface{} {
+		body, _ := json.Marshal(map[string]string{"source": source})
+		rec := httptest.NewRecorder()
+		s.handleSpec(rec, httptest.NewRequest("POST", "/api/spec", bytes.NewBuffer(body)))
+		var resp map[string]interface{}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		return resp
+	}
+
+	for _, bad := range []string{
+		"broken(",
+		requestSpec + "channel_fault(nowhere, lose).",
+	} {
+		if resp := post(bad); resp["success"] != false {
+			t.Errorf("expected %q to be rejected, got %+v", bad, resp)
+		}
+		if s.current() != engine || engine.GetSource() != requestSpec {
+			t.Errorf("expected a failed load to keep the current spec")
+		}
+		if ok, err := engine.QueryOne(ctx, "actor_initial(server, server_waiting)."); err != nil || !ok {
+			t.Errorf("expected the current spec to stay queryable, got %v, %v", ok, err)
+		}
+	}
+
+	// Requests holding the old engine keep its spec after the new one is
+	// published
+	renamed := strings.ReplaceAll(requestSpec, "server_done", "server_finished")
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if ok, err := engine.QueryOne(ctx, "actor_initial(server, server_waiting)."); err != nil || !ok {
+				errs <- fmt.Errorf("got %v, %v", ok, err)
+				return
+			}
+		}
+	}()
+	resp := post(renamed)
+	close(done)
+	if err := <-errs; err != nil {
+		t.Errorf("expected queries during a reload to succeed, %v", err)
+	}
+	if resp["success"] != true {
+		t.Fatalf("expected the new spec to load, got %+v", resp)
+	}
+	if ok, err := s.current().QueryOne(ctx, "prop(server_finished, handled), \\+ prop(server_done, _)."); err != nil || !ok {
+		t.Errorf("expected the new spec after the swap, got %v, %v", ok, err)
+	}
+	if ok, err := engine.QueryOne(ctx, "prop(server_done, handled), \\+ prop(server_finished, _)."); err != nil || !ok {
+		t.Errorf("expected the old engine to keep the old spec, got %v, %v", ok, err)
+	}
+	if s.cachedSimulation == nil || s.cachedSimulation.Total == 0 {
+		t.Errorf("expected the new spec's simulation to be cached, got %+v", s.cachedSimulation)
+	}
+}
+
+func TestResetRejectsInvalidSpecFile(t *testing.T) {
+	engine := loadTestEngine(t, requestSpec)
+	s := newTestServer(engine)
+	s.specFile = filepath.Join(t.TempDir(), "spec.pl")
+
+	reset := func() map[string]interface{} {
+		rec := httptest.NewRecorder()
+		s.handleReset(rec, httptest.NewRequest("POST", "/api/reset", nil))
+		var resp map[string]interface{}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		return resp
+	}
+
+	if resp := reset(); resp["success"] != false {
+		t.Errorf("expected a missing spec file to be rejected, got %+v", resp)
+	}
+	for _, bad := range []string{
+		"broken(",
+		requestSpec + "channel_fault(nowhere, lose).",
+	} {
+		if err := os.WriteFile(s.specFile, []byte(bad), 0644); err != nil {
+			t.Fatalf("WriteFile error: %v", err)
+		}
+		if resp := reset(); resp["success"] != false {
+			t.Errorf("expected %q to be rejected, got %+v", bad, resp)
+		}
+		if s.current() != engine {
+			t.Errorf("expected a failed reset to keep the current spec")
+		}
+	}
+
+	if err := os.WriteFile(s.specFile, []byte(requestSpec), 0644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+	if resp := reset(); resp["success"] != true {
+		t.Fatalf("expected the spec file to reload, got %+v", resp)
+	}
+	if s.current() == engine || s.current().GetSource() != requestSpec {
+		t.Errorf("expected the reloaded spec to be published")
+	}
+	if s.cachedSimulation == nil || s.cachedSimulation.Total == 0 {
+		t.Errorf("expected the reloaded spec's simulation to be cached, got %+v", s.cachedSimulation)
+	}
+}
+
+func TestQueriesAndSimulationsRunInParallel(t *testing.T) {
+	engine := loadTestEngine(t, requestSpec+":- dynamic(noted/1).")
+	s := newTestServer(engine)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if err := s.runAndCacheSimulationWith(simulationOptions{Steps: 10, Seed: int64(i + 1)}); err != nil {
+				errs <- err
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			// Each query sees only the fact it asserted itself
+			body := fmt.Sprintf(`{"query": "assertz(noted(?)), \\+ (noted(X), X \\== ?).", "params": [%d, %d]}`, i, i)
+			rec := httptest.NewRecorder()
+			s.handleQuery(rec, httptest.NewRequest("POST", "/api/query", bytes.NewBufferString(body)))
+			if resp := rec.Body.String(); !strings.Contains(resp, `"result":"true"`) {
+				errs <- fmt.Errorf("query %d: expected its own fact only, got %s", i, resp)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if ok, err := engine.QueryOne(ctx, "noted(_) ; roll_value(_, _) ; accumulator_value(_, _)."); err != nil || ok {
+		t.Errorf("expected nothing asserted on the shared engine, got %v, %v", ok, err)
+	}
+	if s.cachedSimulation == nil || s.cachedSimulation.Total != 2 {
+		t.Errorf("expected a cached simulation, got %+v", s.cachedSimulation)
+	}
+}
+
+func TestSimulationWaitsForMessagesAndInjectsFaults(t *testing.T) {
+	engine := loadTestEngine(t, requestSpec)
+	result := mustRunSimulation(t, engine, simulationOptions{Steps: 10, Model: modelComposed})
+	if result.Total != 2 || result.Timeline[0].Label != "request" || result.Timeline[1].Label != "handle" {
+		t.Fatalf("expected request then handle, got %+v", result.Timeline)
+	}
+
+	// Without faults the simulation keeps to transition/3, so the server
+	// need not wait for ping
+	handledFirst := false
+	for seed := int64(1); seed <= 20 && !handledFirst; seed++ {
+		result = mustRunSimulation(t, engine, simulationOptions{Steps: 10, Seed: seed})
+		handledFirst = result.Total == 2 && result.Timeline[0].Label == "handle"
+	}
+	if !handledFirst {
+		t.Errorf("expected the transition/3 model to ignore channels")
+	}
+
+	lossy := loadTestEngine(t, requestSpec+"channel_fault(req, lose, 1.0).")
+	result = mustRunSimulation(t, lossy, simulationOptions{Steps: 10})
+	if result.Total != 1 {
+		t.Errorf("expected the server to starve once ping is lost, got %+v", result.Timeline)
+	}
+	if result.ByFault["lose"] != 1 || len(result.Faults) != 1 || result.Faults[0].Channel != "req" {
+		t.Errorf("expected one logged loss on req, got %+v", result.Faults)
+	}
+
+	crashy := loadTestEngine(t, requestSpec+"actor_may_crash(server, server_waiting, 1.0).")
+	result = mustRunSimulation(t, crashy, simulationOptions{Steps: 3})
+	if result.ByFault["crash"] == 0 {
+		t.Errorf("expected the server to crash after handling, got %+v", result.Faults)
+	}
+}
+
+func TestValidateSpecRejectsUnknownFaultChannel(t *testing.T) {
+	engine := loadTestEngine(t, requestSpec+"channel_fault(nowhere, lose).")
+	if err := validateSpec(context.Background(), engine); err == nil {
+		t.Errorf("expected fault on an unknown channel to be rejected")
+	}
+}
@@ -0,0 +1,1035 @@
+package server
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/rfielding/turducken/pkg/model"
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+type SimulationResult struct {
+	ByType   map[string]int64  `json:"byType"`
+	BySrc    map[string]int64  `json:"bySrc"`
+	ByDst    map[string]int64  `json:"byDst"`
+	Timeline []SimulationEvent `json:"timeline"`
+	Total    int64             `json:"total"`
+	Steps    int               `json:"steps"`
+	Time     float64           `json:"time"`
+	// Seed reproduces the run when passed back as ?seed=
+	Seed int64 `json:"seed"`
+	// Scheduler names the policy that chose among enabled transitions
+	Scheduler string                       `json:"scheduler"`
+	Actors    map[string]*ActorUtilization `json:"actors"`
+
+	// Accumulators holds final accumulator values; AccumulatorSeries
+	// records each accumulator's value every time a reward changes it.
+	Accumulators      map[string]float64            `json:"accumulators"`
+	AccumulatorSeries map[string][]AccumulatorPoint `json:"accumulatorSeries"`
+
+	// Faults logs every injected fault; ByFault counts them by kind
+	Faults  []FaultEvent     `json:"faults"`
+	ByFault map[string]int64 `json:"byFault"`
+
+	// Channels reports queue occupancy, blocking and waiting per channel
+	Channels map[string]*ChannelMetrics `json:"channels"`
+
+	// Coverage reports the declared states and transitions the run exercised
+	Coverage *Coverage `json:"coverage,omitempty"`
+
+	// Params lists the param/2 overrides the run used
+	Params map[string]float64 `json:"params,omitempty"`
+}
+
+type SimulationEvent struct {
+	Step  int     `json:"step"`
+	Label string  `json:"label"`
+	From  string  `json:"from"`
+	To    string  `json:"to"`
+	Actor string  `json:"actor"`
+	Start float64 `json:"start"`
+	Time  float64 `json:"time"`
+	// Draws holds the random variables the actor rolled when it chose
+	// this transition, including dice0
+	Draws map[string]float64 `json:"draws,omitempty"`
+}
+
+// ActorUtilization reports how much simulated time an actor spent busy
+// executing transitions versus idle waiting for one to become enabled.
+type ActorUtilization struct {
+	Busy        float64 `json:"busy"`
+	Idle        float64 `json:"idle"`
+	Utilization float64 `json:"utilization"`
+	Transitions int64   `json:"transitions"`
+}
+
+// AccumulatorPoint is an accumulator value after Step completed transitions
+type AccumulatorPoint struct {
+	Step  int     `json:"step"`
+	Time  float64 `json:"time"`
+	Value float64 `json:"value"`
+}
+
+// FaultEvent is a fault injected from the spec's fault model: a lost,
+// duplicated, reordered or partitioned message, a crash, or a partition
+// starting or healing.
+type FaultEvent struct {
+	Step    int     `json:"step"`
+	Time    float64 `json:"time"`
+	Kind    string  `json:"kind"`
+	Actor   string  `json:"actor,omitempty"`
+	Channel string  `json:"channel,omitempty"`
+	Msg     string  `json:"msg,omitempty"`
+	Detail  string  `json:"detail,omitempty"`
+}
+
+func newSimulationResult() SimulationResult {
+	return SimulationResult{
+		ByType:            make(map[string]int64),
+		BySrc:             make(map[string]int64),
+		ByDst:             make(map[string]int64),
+		Timeline:          make([]SimulationEvent, 0),
+		Actors:            make(map[string]*ActorUtilization),
+		Accumulators:      make(map[string]float64),
+		AccumulatorSeries: make(map[string][]AccumulatorPoint),
+		Faults:            make([]FaultEvent, 0),
+		ByFault:           make(map[string]int64),
+		Channels:          make(map[string]*ChannelMetrics),
+	}
+}
+
+// simulationOptions selects how a simulation run behaves
+type simulationOptions struct {
+	Steps     int
+	Scheduler string
+	Seed      int64
+	// Params overrides param/2 defaults for this run only
+	Params map[string]float64
+	// Model picks the semantics as resolveModel does: the composed model
+	// makes transitions wait on their channels, transition/3 ignores them
+	Model string
+}
+
+// pendingTransition is a transition an actor has started but not completed.
+// Its messages were received when it started and are sent when it completes.
+type pendingTransition struct {
+	actor     string
+	step      *model.Step
+	t         prolog.Transition
+	start     float64
+	end       float64
+	seq       int
+	draws     map[string]float64
+	cancelled bool
+}
+
+// eventQueue orders pending transitions by completion time, breaking ties
+// by start order so runs are reproducible for a given seed.
+type eventQueue []*pendingTransition
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].end == q[j].end {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].end < q[j].end
+}
+func (q eventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(*pendingTransition)) }
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
+
+// simulator is a discrete-event simulator over the loaded spec. Each actor
+// starts at most one transition at a time; a started transition holds the
+// actor busy for a duration drawn from transition_duration/4 (zero when
+// undeclared) and completes when the simulated clock reaches its end time.
+// Under the composed model a transition also waits until the messages it
+// receives are at the head of their channels and its sends have room.
+type simulator struct {
+	ctx         context.Context
+	engine      *prolog.Engine
+	rng         *rand.Rand
+	seed        int64
+	sys         *model.System
+	probData    *transitionProbData
+	randomVars  []randomVar
+	durations   map[string]distribution
+	stateActors map[string]string
+	rewards     map[string][]prolog.Reward
+	scheduler   scheduler
+	machines    []prolog.ActorStateMachine
+	composed    bool
+	declared    map[string]bool // transition/3 keys, which alone fire outside the composed model
+
+	global   model.State
+	pending  []int       // channel slots reserved by sends in flight
+	arrivals [][]arrival // delivery times of queued messages, by channel
+	blocked  map[blockKey]bool
+	busy     map[string]*pendingTransition
+	queue    eventQueue
+	clock    float64
+	seq      int
+	instant  int // transitions completed at clock while a timed one waits
+	result   SimulationResult
+}
+
+// maxInstantTransitions caps the transitions that may complete at one
+// instant while a timed transition waits. Past it the run is a zero-time
+// livelock: an untimed cycle that would keep the clock from advancing.
+const maxInstantTransitions = 100
+
+// newSimulator prepares a simulation of the engine's current spec. It
+// returns an error for invalid options, or for declarations that param
+// overrides have made invalid, and a nil simulator when the spec has no
+// initial states or transitions.
+//
+// The simulator overrides params and asserts roll_value/2 and
+// accumulator_value/2 on engine, so engine must be the simulation's own,
+// such as a Clone of the shared one. Runs may reuse it one after another.
+func newSimulator(ctx context.Context, engine *prolog.Engine, opts simulationOptions) (*simulator, error) {
+	if len(opts.Params) > 0 {
+		if err := engine.SetParams(ctx, opts.Params); err != nil {
+			return nil, err
+		}
+	}
+	priorities, err := buildTransitionPriorities(ctx, engine)
+	if err != nil {
+		return nil, err
+	}
+	sched, err := newScheduler(opts.Scheduler, priorities)
+	if err != nil {
+		return nil, err
+	}
+
+	sm, err := engine.GetStateMachine(ctx)
+	if err != nil || len(sm.Initial) == 0 || len(sm.Transitions) == 0 {
+		return nil, nil
+	}
+	sys, err := model.Load(ctx, engine)
+	if err != nil {
+		return nil, err
+	}
+	modelName, err := resolveModel(ctx, engine, opts.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	probs, err := engine.GetTransitionProbabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	probData, err := buildTransitionProbData(probs, sm)
+	if err != nil {
+		return nil, err
+	}
+	randomVars, err := buildRandomVars(ctx, engine)
+	if err != nil {
+		return nil, err
+	}
+	durations, err := buildTransitionDurations(ctx, engine)
+	if err != nil {
+		return nil, err
+	}
+	stateActors, err := engine.GetStateActors(ctx)
+	if err != nil {
+		log.Printf("actor state lookup error: %v", err)
+	}
+	initialValues, rewards, err := buildAccumulators(ctx, engine)
+	if err != nil {
+		return nil, err
+	}
+	machines, err := coverageMachines(ctx, engine)
+	if err != nil {
+		log.Printf("coverage state machine error: %v", err)
+	}
+
+	sim := &simulator{
+		ctx:         ctx,
+		engine:      engine,
+		rng:         rand.New(rand.NewSource(opts.Seed)),
+		seed:        opts.Seed,
+		sys:         sys,
+		probData:    probData,
+		randomVars:  randomVars,
+		durations:   durations,
+		stateActors: stateActors,
+		rewards:     rewards,
+		scheduler:   sched,
+		machines:    machines,
+		composed:    modelName == modelComposed,
+		declared:    make(map[string]bool, len(sm.Transitions)),
+		global:      sys.Initial.Clone(),
+		pending:     make([]int, len(sys.Channels)),
+		busy:        make(map[string]*pendingTransition),
+		result:      newSimulationResult(),
+	}
+	sim.result.Params = opts.Params
+	for _, t := range sm.Transitions {
+		sim.declared[transitionKey(t.From, t.Label, t.To)] = true
+	}
+	sim.global.Cut = make([]bool, sys.Partitions())
+	sim.initChannels()
+	for _, actor := range sys.Actors {
+		sim.result.Actors[actor] = &ActorUtilization{}
+	}
+
+	for name, value := range initialValues {
+		sim.result.Accumulators[name] = value
+		sim.result.AccumulatorSeries[name] = []AccumulatorPoint{{Step: 0, Time: 0, Value: value}}
+		sim.setAccumulatorValue(name, value)
+	}
+
+	return sim, nil
+}
+
+// actorOf resolves the actor owning a state, falling back to the state
+// name prefix (e.g., "proposer_idle" -> "proposer") for plain transition/3 specs
+func (sim *simulator) actorOf(state string) string {
+	return model.ActorOf(sim.stateActors, state)
+}
+
+// step advances the simulation to the next completed transition. It
+// returns false once no actor is busy and no transition is enabled.
+//
+// Idle actors keep starting transitions until the earliest pending one is
+// due, so a transition that takes no time completes before the scheduler
+// makes its next choice. Instantaneous transitions therefore interleave one
+// per step, while timed transitions on different actors overlap. An
+// untimed cycle would starve timed transitions forever, so more than
+// maxInstantTransitions completions at one instant while a timed one
+// waits is reported as an error.
+func (sim *simulator) step() (SimulationEvent, bool, error) {
+	for {
+		for sim.queue.Len() == 0 || sim.queue[0].end > sim.clock {
+			if !sim.startNext() {
+				break
+			}
+		}
+		if sim.queue.Len() == 0 {
+			return SimulationEvent{}, false, nil
+		}
+		p := heap.Pop(&sim.queue).(*pendingTransition)
+		if p.cancelled {
+			// The actor crashed while this transition was in flight
+			continue
+		}
+		if p.end > sim.clock {
+			sim.instant = 0
+		} else if sim.timedWaiting() {
+			sim.instant++
+			if sim.instant > maxInstantTransitions {
+				return SimulationEvent{}, false, fmt.Errorf("zero-time livelock at time %g: untimed transitions such as %s keep firing while timed ones wait",
+					sim.clock, p.t.Label)
+			}
+		}
+		ev := sim.complete(p)
+		if sim.composed {
+			sim.injectFaults()
+		}
+		return ev, true, nil
+	}
+}
+
+// timedWaiting reports whether a transition in flight is due after the
+// current clock
+func (sim *simulator) timedWaiting() bool {
+	for _, p := range sim.queue {
+		if !p.cancelled && p.end > sim.clock {
+			return true
+		}
+	}
+	return false
+}
+
+// startNext starts one enabled transition on an idle actor at the current
+// clock. It returns false when no idle actor has an enabled transition.
+//
+// Each idle actor rolls its own random variables, so guards in different
+// actors are independent while alternative guards within one actor still
+// partition the same roll.
+func (sim *simulator) startNext() bool {
+	defer sim.clearRollValues()
+
+	sim.noteBlocking()
+
+	// Collect all possible transitions from idle actors' current states
+	var possible []candidate
+	for i, actor := range sim.sys.Actors {
+		if sim.busy[actor] != nil {
+			continue
+		}
+		draws := sim.roll()
+		sim.setRollValues(draws)
+		state := sim.global.Locals[i]
+		for _, st := range sim.sys.Steps(state) {
+			if !sim.stepEnabled(st) {
+				continue
+			}
+			t := st.Transition()
+			if sim.transitionAllowed(state, t, draws[diceVar]) {
+				possible = append(possible, candidate{actor: actor, t: t, step: st, draws: draws})
+			}
+		}
+	}
+	if len(possible) == 0 {
+		return false
+	}
+
+	c := sim.scheduler.pick(sim.rng, possible)
+	duration := 0.0
+	if dist, ok := sim.durations[transitionKey(c.t.From, c.t.Label, c.t.To)]; ok {
+		duration = dist.sampleDuration(sim.rng)
+	}
+
+	if sim.composed {
+		for _, op := range c.step.Recvs {
+			sim.receive(op.Channel)
+		}
+		for _, op := range c.step.Sends {
+			sim.pending[op.Channel]++
+		}
+	}
+
+	p := &pendingTransition{
+		actor: c.actor,
+		step:  c.step,
+		t:     c.t,
+		start: sim.clock,
+		end:   sim.clock + duration,
+		seq:   sim.seq,
+		draws: c.draws,
+	}
+	sim.seq++
+	sim.busy[c.actor] = p
+	heap.Push(&sim.queue, p)
+	return true
+}
+
+// stepEnabled reports whether an idle actor may start a step. Outside the
+// composed model only transition/3 steps fire, and channels never block.
+func (sim *simulator) stepEnabled(st *model.Step) bool {
+	if sim.composed {
+		return sim.sys.Enabled(sim.global, st, sim.pending)
+	}
+	return sim.declared[transitionKey(st.From, st.Label, st.To)]
+}
+
+// complete advances the clock to a pending transition's end and applies it
+func (sim *simulator) complete(p *pendingTransition) SimulationEvent {
+	sim.clock = p.end
+	sim.global.Locals[p.step.Actor] = p.t.To
+	delete(sim.busy, p.actor)
+	if sim.composed {
+		for _, op := range p.step.Sends {
+			sim.pending[op.Channel]--
+			sim.deliver(p.step.Actor, op)
+		}
+	}
+	sim.sampleQueues()
+
+	acct := sim.result.Actors[p.actor]
+	acct.Busy += p.end - p.start
+	acct.Transitions++
+
+	// Record metrics
+	sim.result.ByType[p.t.Label]++
+	sim.result.BySrc[sim.actorOf(p.t.From)]++
+	sim.result.ByDst[sim.actorOf(p.t.To)]++
+
+	ev := SimulationEvent{
+		Step:  int(sim.result.Total),
+		Label: p.t.Label,
+		From:  p.t.From,
+		To:    p.t.To,
+		Actor: p.actor,
+		Start: p.start,
+		Time:  p.end,
+		Draws: p.draws,
+	}
+	sim.result.Total++
+	sim.result.Timeline = append(sim.result.Timeline, ev)
+	sim.applyRewards(p.t.Label)
+	return ev
+}
+
+// applyRewards adds the rewards for a fired label to their accumulators
+func (sim *simulator) applyRewards(label string) {
+	for _, r := range sim.rewards[label] {
+		value := sim.result.Accumulators[r.Name] + r.Amount
+		sim.result.Accumulators[r.Name] = value
+		sim.result.AccumulatorSeries[r.Name] = append(sim.result.AccumulatorSeries[r.Name], AccumulatorPoint{
+			Step:  int(sim.result.Total),
+			Time:  sim.clock,
+			Value: value,
+		})
+		sim.setAccumulatorValue(r.Name, value)
+	}
+}
+
+// finish ends the run and closes the busy/idle accounting at the current clock
+func (sim *simulator) finish(steps int) SimulationResult {
+	sim.clearAccumulatorValues()
+	result := sim.snapshot(steps, true)
+	result.Coverage = computeCoverage(sim.machines, result.Timeline)
+	return result
+}
+
+// snapshot summarizes the run so far without disturbing it. Busy/idle
+// accounting is closed at the current clock on a copy of the actor totals.
+func (sim *simulator) snapshot(steps int, withTimeline bool) SimulationResult {
+	result := newSimulationResult()
+	result.Steps = steps
+	result.Time = sim.clock
+	result.Seed = sim.seed
+	result.Scheduler = sim.scheduler.name()
+	result.Total = sim.result.Total
+	if withTimeline {
+		result.Timeline = sim.result.Timeline
+	}
+	for k, v := range sim.result.ByType {
+		result.ByType[k] = v
+	}
+	for k, v := range sim.result.BySrc {
+		result.BySrc[k] = v
+	}
+	for k, v := range sim.result.ByDst {
+		result.ByDst[k] = v
+	}
+	for k, v := range sim.result.Accumulators {
+		result.Accumulators[k] = v
+	}
+	for k, v := range sim.result.AccumulatorSeries {
+		result.AccumulatorSeries[k] = v
+	}
+	for actor, acct := range sim.result.Actors {
+		copied := *acct
+		result.Actors[actor] = &copied
+	}
+
+	result.Faults = append(result.Faults, sim.result.Faults...)
+	for k, v := range sim.result.ByFault {
+		result.ByFault[k] = v
+	}
+	for name, m := range sim.result.Channels {
+		result.Channels[name] = sim.channelSnapshot(m)
+	}
+
+	// Transitions still in flight count as busy up to the current clock
+	for _, p := range sim.queue {
+		if !p.cancelled && sim.clock > p.start {
+			result.Actors[p.actor].Busy += sim.clock - p.start
+		}
+	}
+	for _, acct := range result.Actors {
+		acct.Idle = result.Time - acct.Busy
+		if result.Time > 0 {
+			acct.Utilization = acct.Busy / result.Time
+		}
+	}
+	return result
+}
+
+// runSimulation runs up to opts.Steps transitions of the engine's current spec
+func runSimulation(ctx context.Context, engine *prolog.Engine, opts simulationOptions) (SimulationResult, error) {
+	sim, err := newSimulator(ctx, engine, opts)
+	if err != nil {
+		return SimulationResult{}, err
+	}
+	if sim == nil {
+		result := newSimulationResult()
+		result.Steps = opts.Steps
+		result.Seed = opts.Seed
+		result.Scheduler = opts.Scheduler
+		result.Params = opts.Params
+		if result.Scheduler == "" {
+			result.Scheduler = defaultSchedulerPolicy
+		}
+		return result, nil
+	}
+	for i := 0; i < opts.Steps; i++ {
+		_, ok, err := sim.step()
+		if err == nil {
+			// Guards fail closed once ctx is done, which can end the
+			// run early, so a cancelled run is an error however it ended
+			err = ctx.Err()
+		}
+		if err != nil {
+			return SimulationResult{}, err
+		}
+		if !ok {
+			break
+		}
+	}
+	return sim.finish(opts.Steps), nil
+}
+
+// newSeed picks a seed for a run. It fits in 53 bits so the value reported
+// in JSON survives a round trip through JavaScript numbers.
+func newSeed() int64 {
+	return time.Now().UnixNano() & (1<<53 - 1)
+}
+
+// runAndCacheSimulation runs the simulation with default options and
+// stores the result
+func (s *Server) runAndCacheSimulation(steps int) {
+	opts := simulationOptions{Steps: steps, Seed: newSeed()}
+	if err := s.runAndCacheSimulationWith(opts); err != nil {
+		log.Printf("simulation error: %v", err)
+	}
+}
+
+// runAndCacheSimulationWith runs the simulation and stores the result.
+// s.mu is only held to publish.
+func (s *Server) runAndCacheSimulationWith(opts simulationOptions) error {
+	_, err := s.runAndCacheSimulationOn(s.current(), opts)
+	return err
+}
+
+// runAndCacheSimulationOn runs the simulation against engine's spec. The
+// result is only cached while engine is still the live spec.
+func (s *Server) runAndCacheSimulationOn(engine *prolog.Engine, opts simulationOptions) (*SimulationResult, error) {
+	clone, err := engine.Clone()
+	if err != nil {
+		return nil, err
+	}
+	result, err := runSimulation(context.Background(), clone, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.current() == engine {
+		s.cacheSimulation(&result)
+	}
+	return &result, nil
+}
+
+func (s *Server) cacheSimulation(result *SimulationResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cachedSimulation = result
+}
+
+// cachedOrRunSimulation returns the cached simulation of engine's spec,
+// running one with default options first if none is cached or engine has
+// since been replaced
+func (s *Server) cachedOrRunSimulation(engine *prolog.Engine) (*SimulationResult, error) {
+	s.mu.RLock()
+	result := s.cachedSimulation
+	s.mu.RUnlock()
+	if result != nil && s.current() == engine {
+		return result, nil
+	}
+	return s.runAndCacheSimulationOn(engine, simulationOptions{Steps: 1000, Seed: newSeed()})
+}
+
+// simulationRun is a streaming simulation that can be paused, resumed and
+// cancelled through /api/simulate/control.
+type simulationRun struct {
+	id     string
+	cancel context.CancelFunc
+	done   chan struct{} // closed once the run has exited
+
+	mu     sync.Mutex
+	resume chan struct{} // non-nil while paused
+}
+
+func (r *simulationRun) pause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.resume == nil {
+		r.resume = make(chan struct{})
+	}
+}
+
+func (r *simulationRun) unpause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.resume != nil {
+		close(r.resume)
+		r.resume = nil
+	}
+}
+
+func (r *simulationRun) paused() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.resume != nil
+}
+
+// wait blocks while the run is paused. It returns an error if the run is
+// cancelled while waiting.
+func (r *simulationRun) wait(ctx context.Context) error {
+	r.mu.Lock()
+	resume := r.resume
+	r.mu.Unlock()
+	if resume == nil {
+		return ctx.Err()
+	}
+	select {
+	case <-resume:
+		return ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Server) registerRun(cancel context.CancelFunc) *simulationRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.runs == nil {
+		s.runs = make(map[string]*simulationRun)
+	}
+	s.nextRunID++
+	run := &simulationRun{
+		id:     fmt.Sprintf("sim-%d", s.nextRunID),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	s.runs[run.id] = run
+	return run
+}
+
+func (s *Server) unregisterRun(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if run, ok := s.runs[id]; ok {
+		delete(s.runs, id)
+		close(run.done)
+	}
+}
+
+// cancelRuns stops every streaming simulation, e.g. before the spec
+// changes, and waits for them to exit. Paused runs exit too.
+func (s *Server) cancelRuns() {
+	s.mu.RLock()
+	runs := make([]*simulationRun, 0, len(s.runs))
+	for _, run := range s.runs {
+		run.cancel()
+		runs = append(runs, run)
+	}
+	s.mu.RUnlock()
+	for _, run := range runs {
+		<-run.done
+	}
+}
+
+func (s *Server) lookupRun(id string) *simulationRun {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.runs[id]
+}
+
+// transitionAllowed reports whether guards and transition_prob/4 let t
+// fire from state. A guard that can't be looked up or evaluated, as once
+// the run's ctx is done, blocks the transition.
+func (sim *simulator) transitionAllowed(state string, t prolog.Transition, dice float64) bool {
+	if !sim.stateGuardSatisfied(state) {
+		return false
+	}
+	if !sim.transitionGuardSatisfied(t) {
+		return false
+	}
+	if sim.probData != nil && sim.probData.byFrom[t.From] {
+		key := transitionKey(t.From, t.Label, t.To)
+		rng, ok := sim.probData.byTransition[key]
+		if !ok {
+			return false
+		}
+		if dice < rng.Low || dice >= rng.High {
+			return false
+		}
+	}
+	return true
+}
+
+func (sim *simulator) stateGuardSatisfied(state string) bool {
+	hasGuard, err := sim.engine.QueryOne(sim.ctx, "state_guard(?, _).", state)
+	if err != nil {
+		log.Printf("state_guard lookup error: %v", err)
+		return false
+	}
+	if !hasGuard {
+		return true
+	}
+	ok, err := sim.engine.QueryOne(sim.ctx, "state_guard(?, Guard), call(Guard).", state)
+	if err != nil {
+		log.Printf("state_guard eval error: %v", err)
+		return false
+	}
+	return ok
+}
+
+func (sim *simulator) transitionGuardSatisfied(t prolog.Transition) bool {
+	hasGuard, err := sim.engine.QueryOne(sim.ctx, "transition_guard(?, ?, ?, _).", t.From, t.Label, t.To)
+	if err != nil {
+		log.Printf("transition_guard lookup error: %v", err)
+		return false
+	}
+	if !hasGuard {
+		return true
+	}
+	ok, err := sim.engine.QueryOne(sim.ctx, "transition_guard(?, ?, ?, Guard), call(Guard).", t.From, t.Label, t.To)
+	if err != nil {
+		log.Printf("transition_guard eval error: %v", err)
+		return false
+	}
+	return ok
+}
+
+// deliver enqueues a message sent on completion, sampling the channel's
+// declared faults. Messages across an active partition are dropped.
+func (sim *simulator) deliver(sender int, op model.Op) {
+	ch := op.Channel
+	fault := FaultEvent{Actor: sim.sys.Actors[sender], Channel: sim.sys.Channels[ch], Msg: op.Msg}
+	if sim.sys.Partitioned(sim.global.Cut, sender, ch) {
+		fault.Kind = "partitioned"
+		sim.recordFault(fault)
+		return
+	}
+	if p, ok := sim.sys.ChannelFault(ch, model.FaultLose); ok && sim.rng.Float64() < p {
+		fault.Kind = model.FaultLose
+		sim.recordFault(fault)
+		return
+	}
+
+	queue := sim.global.Chans[ch]
+	if p, ok := sim.sys.ChannelFault(ch, model.FaultReorder); ok && len(queue) > 0 && sim.rng.Float64() < p {
+		pos := sim.rng.Intn(len(queue))
+		reordered := append([]string(nil), queue[:pos]...)
+		reordered = append(reordered, op.Msg)
+		sim.global.Chans[ch] = append(reordered, queue[pos:]...)
+		sim.arrive(ch, pos)
+		fault.Kind = model.FaultReorder
+		sim.recordFault(fault)
+	} else {
+		sim.global.Chans[ch] = append(queue, op.Msg)
+		sim.arrive(ch, len(queue))
+	}
+
+	if p, ok := sim.sys.ChannelFault(ch, model.FaultDuplicate); ok && sim.rng.Float64() < p {
+		if len(sim.global.Chans[ch])+sim.pending[ch] < sim.sys.Capacity[ch] {
+			sim.global.Chans[ch] = append(sim.global.Chans[ch], op.Msg)
+			sim.arrive(ch, len(sim.global.Chans[ch])-1)
+			fault.Kind = model.FaultDuplicate
+			sim.recordFault(fault)
+		}
+	}
+}
+
+// injectFaults samples actor crashes and partition changes after a step
+func (sim *simulator) injectFaults() {
+	for _, c := range sim.sys.Crashes() {
+		actor := sim.sys.Actors[c.Actor]
+		if sim.global.Locals[c.Actor] == c.Recovery || sim.rng.Float64() >= c.Probability {
+			continue
+		}
+		if p := sim.busy[actor]; p != nil {
+			// Work in flight is lost; its received messages are gone too
+			p.cancelled = true
+			for _, op := range p.step.Sends {
+				sim.pending[op.Channel]--
+			}
+			sim.result.Actors[actor].Busy += sim.clock - p.start
+			delete(sim.busy, actor)
+		}
+		sim.recordFault(FaultEvent{
+			Kind:   "crash",
+			Actor:  actor,
+			Detail: sim.global.Locals[c.Actor] + " -> " + c.Recovery,
+		})
+		sim.global.Locals[c.Actor] = c.Recovery
+	}
+	for i := range sim.global.Cut {
+		name, p := sim.sys.Partition(i)
+		if sim.rng.Float64() >= p {
+			continue
+		}
+		sim.global.Cut[i] = !sim.global.Cut[i]
+		kind := "partition"
+		if !sim.global.Cut[i] {
+			kind = "heal"
+		}
+		sim.recordFault(FaultEvent{Kind: kind, Detail: name})
+	}
+}
+
+func (sim *simulator) recordFault(f FaultEvent) {
+	f.Step = int(sim.result.Total)
+	f.Time = sim.clock
+	sim.result.Faults = append(sim.result.Faults, f)
+	sim.result.ByFault[f.Kind]++
+}
+
+// roll draws dice0 and every declared random variable, in declaration
+// order so a seed replays the same draws
+func (sim *simulator) roll() map[string]float64 {
+	draws := make(map[string]float64, len(sim.randomVars)+1)
+	draws[diceVar] = sim.rng.Float64()
+	for _, v := range sim.randomVars {
+		draws[v.name] = v.dist.sample(sim.rng)
+	}
+	return draws
+}
+
+func (sim *simulator) setRollValues(draws map[string]float64) {
+	sim.clearRollValues()
+	for name, value := range draws {
+		_, _ = sim.engine.QueryOne(sim.ctx, "assertz(roll_value(?, ?)).", name, number(value))
+	}
+}
+
+func (sim *simulator) clearRollValues() {
+	_, _ = sim.engine.QueryOne(sim.ctx, "retractall(roll_value(_, _)).")
+}
+
+func (sim *simulator) setAccumulatorValue(name string, value float64) {
+	_, _ = sim.engine.QueryOne(sim.ctx, "retractall(accumulator_value(?, _)).", name)
+	_, _ = sim.engine.QueryOne(sim.ctx, "assertz(accumulator_value(?, ?)).", name, number(value))
+}
+
+// number binds a whole value as an integer, so guards such as roll(x, 5)
+// or acc(n, 0) match it; a float64 would bind as 5.0, which does not unify
+func number(v float64) interface{} {
+	if v == math.Trunc(v) && math.Abs(v) <= 1<<53 {
+		return int64(v)
+	}
+	return v
+}
+
+func (sim *simulator) clearAccumulatorValues() {
+	_, _ = sim.engine.QueryOne(sim.ctx, "retractall(accumulator_value(_, _)).")
+}
+
+// buildAccumulators returns the initial accumulator values and the rewards
+// keyed by transition label. Rewards must name a declared accumulator.
+func buildAccumulators(ctx context.Context, engine *prolog.Engine) (map[string]float64, map[string][]prolog.Reward, error) {
+	accumulators, err := engine.GetAccumulators(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	initial := make(map[string]float64, len(accumulators))
+	for _, a := range accumulators {
+		if _, exists := initial[a.Name]; exists {
+			return nil, nil, fmt.Errorf("accumulator duplicate for %s", a.Name)
+		}
+		initial[a.Name] = a.Initial
+	}
+
+	rewards, err := engine.GetRewards(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	byLabel := make(map[string][]prolog.Reward)
+	for _, r := range rewards {
+		if _, ok := initial[r.Name]; !ok {
+			return nil, nil, fmt.Errorf("reward for %s references undeclared accumulator %s", r.Label, r.Name)
+		}
+		byLabel[r.Label] = append(byLabel[r.Label], r)
+	}
+	return initial, byLabel, nil
+}
+
+func validateAccumulators(ctx context.Context, engine *prolog.Engine) error {
+	_, _, err := buildAccumulators(ctx, engine)
+	return err
+}
+
+// diceVar is the implicit uniform [0, 1) random variable behind dice0/2
+// and transition_prob/4
+const diceVar = "dice0"
+
+// randomVar is a parsed random_var/2 declaration
+type randomVar struct {
+	name string
+	dist distribution
+}
+
+// buildRandomVars parses random_var/2 declarations in declaration order
+func buildRandomVars(ctx context.Context, engine *prolog.Engine) ([]randomVar, error) {
+	decls, err := engine.GetRandomVars(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(decls))
+	vars := make([]randomVar, 0, len(decls))
+	for _, d := range decls {
+		if d.Name == diceVar {
+			return nil, fmt.Errorf("random_var %s is reserved for dice0/2", diceVar)
+		}
+		if seen[d.Name] {
+			return nil, fmt.Errorf("random_var duplicate for %s", d.Name)
+		}
+		seen[d.Name] = true
+		dist, err := parseDistribution(d.Dist)
+		if err != nil {
+			return nil, fmt.Errorf("random_var %s: %w", d.Name, err)
+		}
+		vars = append(vars, randomVar{name: d.Name, dist: dist})
+	}
+	return vars, nil
+}
+
+func validateRandomVars(ctx context.Context, engine *prolog.Engine) error {
+	_, err := buildRandomVars(ctx, engine)
+	return err
+}
+
+// buildTransitionPriorities returns transition_priority/4 keyed by transitionKey
+func buildTransitionPriorities(ctx context.Context, engine *prolog.Engine) (map[string]float64, error) {
+	decls, err := engine.GetTransitionPriorities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	priorities := make(map[string]float64, len(decls))
+	for _, p := range decls {
+		key := transitionKey(p.From, p.Label, p.To)
+		if _, exists := priorities[key]; exists {
+			return nil, fmt.Errorf("transition_priority duplicate for %s", key)
+		}
+		priorities[key] = p.Priority
+	}
+	return priorities, nil
+}
+
+func validateTransitionPriorities(ctx context.Context, engine *prolog.Engine) error {
+	_, err := buildTransitionPriorities(ctx, engine)
+	return err
+}
+
+// buildTransitionDurations parses transition_duration/4 declarations,
+// keyed by transitionKey.
+func buildTransitionDurations(ctx context.Context, engine *prolog.Engine) (map[string]distribution, error) {
+	decls, err := engine.GetTransitionDurations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	durations := make(map[string]distribution, len(decls))
+	for _, d := range decls {
+		key := transitionKey(d.From, d.Label, d.To)
+		if _, exists := durations[key]; exists {
+			return nil, fmt.Errorf("transition_duration duplicate for %s", key)
+		}
+		dist, err := parseDuration(d.Dist)
+		if err != nil {
+			return nil, fmt.Errorf("transition_duration for %s --%s--> %s: %w", d.From, d.Label, d.To, err)
+		}
+		durations[key] = dist
+	}
+	return durations, nil
+}
+
+func validateTransitionDurations(ctx context.Context, engine *prolog.Engine) error {
+	_, err := buildTransitionDurations(ctx, engine)
+	return err
+}
@@ -0,0 +1,473 @@
+package server
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+func loadTestEngine(t *testing.T, spec string) *prolog.Engine {
+	t.Helper()
+	engine, err := prolog.New()
+	if err != nil {
+		t.Fatalf("prolog.New error: %v", err)
+	}
+	if err := engine.LoadSpec(spec); err != nil {
+		t.Fatalf("LoadSpec error: %v", err)
+	}
+	return engine
+}
+
+// newTestServer serves engine as the live spec
+func newTestServer(engine *prolog.Engine) *Server {
+	s := &Server{counters: make(map[string]int64)}
+	s.live.Store(engine)
+	return s
+}
+
+func mustRunSimulation(t *testing.T, engine *prolog.Engine, opts simulationOptions) SimulationResult {
+	t.Helper()
+	if opts.Seed == 0 {
+		opts.Seed = 1
+	}
+	result, err := runSimulation(context.Background(), engine, opts)
+	if err != nil {
+		t.Fatalf("runSimulation error: %v", err)
+	}
+	return result
+}
+
+func TestParseDistribution(t *testing.T) {
+	tests := []struct {
+		term    string
+		kind    string
+		params  []float64
+		wantErr bool
+	}{
+		{"const(5)", "const", []float64{5}, false},
+		{"uniform(2,4)", "uniform", []float64{2, 4}, false},
+		{"exp(0.3)", "exp", []float64{0.3}, false},
+		{"normal(10, 2)", "normal", []float64{10, 2}, false},
+		{"7", "const", []float64{7}, false},
+		{"const(-5)", "const", []float64{-5}, false},
+		{"uniform(4,2)", "", nil, true},
+		{"exp(0)", "", nil, true},
+		{"poisson(3)", "", nil, true},
+		{"normal(1)", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.term, func(t *testing.T) {
+			d, err := parseDistribution(tt.term)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDistribution(%q) error = %v, wantErr %v", tt.term, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if d.Kind != tt.kind || len(d.Params) != len(tt.params) {
+				t.Fatalf("parseDistribution(%q) = %v", tt.term, d)
+			}
+			for i := range tt.params {
+				if d.Params[i] != tt.params[i] {
+					t.Errorf("param %d = %f, want %f", i, d.Params[i], tt.params[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseDurationRejectsNegativeSupport(t *testing.T) {
+	for _, term := range []string{"const(-1)", "uniform(-3,-1)", "uniform(-1,2)", "exp(-0.5)", "normal(0, 1)", "normal(-10, 2)"} {
+		if d, err := parseDuration(term); err == nil {
+			t.Errorf("parseDuration(%q) = %v, want error", term, d)
+		}
+	}
+	for _, term := range []string{"const(0)", "uniform(0,2)", "exp(0.3)", "normal(10, 2)"} {
+		if _, err := parseDuration(term); err != nil {
+			t.Errorf("parseDuration(%q) error: %v", term, err)
+		}
+	}
+
+	// A normal duration keeps its mean positive, but the tail below zero
+	// is still truncated rather than sampled as negative time
+	d, _ := parseDuration("normal(1, 100)")
+	rng := rand.New(rand.NewSource(1))
+	zeros := 0
+	for i := 0; i < 1000; i++ {
+		v := d.sampleDuration(rng)
+		if v < 0 {
+			t.Fatalf("sampled negative duration %f", v)
+		}
+		if v == 0 {
+			zeros++
+		}
+	}
+	if zeros == 0 {
+		t.Errorf("expected some normal(1, 100) draws truncated to zero")
+	}
+}
+
+func TestSimulationClockAndUtilization(t *testing.T) {
+	engine := loadTestEngine(t, `
+        actor_initial(worker, worker_idle).
+        actor_transition(worker, worker_idle, start, worker_busy).
+        actor_transition(worker, worker_busy, finish, worker_idle).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        transition_duration(worker_idle, start, worker_busy, const(1)).
+        transition_duration(worker_busy, finish, worker_idle, const(3)).
+    `)
+
+	result := mustRunSimulation(t, engine, simulationOptions{Steps: 4})
+	if result.Total != 4 {
+		t.Fatalf("expected 4 transitions, got %d", result.Total)
+	}
+	if result.Time != 8 {
+		t.Errorf("expected simulated time 8, got %f", result.Time)
+	}
+	last := result.Timeline[3]
+	if last.Start != 5 || last.Time != 8 || last.Actor != "worker" {
+		t.Errorf("unexpected last event %+v", last)
+	}
+	acct := result.Actors["worker"]
+	if acct == nil {
+		t.Fatalf("expected utilization for worker, got %v", result.Actors)
+	}
+	if acct.Utilization != 1 || acct.Idle != 0 {
+		t.Errorf("expected fully utilized worker, got %+v", acct)
+	}
+}
+
+func TestSimulationIdleActorWaitsForOthers(t *testing.T) {
+	engine := loadTestEngine(t, `
+        actor_initial(oven, oven_cold).
+        actor_initial(clerk, clerk_ready).
+        actor_transition(oven, oven_cold, bake, oven_done).
+        actor_transition(clerk, clerk_ready, sell, clerk_done).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        transition_duration(oven_cold, bake, oven_done, const(10)).
+        transition_duration(clerk_ready, sell, clerk_done, const(2)).
+    `)
+
+	result := mustRunSimulation(t, engine, simulationOptions{Steps: 10})
+	if result.Total != 2 {
+		t.Fatalf("expected 2 transitions, got %d", result.Total)
+	}
+	if result.Time != 10 {
+		t.Errorf("expected simulated time 10, got %f", result.Time)
+	}
+	if result.Timeline[0].Label != "sell" {
+		t.Errorf("expected shorter sell to complete first, got %s", result.Timeline[0].Label)
+	}
+	clerk := result.Actors["clerk"]
+	if math.Abs(clerk.Utilization-0.2) > 1e-9 || clerk.Idle != 8 {
+		t.Errorf("expected clerk utilization 0.2 with 8 idle, got %+v", clerk)
+	}
+}
+
+func TestBundledBreadCompanyClockAdvances(t *testing.T) {
+	engine, err := prolog.New()
+	if err != nil {
+		t.Fatalf("prolog.New error: %v", err)
+	}
+	if err := engine.LoadSpecFile(filepath.Join("..", "..", "specs", "bread_company.pl")); err != nil {
+		t.Fatalf("LoadSpecFile error: %v", err)
+	}
+
+	result := mustRunSimulation(t, engine, simulationOptions{Steps: 1000})
+	if result.Time <= 0 {
+		t.Fatalf("expected the clock to advance, got time %f", result.Time)
+	}
+	for _, actor := range []string{"factory", "truck", "charity"} {
+		if acct := result.Actors[actor]; acct == nil || acct.Utilization <= 0 {
+			t.Errorf("expected %s to do timed work, got %+v", actor, acct)
+		}
+	}
+}
+
+func TestSimulationReportsZeroTimeLivelock(t *testing.T) {
+	engine := loadTestEngine(t, `
+        actor_initial(spinner, spinner_idle).
+        actor_initial(oven, oven_cold).
+        actor_transition(spinner, spinner_idle, spin, spinner_idle).
+        actor_transition(oven, oven_cold, bake, oven_done).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        transition_duration(oven_cold, bake, oven_done, const(10)).
+    `)
+
+	_, err := runSimulation(context.Background(), engine, simulationOptions{Steps: 1000, Seed: 1})
+	if err == nil || !strings.Contains(err.Error(), "zero-time livelock") || !strings.Contains(err.Error(), "spin") {
+		t.Fatalf("expected a zero-time livelock error naming spin, got %v", err)
+	}
+
+	// Without timed work waiting, an untimed cycle is just a fast one
+	engine = loadTestEngine(t, `
+        actor_initial(spinner, spinner_idle).
+        actor_transition(spinner, spinner_idle, spin, spinner_idle).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+    `)
+	if result := mustRunSimulation(t, engine, simulationOptions{Steps: 1000}); result.Total != 1000 {
+		t.Errorf("expected 1000 untimed transitions, got %d", result.Total)
+	}
+}
+
+func TestValidateTransitionDurations(t *testing.T) {
+	engine := loadTestEngine(t, `
+        initial(s0).
+        transition(s0, go, s1).
+        transition_duration(s0, go, s1, uniform(5, 1)).
+    `)
+
+	if err := validateSpec(context.Background(), engine); err == nil {
+		t.Errorf("expected invalid uniform duration to be rejected")
+	}
+
+	// A duration that could be negative never reaches transition_time/5
+	engine = loadTestEngine(t, `
+        initial(s0).
+        transition(s0, go, s1).
+        transition_duration(s0, go, s1, uniform(-3, -1)).
+    `)
+	if err := validateSpec(context.Background(), engine); err == nil {
+		t.Errorf("expected negative uniform duration to be rejected")
+	}
+}
+
+func TestSimulationAccumulatorsAndGuards(t *testing.T) {
+	engine := loadTestEngine(t, `
+        initial(shop_open).
+        transition(shop_open, sell, shop_open).
+        transition(shop_open, celebrate, shop_done).
+        accumulator(profit, 10).
+        reward(profit, sell, 5).
+        transition_guard(shop_open, celebrate, shop_done, rich).
+        transition_guard(shop_open, sell, shop_open, not_rich).
+        rich :- acc(profit, P), P >= 30.
+        not_rich :- acc(profit, P), P < 30.
+    `)
+
+	result := mustRunSimulation(t, engine, simulationOptions{Steps: 10})
+	if result.Total != 5 {
+		t.Fatalf("expected 4 sales and a celebration, got %d transitions", result.Total)
+	}
+	if last := result.Timeline[len(result.Timeline)-1]; last.Label != "celebrate" {
+		t.Errorf("expected celebrate last, got %s", last.Label)
+	}
+	if result.Accumulators["profit"] != 30 {
+		t.Errorf("expected profit 30, got %f", result.Accumulators["profit"])
+	}
+	series := result.AccumulatorSeries["profit"]
+	if len(series) != 5 || series[0].Value != 10 || series[4].Step != 4 {
+		t.Errorf("unexpected profit series %+v", series)
+	}
+
+	ok, err := engine.QueryOne(context.Background(), "acc(profit, 10).")
+	if err != nil || !ok {
+		t.Errorf("expected acc/2 to fall back to the initial value after simulation, got %v %v", ok, err)
+	}
+}
+
+func TestValidateRewardNeedsAccumulator(t *testing.T) {
+	engine := loadTestEngine(t, `
+        initial(s0).
+        transition(s0, go, s1).
+        reward(profit, go, 1).
+    `)
+
+	if err := validateSpec(context.Background(), engine); err == nil {
+		t.Errorf("expected reward on undeclared accumulator to be rejected")
+	}
+}
+
+func TestSimulateStream(t *testing.T) {
+	engine := loadTestEngine(t, `
+        initial(s0).
+        transition(s0, tick, s1).
+        transition(s1, tock, s0).
+    `)
+	s := newTestServer(engine)
+
+	req := httptest.NewRequest("GET", "/api/simulate/stream?steps=3&interval=2", nil)
+	rec := httptest.NewRecorder()
+	s.handleSimulateStream(rec, req)
+
+	body := rec.Body.String()
+	if got := rec.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %q", got)
+	}
+	for event, want := range map[string]int{
+		"event: start\n":    1,
+		"event: step\n":     3,
+		"event: snapshot\n": 1,
+		"event: done\n":     1,
+	} {
+		if got := strings.Count(body, event); got != want {
+			t.Errorf("expected %d %q events, got %d", want, strings.TrimSpace(event), got)
+		}
+	}
+	if s.cachedSimulation == nil || s.cachedSimulation.Total != 3 {
+		t.Errorf("expected streamed result to be cached, got %+v", s.cachedSimulation)
+	}
+	if len(s.runs) != 0 {
+		t.Errorf("expected finished run to be unregistered, got %d", len(s.runs))
+	}
+}
+
+func TestSimulationRunPauseResumeCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{}
+	run := s.registerRun(cancel)
+
+	run.pause()
+	if !run.paused() {
+		t.Fatalf("expected run to be paused")
+	}
+	done := make(chan error, 1)
+	go func() { done <- run.wait(ctx) }()
+	select {
+	case <-done:
+		t.Fatalf("wait returned while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	run.unpause()
+	if err := <-done; err != nil {
+		t.Errorf("expected resume without error, got %v", err)
+	}
+
+	run.pause()
+	go func() {
+		err := run.wait(ctx)
+		// The stream handler unregisters its run on exit
+		s.unregisterRun(run.id)
+		done <- err
+	}()
+	s.cancelRuns()
+	if len(s.runs) != 0 {
+		t.Errorf("expected cancelRuns to wait for the run to exit")
+	}
+	if err := <-done; err == nil {
+		t.Errorf("expected cancelled wait to return an error")
+	}
+}
+
+const demandSpec = `
+        actor_initial(shop, shop_open).
+        actor_initial(mill, mill_idle).
+        actor_transition(shop, shop_open, rush, shop_open).
+        actor_transition(shop, shop_open, lull, shop_open).
+        actor_transition(mill, mill_idle, grind, mill_idle).
+        transition(F, L, T) :- actor_transition(_, F, L, T).
+        initial(S) :- actor_initial(_, S).
+        random_var(demand, uniform(0, 10)).
+        transition_guard(shop_open, rush, shop_open, busy_day).
+        transition_guard(shop_open, lull, shop_open, quiet_day).
+        busy_day :- roll(demand, D), D >= 5.
+        quiet_day :- roll(demand, D), D < 5.
+    `
+
+func TestSimulationRandomVarsDrivenGuardsAndLogged(t *testing.T) {
+	engine := loadTestEngine(t, demandSpec)
+
+	result := mustRunSimulation(t, engine, simulationOptions{Steps: 200})
+	if result.ByType["rush"] == 0 || result.ByType["lull"] == 0 {
+		t.Fatalf("expected both rush and lull to fire, got %v", result.ByType)
+	}
+	for _, ev := range result.Timeline {
+		dice, ok := ev.Draws[diceVar]
+		if !ok || dice < 0 || dice >= 1 {
+			t.Fatalf("expected a dice0 draw in %+v", ev)
+		}
+		demand, ok := ev.Draws["demand"]
+		if !ok {
+			t.Fatalf("expected a demand draw in %+v", ev)
+		}
+		if (ev.Label == "rush" && demand < 5) || (ev.Label == "lull" && demand >= 5) {
+			t.Errorf("%s fired with demand %f", ev.Label, demand)
+		}
+	}
+
+	ok, err := engine.QueryOne(context.Background(), "roll(demand, D), D =:= 5.")
+	if err != nil || !ok {
+		t.Errorf("expected roll/2 to fall back to the mean after simulation, got %v %v", ok, err)
+	}
+}
+
+func TestSimulationSeedReplays(t *testing.T) {
+	engine := loadTestEngine(t, demandSpec)
+
+	first := mustRunSimulation(t, engine, simulationOptions{Steps: 50, Seed: 42})
+	second := mustRunSimulation(t, engine, simulationOptions{Steps: 50, Seed: 42})
+	if first.Seed != 42 {
+		t.Errorf("expected seed 42 in result, got %d", first.Seed)
+	}
+	if !reflect.DeepEqual(first.Timeline, second.Timeline) {
+		t.Errorf("expected identical timelines for the same seed")
+	}
+}
+
+func TestRandomVarsAcceptConstantsOutsideDurations(t *testing.T) {
+	engine := loadTestEngine(t, `
+        initial(s0).
+        transition(s0, go, s1).
+        random_var(debt, const(-5)).
+        random_var(bonus, 7).
+    `)
+	ctx := context.Background()
+	if err := validateSpec(ctx, engine); err != nil {
+		t.Fatalf("expected negative and bare-number random_vars to be accepted, got %v", err)
+	}
+	ok, err := engine.QueryOne(ctx, "roll(debt, -5), roll(bonus, 7).")
+	if err != nil || !ok {
+		t.Errorf("expected roll/2 to fall back to the constants, got %v %v", ok, err)
+	}
+
+	engine = loadTestEngine(t, "initial(s0).\ntransition(s0, go, s1).\ntransition_duration(s0, go, s1, const(-5)).")
+	if err := validateSpec(ctx, engine); err == nil {
+		t.Errorf("expected a negative const transition_duration to be rejected")
+	}
+}
+
+func TestSimulationBindsWholeValuesAsIntegers(t *testing.T) {
+	engine := loadTestEngine(t, `
+        initial(s0).
+        transition(s0, start, s1).
+        transition(s1, stop, s2).
+        random_var(x, const(5)).
+        accumulator(n, 0).
+        transition_guard(s0, start, s1, rolled_five).
+        transition_guard(s1, stop, s2, none_yet).
+        rolled_five :- roll(x, 5).
+        none_yet :- acc(n, 0).
+    `)
+	result := mustRunSimulation(t, engine, simulationOptions{Steps: 10})
+	if result.Total != 2 {
+		t.Errorf("expected guards on integer literals to match whole rolls and accumulators, got %+v", result.Timeline)
+	}
+}
+
+func TestValidateRandomVars(t *testing.T) {
+	for name, decls := range map[string]string{
+		"duplicate": "random_var(x, const(1)).\nrandom_var(x, const(2)).",
+		"reserved":  "random_var(dice0, uniform(0, 1)).",
+		"invalid":   "random_var(x, poisson(3)).",
+	} {
+		t.Run(name, func(t *testing.T) {
+			engine := loadTestEngine(t, "initial(s0).\ntransition(s0, go, s1).\n"+decls)
+			if err := validateSpec(context.Background(), engine); err == nil {
+				t.Errorf("expected %s random_var to be rejected", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,435 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+// maxSweepRuns caps the simulations one sweep may run across its grid
+const maxSweepRuns = 20000
+
+// maxSweepSteps caps the steps of each simulation in a sweep
+const maxSweepSteps = 10000
+
+// paramEngine returns an engine with param/2 overrides applied. Overrides
+// go on a clone so concurrent requests never see each other's values.
+func paramEngine(ctx context.Context, engine *prolog.Engine, params map[string]float64) (*prolog.Engine, error) {
+	if len(params) == 0 {
+		return engine, nil
+	}
+	c, err := engine.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SetParams(ctx, params); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseParamOverrides reads repeated name=value pairs, as given by
+// ?param=rate=0.3&param=servers=2
+func parseParamOverrides(values []string) (map[string]float64, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	params := make(map[string]float64, len(values))
+	for _, pair := range values {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("param %q must be name=value", pair)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("param %s: %w", name, err)
+		}
+		params[strings.TrimSpace(name)] = v
+	}
+	return params, nil
+}
+
+// sweepMetric is what a sweep measures at each grid point
+type sweepMetric struct {
+	kind string
+	arg  string
+}
+
+// parseSweepMetric reads reach(State), fired(Label), count(Label),
+// acc(Name), time or ctl(Formula)
+func parseSweepMetric(text string) (sweepMetric, error) {
+	text = strings.TrimSpace(text)
+	if text == "time" {
+		return sweepMetric{kind: "time"}, nil
+	}
+	open := strings.Index(text, "(")
+	if open <= 0 || !strings.HasSuffix(text, ")") {
+		return sweepMetric{}, fmt.Errorf("unknown sweep metric %q", text)
+	}
+	m := sweepMetric{kind: text[:open], arg: strings.TrimSpace(text[open+1 : len(text)-1])}
+	switch m.kind {
+	case "reach", "fired", "count", "acc", "ctl":
+	default:
+		return sweepMetric{}, fmt.Errorf("unknown sweep metric %q", text)
+	}
+	if m.arg == "" {
+		return sweepMetric{}, fmt.Errorf("sweep metric %s needs an argument", m.kind)
+	}
+	return m, nil
+}
+
+// simulated reports whether the metric is measured over simulation runs
+// rather than by a single model check
+func (m sweepMetric) simulated() bool {
+	return m.kind != "ctl"
+}
+
+// measure returns the metric's value for one simulation run
+func (m sweepMetric) measure(result *SimulationResult) (float64, error) {
+	switch m.kind {
+	case "reach":
+		for _, ev := range result.Timeline {
+			if ev.From == m.arg || ev.To == m.arg {
+				return 1, nil
+			}
+		}
+		return 0, nil
+	case "fired":
+		if result.ByType[m.arg] > 0 {
+			return 1, nil
+		}
+		return 0, nil
+	case "count":
+		return float64(result.ByType[m.arg]), nil
+	case "acc":
+		v, ok := result.Accumulators[m.arg]
+		if !ok {
+			return 0, fmt.Errorf("unknown accumulator %s", m.arg)
+		}
+		return v, nil
+	case "time":
+		return result.Time, nil
+	}
+	return 0, fmt.Errorf("sweep metric %s is not measured by simulation", m.kind)
+}
+
+// SweepRow is the metric at one grid point. Value is the mean over runs
+// (a probability for reach and fired), and 1 or 0 for ctl.
+type SweepRow struct {
+	Params map[string]float64 `json:"params"`
+	Value  float64            `json:"value"`
+	StdDev float64            `json:"stddev"`
+	Runs   int                `json:"runs"`
+}
+
+// SweepChart plots the metric against one param, averaging over the
+// others, in the shape of /api/visualize line charts
+type SweepChart struct {
+	Param  string                   `json:"param"`
+	Series []map[string]interface{} `json:"series"`
+}
+
+// Sensitivity summarizes how much the metric moves across one param's
+// values: the range of its marginal means and their least-squares slope
+type Sensitivity struct {
+	Param  string  `json:"param"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Effect float64 `json:"effect"`
+	Slope  float64 `json:"slope"`
+}
+
+// sweepRequest is the body of POST /api/sweep
+type sweepRequest struct {
+	Params    map[string][]float64 `json:"params"`
+	Metric    string               `json:"metric"`
+	Runs      int                  `json:"runs"`
+	Steps     int                  `json:"steps"`
+	Seed      *int64               `json:"seed"`
+	Scheduler string               `json:"scheduler"`
+	Model     string               `json:"model"`
+}
+
+// SweepResult is the response of POST /api/sweep
+type SweepResult struct {
+	Metric      string        `json:"metric"`
+	Params      []string      `json:"params"`
+	Seed        int64         `json:"seed"`
+	Rows        []SweepRow    `json:"rows"`
+	Charts      []SweepChart  `json:"charts"`
+	Sensitivity []Sensitivity `json:"sensitivity"`
+}
+
+// runSweep evaluates the metric at every point of the params grid. Run i
+// at each point uses seed+i, so differences between points come from the
+// params rather than from the dice.
+func runSweep(ctx context.Context, engine *prolog.Engine, req sweepRequest) (*SweepResult, error) {
+	metric, err := parseSweepMetric(req.Metric)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Params) == 0 {
+		return nil, fmt.Errorf("sweep needs at least one param")
+	}
+	names := make([]string, 0, len(req.Params))
+	points := 1
+	for name, values := range req.Params {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("param %s has no values to sweep", name)
+		}
+		if len(values) > maxSweepRuns/points {
+			return nil, fmt.Errorf("sweep grid exceeds %d points", maxSweepRuns)
+		}
+		names = append(names, name)
+		points *= len(values)
+	}
+	sort.Strings(names)
+
+	runs := req.Runs
+	if runs <= 0 {
+		runs = 20
+	}
+	if !metric.simulated() {
+		runs = 1
+	}
+	if runs > maxSweepRuns || points > maxSweepRuns/runs {
+		return nil, fmt.Errorf("sweep of %d points x %d runs exceeds %d runs", points, runs, maxSweepRuns)
+	}
+	steps := req.Steps
+	if steps <= 0 {
+		steps = 200
+	}
+	if steps > maxSweepSteps {
+		return nil, fmt.Errorf("sweep of %d steps per run exceeds %d steps", steps, maxSweepSteps)
+	}
+	seed := newSeed()
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+	if _, err := newScheduler(req.Scheduler, nil); err != nil {
+		return nil, err
+	}
+
+	grid := make([]map[string]float64, points)
+	for i := range grid {
+		params := make(map[string]float64, len(names))
+		rest := i
+		for j := len(names) - 1; j >= 0; j-- {
+			values := req.Params[names[j]]
+			params[names[j]] = values[rest%len(values)]
+			rest /= len(values)
+		}
+		grid[i] = params
+	}
+
+	var rows []SweepRow
+	if metric.simulated() {
+		rows, err = sweepSimulations(ctx, engine, metric, grid, simulationOptions{Steps: steps, Scheduler: req.Scheduler, Seed: seed, Model: req.Model}, runs)
+	} else {
+		rows, err = sweepChecks(ctx, engine, metric, grid)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SweepResult{Metric: req.Metric, Params: names, Seed: seed, Rows: rows}
+	result.Charts, result.Sensitivity = sweepMarginals(req.Metric, names, result.Rows)
+	return result, nil
+}
+
+// sweepChecks evaluates a ctl metric at each point of the grid
+func sweepChecks(ctx context.Context, engine *prolog.Engine, metric sweepMetric, grid []map[string]float64) ([]SweepRow, error) {
+	rows := make([]SweepRow, 0, len(grid))
+	for _, params := range grid {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		pe, err := paramEngine(ctx, engine, params)
+		if err != nil {
+			return nil, err
+		}
+		check, err := checkProperty(ctx, pe, metric.arg, "")
+		if err != nil {
+			return nil, err
+		}
+		row := SweepRow{Params: params, Runs: 1}
+		if check.SatisfiedAll {
+			row.Value = 1
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// sweepSimulations runs every simulation of the sweep concurrently. Each
+// worker simulates on an engine of its own, overriding the params per run,
+// and rows are summed in run order so results don't depend on scheduling.
+func sweepSimulations(ctx context.Context, engine *prolog.Engine, metric sweepMetric, grid []map[string]float64, opts simulationOptions, runs int) ([]SweepRow, error) {
+	values := make([]float64, len(grid)*runs)
+	errs := make([]error, len(values))
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(values) {
+		workers = len(values)
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var own *prolog.Engine
+			for job := range jobs {
+				if own == nil {
+					c, err := engine.Clone()
+					if err != nil {
+						errs[job] = err
+						continue
+					}
+					own = c
+				}
+				run := opts
+				run.Params = grid[job/runs]
+				run.Seed = opts.Seed + int64(job%runs)
+				sim, err := runSimulation(ctx, own, run)
+				if err != nil {
+					errs[job] = err
+					continue
+				}
+				values[job], errs[job] = metric.measure(&sim)
+			}
+		}()
+	}
+	for job := range values {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rows := make([]SweepRow, 0, len(grid))
+	for i, params := range grid {
+		row := SweepRow{Params: params, Runs: runs}
+		var sum, sumSq float64
+		for job := i * runs; job < (i+1)*runs; job++ {
+			if errs[job] != nil {
+				return nil, errs[job]
+			}
+			sum += values[job]
+			sumSq += values[job] * values[job]
+		}
+		row.Value = sum / float64(runs)
+		row.StdDev = math.Sqrt(math.Max(0, sumSq/float64(runs)-row.Value*row.Value))
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// sweepMarginals averages the rows over every param but one, giving a line
+// chart and a sensitivity summary per param. Sensitivities are sorted with
+// the largest effect first.
+func sweepMarginals(metric string, names []string, rows []SweepRow) ([]SweepChart, []Sensitivity) {
+	charts := make([]SweepChart, 0, len(names))
+	sens := make([]Sensitivity, 0, len(names))
+	for _, name := range names {
+		sums := make(map[float64]float64)
+		counts := make(map[float64]int)
+		for _, row := range rows {
+			x := row.Params[name]
+			sums[x] += row.Value
+			counts[x]++
+		}
+		xs := make([]float64, 0, len(sums))
+		for x := range sums {
+			xs = append(xs, x)
+		}
+		sort.Float64s(xs)
+
+		pts := make([]map[string]float64, 0, len(xs))
+		s := Sensitivity{Param: name, Min: math.Inf(1), Max: math.Inf(-1)}
+		var mx, my float64
+		for _, x := range xs {
+			y := sums[x] / float64(counts[x])
+			pts = append(pts, map[string]float64{"x": x, "y": y})
+			s.Min = math.Min(s.Min, y)
+			s.Max = math.Max(s.Max, y)
+			mx += x
+			my += y
+		}
+		mx /= float64(len(xs))
+		my /= float64(len(xs))
+		var sxy, sxx float64
+		for _, p := range pts {
+			sxy += (p["x"] - mx) * (p["y"] - my)
+			sxx += (p["x"] - mx) * (p["x"] - mx)
+		}
+		if sxx > 0 {
+			s.Slope = sxy / sxx
+		}
+		s.Effect = s.Max - s.Min
+
+		charts = append(charts, SweepChart{
+			Param:  name,
+			Series: []map[string]interface{}{{"name": metric, "points": pts}},
+		})
+		sens = append(sens, s)
+	}
+	sort.SliceStable(sens, func(i, j int) bool { return sens[i].Effect > sens[j].Effect })
+	return charts, sens
+}
+
+// handleSweep runs simulations or model checks across a grid of param
+// values and reports a results table, line charts and sensitivities
+func (s *Server) handleSweep(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req sweepRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 120*time.Second)
+	defer cancel()
+
+	result, err := runSweep(ctx, s.current(), req)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"metric":      result.Metric,
+		"params":      result.Params,
+		"seed":        result.Seed,
+		"rows":        result.Rows,
+		"charts":      result.Charts,
+		"sensitivity": result.Sensitivity,
+	})
+
+	s.incCounter("sweeps")
+}
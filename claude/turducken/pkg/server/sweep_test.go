@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// shopSpec sells out on a customer's first visit with probability p_buy,
+// and only while stock lasts
+const shopSpec = `
+        param(p_buy, 0.5).
+        param(stock, 1).
+        initial(waiting).
+        prop(sold_out, sold_out).
+        in_stock :- param_value(stock, S), S > 0.
+        transition(waiting, buy, sold_out) :- in_stock.
+        transition(waiting, leave, waiting).
+        transition_prob(waiting, buy, sold_out, param(p_buy)) :- in_stock.
+        transition_prob(waiting, leave, waiting, 1 - param(p_buy)) :- in_stock.
+    `
+
+func TestSimulationParamOverrides(t *testing.T) {
+	engine := loadTestEngine(t, shopSpec)
+
+	never := mustRunSimulation(t, engine, simulationOptions{Steps: 10, Params: map[string]float64{"p_buy": 0}})
+	if never.ByType["buy"] != 0 || never.Params["p_buy"] != 0 {
+		t.Errorf("expected no sales with p_buy=0, got %+v", never.ByType)
+	}
+	always := mustRunSimulation(t, engine, simulationOptions{Steps: 10, Params: map[string]float64{"p_buy": 1}})
+	if always.ByType["buy"] != 1 {
+		t.Errorf("expected a sale on the first step with p_buy=1, got %+v", always.ByType)
+	}
+
+	if _, err := runSimulation(context.Background(), engine, simulationOptions{Steps: 1, Seed: 1, Params: map[string]float64{"missing": 1}}); err == nil {
+		t.Errorf("expected an error for an undeclared param")
+	}
+}
+
+func TestSimulationRejectsInvalidParamOverrides(t *testing.T) {
+	engine := loadTestEngine(t, `
+        param(d, 5).
+        initial(a).
+        transition(a, go, b).
+        transition(b, back, a).
+        transition_duration(a, go, b, const(param(d))).
+        transition_duration(b, back, a, const(1)).
+    `)
+	if _, err := runSimulation(context.Background(), engine, simulationOptions{Steps: 10, Seed: 1, Params: map[string]float64{"d": -3}}); err == nil {
+		t.Errorf("expected a negative duration from a param override to be rejected")
+	}
+}
+
+func TestSweepSimulationMetric(t *testing.T) {
+	engine := loadTestEngine(t, shopSpec)
+	seed := int64(7)
+	result, err := runSweep(context.Background(), engine, sweepRequest{
+		Params: map[string][]float64{"p_buy": {0, 0.5, 1}, "stock": {0, 1}},
+		Metric: "reach(sold_out)",
+		Runs:   40,
+		Steps:  1,
+		Seed:   &seed,
+	})
+	if err != nil {
+		t.Fatalf("runSweep error: %v", err)
+	}
+	if len(result.Rows) != 6 {
+		t.Fatalf("expected a row per grid point, got %+v", result.Rows)
+	}
+	for _, row := range result.Rows {
+		p, stock := row.Params["p_buy"], row.Params["stock"]
+		switch {
+		case stock == 0 || p == 0:
+			if row.Value != 0 {
+				t.Errorf("expected no sell-out at %+v, got %v", row.Params, row.Value)
+			}
+		case p == 1:
+			if row.Value != 1 {
+				t.Errorf("expected certain sell-out at %+v, got %v", row.Params, row.Value)
+			}
+		default:
+			if row.Value <= 0 || row.Value >= 1 || row.StdDev == 0 {
+				t.Errorf("expected a sell-out probability strictly between 0 and 1 at %+v, got %+v", row.Params, row)
+			}
+		}
+	}
+
+	if len(result.Charts) != 2 || result.Charts[0].Param != "p_buy" {
+		t.Fatalf("expected a chart per param, got %+v", result.Charts)
+	}
+	if len(result.Sensitivity) != 2 || result.Sensitivity[0].Param != "p_buy" || result.Sensitivity[0].Slope <= 0 {
+		t.Errorf("expected p_buy to be the most sensitive param, got %+v", result.Sensitivity)
+	}
+}
+
+func TestSweepRejectsOversizedRequests(t *testing.T) {
+	engine := loadTestEngine(t, shopSpec)
+	wide := make(map[string][]float64)
+	for i := 0; i < 40; i++ {
+		wide[fmt.Sprintf("p%d", i)] = []float64{1, 2, 3, 4}
+	}
+	for _, req := range []sweepRequest{
+		{Params: map[string][]float64{"p_buy": {0.1, 0.2, 0.3, 0.4}}, Metric: "time", Runs: 1 << 62},
+		{Params: wide, Metric: "time", Runs: 1},
+		{Params: map[string][]float64{"p_buy": {0.5}}, Metric: "time", Runs: 1, Steps: maxSweepSteps + 1},
+	} {
+		if _, err := runSweep(context.Background(), engine, req); err == nil || !strings.Contains(err.Error(), "exceeds") {
+			t.Errorf("expected %d runs of %d steps over %d params to be rejected, got %v", req.Runs, req.Steps, len(req.Params), err)
+		}
+	}
+}
+
+func TestSimulationStopsWhenContextDone(t *testing.T) {
+	engine := loadTestEngine(t, `
+        initial(idle).
+        transition(idle, spin, idle).
+    `)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := runSimulation(ctx, engine, simulationOptions{Steps: 100_000_000, Seed: 1})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to stop the run, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the run to stop promptly, took %s", elapsed)
+	}
+}
+
+func TestSweepEndpointCTLMetric(t *testing.T) {
+	engine := loadTestEngine(t, shopSpec)
+	s := newTestServer(engine)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"params": map[string][]float64{"stock": {0, 1}},
+		"metric": "ctl(ef(atom(sold_out)))",
+	})
+	rec := httptest.NewRecorder()
+	s.handleSweep(rec, httptest.NewRequest("POST", "/api/sweep", bytes.NewReader(body)))
+
+	var resp struct {
+		Success bool       `json:"success"`
+		Error   string     `json:"error"`
+		Rows    []SweepRow `json:"rows"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !resp.Success || len(resp.Rows) != 2 {
+		t.Fatalf("expected two rows, got %+v", resp)
+	}
+	if resp.Rows[0].Value != 0 || resp.Rows[1].Value != 1 {
+		t.Errorf("expected sell-out to be reachable only with stock, got %+v", resp.Rows)
+	}
+}
+
+func TestCheckWithParams(t *testing.T) {
+	engine := loadTestEngine(t, shopSpec)
+	s := newTestServer(engine)
+
+	check := func(body string) map[string]interface{} {
+		rec := httptest.NewRecorder()
+		s.handleCheck(rec, httptest.NewRequest("POST", "/api/check", bytes.NewBufferString(body)))
+		var resp map[string]interface{}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		return resp
+	}
+	if resp := check(`{"property": "ef(atom(sold_out))", "params": {"stock": 0}}`); resp["satisfied"] != false {
+		t.Errorf("expected no sell-out without stock, got %+v", resp)
+	}
+	if resp := check(`{"property": "ef(atom(sold_out))"}`); resp["satisfied"] != true {
+		t.Errorf("expected the default stock to allow a sell-out, got %+v", resp)
+	}
+}
@@ -0,0 +1,331 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/rfielding/turducken/pkg/model"
+	"github.com/rfielding/turducken/pkg/prolog"
+)
+
+// Timeline axes: simulated time, or completed transitions
+const (
+	timelineAxisTime  = "time"
+	timelineAxisSteps = "steps"
+)
+
+// Timeline is a swimlane view of a simulation run: the state each actor was
+// in over time, and the messages passed between lanes
+type Timeline struct {
+	Axis     string            `json:"axis"`
+	End      float64           `json:"end"`
+	Lanes    []TimelineLane    `json:"lanes"`
+	Messages []TimelineMessage `json:"messages"`
+}
+
+// TimelineLane is one actor's intervals in order
+type TimelineLane struct {
+	Actor     string             `json:"actor"`
+	Intervals []TimelineInterval `json:"intervals"`
+}
+
+// TimelineInterval is a span in one state, or, when Transition is set, a
+// span spent executing a transition out of that state. On the steps axis
+// transition i occupies [i, i+1).
+type TimelineInterval struct {
+	State      string  `json:"state"`
+	Transition string  `json:"transition,omitempty"`
+	Start      float64 `json:"start"`
+	End        float64 `json:"end"`
+}
+
+// TimelineMessage is a message sent on a channel and later received.
+// Messages lost to faults are not drawn.
+type TimelineMessage struct {
+	Channel  string  `json:"channel"`
+	Msg      string  `json:"msg"`
+	From     string  `json:"from"`
+	To       string  `json:"to"`
+	Sent     float64 `json:"sent"`
+	Received float64 `json:"received"`
+}
+
+// timelineMachine supplies the actors, their initial states and the
+// channel operations needed to lay out a run
+type timelineMachine struct {
+	actors  []string
+	initial map[string]string
+	sends   map[string][]prolog.ChannelOp
+	recvs   map[string][]prolog.ChannelOp
+}
+
+func loadTimelineMachine(ctx context.Context, engine *prolog.Engine) (*timelineMachine, error) {
+	sys, err := model.Load(ctx, engine)
+	if err != nil {
+		return nil, err
+	}
+	sends, recvs, err := engine.GetChannelOps(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := &timelineMachine{
+		actors:  sys.Actors,
+		initial: make(map[string]string),
+		sends:   make(map[string][]prolog.ChannelOp),
+		recvs:   make(map[string][]prolog.ChannelOp),
+	}
+	for i, actor := range sys.Actors {
+		m.initial[actor] = sys.Initial.Locals[i]
+	}
+	for _, op := range sends {
+		m.sends[op.From+"|"+op.To] = append(m.sends[op.From+"|"+op.To], op)
+	}
+	for _, op := range recvs {
+		m.recvs[op.From+"|"+op.To] = append(m.recvs[op.From+"|"+op.To], op)
+	}
+	return m, nil
+}
+
+// buildTimeline lays out a simulation result as swimlanes. An empty axis
+// picks simulated time when any transition took time, and steps otherwise.
+func buildTimeline(result *SimulationResult, m *timelineMachine, axis string) *Timeline {
+	if axis == "" {
+		axis = timelineAxisSteps
+		if result.Time > 0 {
+			axis = timelineAxisTime
+		}
+	}
+	tl := &Timeline{Axis: axis, Lanes: []TimelineLane{}, Messages: []TimelineMessage{}}
+	tl.End = float64(len(result.Timeline))
+	if axis == timelineAxisTime {
+		tl.End = result.Time
+	}
+
+	type lane struct {
+		state string
+		since float64
+		out   []TimelineInterval
+	}
+	lanes := make(map[string]*lane)
+	order := append([]string(nil), m.actors...)
+	for _, actor := range m.actors {
+		lanes[actor] = &lane{state: m.initial[actor]}
+	}
+	enter := func(actor, state string, at float64) {
+		l := lanes[actor]
+		if at > l.since {
+			l.out = append(l.out, TimelineInterval{State: l.state, Start: l.since, End: at})
+		}
+		l.state, l.since = state, at
+	}
+
+	// Faults recorded at step i happened while completing transition i
+	// (message faults) or just after it (crashes)
+	faults := make(map[int][]FaultEvent)
+	for _, f := range result.Faults {
+		faults[f.Step] = append(faults[f.Step], f)
+	}
+	applyCrashes := func(step int) {
+		for _, f := range faults[step] {
+			if f.Kind != "crash" || lanes[f.Actor] == nil {
+				continue
+			}
+			at := float64(step)
+			if axis == timelineAxisTime {
+				at = f.Time
+			}
+			if i := strings.LastIndex(f.Detail, " -> "); i >= 0 {
+				enter(f.Actor, f.Detail[i+4:], at)
+			}
+		}
+	}
+
+	type sent struct {
+		actor string
+		at    float64
+	}
+	inFlight := make(map[string][]sent)
+	for _, ev := range result.Timeline {
+		applyCrashes(ev.Step)
+		if lanes[ev.Actor] == nil {
+			lanes[ev.Actor] = &lane{state: ev.From}
+			order = append(order, ev.Actor)
+		}
+		start, end := ev.Start, ev.Time
+		if axis == timelineAxisSteps {
+			start, end = float64(ev.Step), float64(ev.Step+1)
+		}
+
+		enter(ev.Actor, ev.From, start)
+		l := lanes[ev.Actor]
+		l.out = append(l.out, TimelineInterval{State: ev.From, Transition: ev.Label, Start: start, End: end})
+		l.state, l.since = ev.To, end
+
+		edge := ev.From + "|" + ev.To
+		for _, op := range m.recvs[edge] {
+			key := op.Channel + "|" + op.Msg
+			if len(inFlight[key]) == 0 {
+				continue
+			}
+			s := inFlight[key][0]
+			inFlight[key] = inFlight[key][1:]
+			tl.Messages = append(tl.Messages, TimelineMessage{
+				Channel:  op.Channel,
+				Msg:      op.Msg,
+				From:     s.actor,
+				To:       ev.Actor,
+				Sent:     s.at,
+				Received: start,
+			})
+		}
+		for _, op := range m.sends[edge] {
+			copies := 1
+			for _, f := range faults[ev.Step] {
+				if f.Actor != ev.Actor || f.Channel != op.Channel || f.Msg != op.Msg {
+					continue
+				}
+				switch f.Kind {
+				case model.FaultLose, "partitioned":
+					copies = 0
+				case model.FaultDuplicate:
+					copies = 2
+				}
+			}
+			key := op.Channel + "|" + op.Msg
+			for i := 0; i < copies; i++ {
+				inFlight[key] = append(inFlight[key], sent{actor: ev.Actor, at: end})
+			}
+		}
+	}
+	applyCrashes(len(result.Timeline))
+
+	for _, actor := range order {
+		l := lanes[actor]
+		if tl.End > l.since {
+			l.out = append(l.out, TimelineInterval{State: l.state, Start: l.since, End: tl.End})
+		}
+		if l.out == nil {
+			l.out = []TimelineInterval{}
+		}
+		tl.Lanes = append(tl.Lanes, TimelineLane{Actor: actor, Intervals: l.out})
+	}
+	sort.SliceStable(tl.Lanes, func(i, j int) bool { return tl.Lanes[i].Actor < tl.Lanes[j].Actor })
+	return tl
+}
+
+// timelineScale maps axis units to the milliseconds Mermaid's gantt
+// dateFormat x expects, so the axis reads in whole units as seconds
+const timelineScale = 1000
+
+// Mermaid renders the timeline as a gantt chart with one section per actor
+func (tl *Timeline) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("gantt\n")
+	fmt.Fprintf(&b, "    title Simulation timeline (%s)\n", tl.Axis)
+	b.WriteString("    dateFormat x\n")
+	b.WriteString("    axisFormat %s\n")
+	for _, lane := range tl.Lanes {
+		fmt.Fprintf(&b, "    section %s\n", ganttText(lane.Actor))
+		for _, iv := range lane.Intervals {
+			start := int64(iv.Start * timelineScale)
+			end := int64(iv.End * timelineScale)
+			if end <= start {
+				continue
+			}
+			name := iv.State
+			tag := ""
+			if iv.Transition != "" {
+				name = iv.Transition
+				tag = "active, "
+			}
+			fmt.Fprintf(&b, "    %s :%s%d, %d\n", ganttText(name), tag, start, end)
+		}
+	}
+	return b.String()
+}
+
+// ganttText strips characters Mermaid's gantt syntax treats specially
+func ganttText(s string) string {
+	return strings.NewReplacer(":", " ", "#", " ", ";", " ", "\n", " ").Replace(s)
+}
+
+// SVG layout, in pixels
+const (
+	svgLabelWidth = 140
+	svgPlotWidth  = 900
+	svgLaneHeight = 36
+	svgLanePad    = 8
+	svgAxisHeight = 24
+)
+
+// SVG renders the timeline as a standalone swimlane diagram: a row per
+// actor, a bar per interval coloured by state, and an arrow per message
+func (tl *Timeline) SVG() string {
+	width := svgLabelWidth + svgPlotWidth + 20
+	height := svgAxisHeight + len(tl.Lanes)*svgLaneHeight + 10
+	span := tl.End
+	if span <= 0 {
+		span = 1
+	}
+	x := func(v float64) float64 { return svgLabelWidth + v/span*svgPlotWidth }
+	laneY := make(map[string]float64)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`+"\n", width, height)
+	b.WriteString(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" markerHeight="6" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="#374151"/></marker></defs>` + "\n")
+	fmt.Fprintf(&b, `<text x="%d" y="14" fill="#374151">%s 0 – %g</text>`+"\n", svgLabelWidth, tl.Axis, tl.End)
+
+	for i, lane := range tl.Lanes {
+		y := float64(svgAxisHeight + i*svgLaneHeight)
+		laneY[lane.Actor] = y + svgLaneHeight/2
+		fmt.Fprintf(&b, `<text x="4" y="%.1f" dominant-baseline="middle" font-weight="bold">%s</text>`+"\n", y+svgLaneHeight/2, html.EscapeString(lane.Actor))
+		for _, iv := range lane.Intervals {
+			w := x(iv.End) - x(iv.Start)
+			if w <= 0 {
+				continue
+			}
+			fill := stateColor(iv.State)
+			label := iv.State
+			if iv.Transition != "" {
+				fill = "#9ca3af"
+				label = iv.Transition
+			}
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%d" fill="%s" stroke="#ffffff"><title>%s [%g, %g)</title></rect>`+"\n",
+				x(iv.Start), y+svgLanePad/2, w, svgLaneHeight-svgLanePad, fill, html.EscapeString(label), iv.Start, iv.End)
+			if w > float64(len(label))*6 {
+				fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" dominant-baseline="middle" fill="#111827">%s</text>`+"\n", x(iv.Start)+3, y+svgLaneHeight/2, html.EscapeString(label))
+			}
+		}
+	}
+	for _, m := range tl.Messages {
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#374151" marker-end="url(#arrow)"><title>%s@%s</title></line>`+"\n",
+			x(m.Sent), laneY[m.From], x(m.Received), laneY[m.To], html.EscapeString(m.Msg), html.EscapeString(m.Channel))
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// stateColor picks a stable pastel colour for a state name
+func stateColor(state string) string {
+	h := fnv.New32a()
+	h.Write([]byte(state))
+	return fmt.Sprintf("hsl(%d, 60%%, 75%%)", h.Sum32()%360)
+}
+
+// extractTimeline lays out the cached simulation of engine's spec, running
+// one first if none is cached
+func (s *Server) extractTimeline(ctx context.Context, engine *prolog.Engine, axis string) (*Timeline, error) {
+	result, err := s.cachedOrRunSimulation(engine)
+	if err != nil {
+		return nil, err
+	}
+	m, err := loadTimelineMachine(ctx, engine)
+	if err != nil {
+		return nil, err
+	}
+	return buildTimeline(result, m, axis), nil
+}
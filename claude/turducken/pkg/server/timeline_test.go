@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const timedRequestSpec = requestSpec + `
+        transition_duration(client_ready, request, client_sent, const(2)).
+        transition_duration(server_waiting, handle, server_done, const(1)).
+    `
+
+func TestBuildTimelineLanesAndMessages(t *testing.T) {
+	engine := loadTestEngine(t, timedRequestSpec)
+	result := mustRunSimulation(t, engine, simulationOptions{Steps: 10, Model: modelComposed})
+	m, err := loadTimelineMachine(context.Background(), engine)
+	if err != nil {
+		t.Fatalf("loadTimelineMachine error: %v", err)
+	}
+
+	tests := []struct {
+		axis    string
+		client  []TimelineInterval
+		server  []TimelineInterval
+		message TimelineMessage
+	}{
+		{
+			axis: timelineAxisTime,
+			client: []TimelineInterval{
+				{State: "client_ready", Transition: "request", Start: 0, End: 2},
+				{State: "client_sent", Start: 2, End: 3},
+			},
+			server: []TimelineInterval{
+				{State: "server_waiting", Start: 0, End: 2},
+				{State: "server_waiting", Transition: "handle", Start: 2, End: 3},
+			},
+			message: TimelineMessage{Channel: "req", Msg: "ping", From: "client", To: "server", Sent: 2, Received: 2},
+		},
+		{
+			axis: timelineAxisSteps,
+			client: []TimelineInterval{
+				{State: "client_ready", Transition: "request", Start: 0, End: 1},
+				{State: "client_sent", Start: 1, End: 2},
+			},
+			server: []TimelineInterval{
+				{State: "server_waiting", Start: 0, End: 1},
+				{State: "server_waiting", Transition: "handle", Start: 1, End: 2},
+			},
+			message: TimelineMessage{Channel: "req", Msg: "ping", From: "client", To: "server", Sent: 1, Received: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.axis, func(t *testing.T) {
+			tl := buildTimeline(&result, m, tt.axis)
+			if len(tl.Lanes) != 2 || tl.Lanes[0].Actor != "client" || tl.Lanes[1].Actor != "server" {
+				t.Fatalf("expected client and server lanes, got %+v", tl.Lanes)
+			}
+			if !reflect.DeepEqual(tl.Lanes[0].Intervals, tt.client) {
+				t.Errorf("client lane = %+v, want %+v", tl.Lanes[0].Intervals, tt.client)
+			}
+			if !reflect.DeepEqual(tl.Lanes[1].Intervals, tt.server) {
+				t.Errorf("server lane = %+v, want %+v", tl.Lanes[1].Intervals, tt.server)
+			}
+			if len(tl.Messages) != 1 || tl.Messages[0] != tt.message {
+				t.Errorf("messages = %+v, want %+v", tl.Messages, tt.message)
+			}
+		})
+	}
+}
+
+func TestBuildTimelineSkipsLostMessages(t *testing.T) {
+	engine := loadTestEngine(t, timedRequestSpec+"channel_fault(req, lose, 1.0).")
+	result := mustRunSimulation(t, engine, simulationOptions{Steps: 10})
+	m, err := loadTimelineMachine(context.Background(), engine)
+	if err != nil {
+		t.Fatalf("loadTimelineMachine error: %v", err)
+	}
+	if tl := buildTimeline(&result, m, ""); len(tl.Messages) != 0 {
+		t.Errorf("expected the lost ping not to be drawn, got %+v", tl.Messages)
+	}
+}
+
+func TestVisualizeTimelineExports(t *testing.T) {
+	engine := loadTestEngine(t, timedRequestSpec)
+	s := newTestServer(engine)
+	if err := s.runAndCacheSimulationWith(simulationOptions{Steps: 1000, Seed: 1, Model: modelComposed}); err != nil {
+		t.Fatalf("simulation error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleVisualize(rec, httptest.NewRequest("GET", "/api/visualize?type=timeline", nil))
+	body := rec.Body.String()
+	for _, want := range []string{`"axis":"time"`, `"mermaid":"gantt`, "section client", "request :active, 0, 2000"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in timeline response, got %s", want, body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleVisualize(rec, httptest.NewRequest("GET", "/api/visualize?type=timeline&format=svg", nil))
+	if got := rec.Header().Get("Content-Type"); got != "image/svg+xml" {
+		t.Errorf("expected image/svg+xml, got %q", got)
+	}
+	if svg := rec.Body.String(); !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, "marker-end") {
+		t.Errorf("expected an SVG with a message arrow, got %s", svg)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleVisualize(rec, httptest.NewRequest("GET", "/api/visualize?type=timeline&axis=weeks", nil))
+	if rec.Code != 400 {
+		t.Errorf("expected an unknown axis to be rejected, got %d", rec.Code)
+	}
+}
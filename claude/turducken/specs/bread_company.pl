@@ -145,6 +145,41 @@ actor_transition(accounting, accounting_revenue, profit_high, accounting_profita
 actor_transition(accounting, accounting_revenue, profit_low, accounting_break_even).
 actor_transition(accounting, accounting_profitable, record_wages, accounting_payroll).
 
+% === TRANSITION DURATIONS (minutes of simulated time) ===
+transition_duration(factory_mixing, mixed, factory_kneading, uniform(10, 15)).
+transition_duration(factory_kneading, kneaded, factory_baking, const(20)).
+transition_duration(factory_baking, baked, factory_cooling, normal(35, 5)).
+transition_duration(factory_cooling, cooled, factory_bagging, const(30)).
+transition_duration(factory_bagging, bagged, factory_waiting_truck, uniform(5, 10)).
+transition_duration(truck_loading, loaded_truck, truck_in_transit, const(15)).
+transition_duration(truck_in_transit, arrive_store, truck_unloading, normal(40, 10)).
+transition_duration(truck_unloading, unloaded_store, truck_idle, const(10)).
+transition_duration(customers_idle, chance_arrival, customers_arriving_low, exp(0.1)).
+transition_duration(customers_idle, chance_arrival_peak, customers_arriving_high, exp(0.3)).
+transition_duration(customers_buying, checkout, customers_idle, uniform(1, 3)).
+transition_duration(bakers_idle, run_mixer, bakers_running_mixer, uniform(5, 10)).
+transition_duration(store_fresh_rack_full, sell_bread, store_fresh_rack_low, uniform(5, 15)).
+transition_duration(store_fresh_rack_full, rotate_stock, store_rotating_stock, const(120)).
+transition_duration(charity_stocked, clear_rack, charity_idle, const(240)).
+transition_duration(accounting_break_even, record_wages, accounting_payroll, const(480)).
+transition_duration(accounting_profitable, record_wages, accounting_payroll, const(480)).
+transition_duration(accounting_loss, record_sales, accounting_revenue, const(60)).
+
+% === ACCUMULATORS AND REWARDS ===
+accumulator(revenue, 0).
+accumulator(wages, 0).
+accumulator(profit, 0).
+reward(revenue, record_sales, 120).
+reward(wages, record_wages, 80).
+reward(profit, record_sales, 120).
+reward(profit, record_wages, -80).
+
+% Accounting only reports profitable once the profit accumulator clears target
+transition_guard(accounting_revenue, profit_high, accounting_profitable, profit_above_target).
+transition_guard(accounting_revenue, profit_low, accounting_break_even, profit_below_target).
+profit_above_target :- acc(profit, P), P > 200.
+profit_below_target :- acc(profit, P), P =< 200.
+
 % === MESSAGE ANNOTATIONS (for sequence derivation if needed) ===
 msg_annotation(start_day, send, bakers).
 msg_annotation(mixed, send, bakers).
@@ -118,3 +118,8 @@ bar_value(cleanup, 20).
 
 % No deadlock from prepared state
 % check_ctl(ag(or(not(atom(can_commit)), ef(atom(done))))).
+
+% Fault model: uncomment to check the properties above on the composed
+% model with a lossy channel and a participant that can crash
+% channel_fault(coord_to_p1, lose).
+% actor_may_crash(participant1, p1_init).